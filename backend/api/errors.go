@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"inscribeai/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError writes err with the status code matching its service error kind.
+func respondError(c *gin.Context, err error) {
+	var quotaErr *services.QuotaError
+	if errors.As(err, &quotaErr) {
+		retryAfter := math.Ceil(time.Until(quotaErr.ResetAt).Seconds())
+		c.Header("Retry-After", strconv.Itoa(int(math.Max(retryAfter, 0))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "quota": quotaErr})
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidInput):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrUnauthorized):
+		status = http.StatusUnauthorized
+	case errors.Is(err, services.ErrGone):
+		status = http.StatusGone
+	case errors.Is(err, services.ErrUnavailable):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, services.ErrRateLimited):
+		status = http.StatusTooManyRequests
+	}
+
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -1,9 +1,18 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"inscribeai/models"
 	"inscribeai/services"
 
 	"github.com/gin-gonic/gin"
@@ -65,33 +74,2308 @@ func ComposeHandler(contentService *services.ContentService) gin.HandlerFunc {
 		userID := c.MustGet("user_id").(uuid.UUID)
 
 		var req struct {
-			Prompt      string     `json:"prompt" binding:"required"`
+			Prompt      string `json:"prompt" binding:"required"`
+			ContentType string `json:"content_type"`
+			generationRequest
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := contentService.ComposeContent(userID, req.Prompt, req.ContentType, req.interactiveOptions(c))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func EnhanceHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			Content     string `json:"content" binding:"required"`
+			ContentType string `json:"content_type"`
+			generationRequest
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := contentService.EnhanceContent(userID, req.Content, req.ContentType, req.interactiveOptions(c))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func ListContentSchemasHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"schemas": services.ContentSchemas()})
+	}
+}
+
+func ListTransformActionsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"actions": services.TransformActions()})
+	}
+}
+
+func TransformHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			Action    string                 `json:"action" binding:"required"`
+			Text      string                 `json:"text"`
+			ContentID *uuid.UUID             `json:"content_id"`
+			Selection *services.TextRange    `json:"selection"`
+			Params    map[string]interface{} `json:"params"`
+			generationRequest
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		params, err := transformParams(req.Params)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := contentService.TransformContent(userID, services.TransformInput{
+			Action:    req.Action,
+			Text:      req.Text,
+			ContentID: req.ContentID,
+			Selection: req.Selection,
+			Params:    params,
+		}, req.interactiveOptions(c))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// transformParams accepts transform parameters sent as strings, numbers or
+// booleans.
+func transformParams(raw map[string]interface{}) (map[string]string, error) {
+	params := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string:
+			params[name] = v
+		case float64:
+			params[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			params[name] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("parameter %q must be a string, number or boolean", name)
+		}
+	}
+	return params, nil
+}
+
+// generationRequest holds the request fields shared by compose, enhance and
+// transform.
+type generationRequest struct {
+	BrandToneID      *uuid.UUID `json:"brand_tone_id"`
+	BrandToneVersion *int       `json:"brand_tone_version"`
+	TeamID           *uuid.UUID `json:"team_id"`
+	AutoCorrect      bool       `json:"auto_correct"`
+	N                int        `json:"n"`
+	Structured       bool       `json:"structured"`
+	Platforms        []string   `json:"platforms"`
+	RetrieveTopK     int        `json:"retrieve_top_k"`
+}
+
+func (r generationRequest) options() services.GenerationOptions {
+	return services.GenerationOptions{
+		BrandToneID:      r.BrandToneID,
+		BrandToneVersion: r.BrandToneVersion,
+		TeamID:           r.TeamID,
+		AutoCorrect:      r.AutoCorrect,
+		Variants:         r.N,
+		Structured:       r.Structured,
+		Platforms:        r.Platforms,
+		RetrieveTopK:     r.RetrieveTopK,
+	}
+}
+
+// interactiveOptions are the options for a generation answered in the
+// response. Calls still queued when the client goes away are dropped.
+func (r generationRequest) interactiveOptions(c *gin.Context) services.GenerationOptions {
+	opts := r.options()
+	opts.Ctx = c.Request.Context()
+	return opts
+}
+
+func SaveVariantHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		generationID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid generation id"})
+			return
+		}
+
+		var req struct {
+			Variant  *int       `json:"variant" binding:"required"`
+			Title    string     `json:"title" binding:"required"`
+			TeamID   *uuid.UUID `json:"team_id"`
+			FolderID *uuid.UUID `json:"folder_id"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		content, err := contentService.SaveVariant(userID, generationID, *req.Variant, req.Title, req.TeamID, req.FolderID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"content":    content,
+			"duplicates": contentService.FindDuplicates(userID, content),
+		})
+	}
+}
+
+func CreateContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			Title            string          `json:"title" binding:"required"`
+			ContentType      string          `json:"content_type"`
+			Structured       json.RawMessage `json:"structured"`
+			BrandToneID      *uuid.UUID      `json:"brand_tone_id"`
+			BrandToneVersion *int            `json:"brand_tone_version"`
+			TeamID           *uuid.UUID      `json:"team_id"`
+			FolderID         *uuid.UUID      `json:"folder_id"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		content, err := contentService.CreateContent(userID, req.Title, req.ContentType, req.Structured, req.BrandToneID, req.BrandToneVersion, req.TeamID, req.FolderID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"content":    content,
+			"duplicates": contentService.FindDuplicates(userID, content),
+		})
+	}
+}
+
+func GetContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		content, err := contentService.GetContentByID(contentID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"content": content})
+	}
+}
+
+func ListContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+		folderID, err := optionalUUIDQuery(c, "folder_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder id"})
+			return
+		}
+
+		contents, total, err := contentService.ListContent(userID, services.ContentFilter{
+			TeamID:   teamID,
+			FolderID: folderID,
+			Status:   c.Query("status"),
+			Query:    c.Query("q"),
+			Limit:    limit,
+			Offset:   offset,
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"contents": contents,
+			"total":    total,
+		})
+	}
+}
+
+func UpdateContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		var req struct {
+			Title      string          `json:"title"`
+			Content    string          `json:"content"`
+			Structured json.RawMessage `json:"structured"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		content, err := contentService.UpdateContent(contentID, userID, req.Title, req.Content, req.Structured)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"content":    content,
+			"duplicates": contentService.FindDuplicates(userID, content),
+		})
+	}
+}
+
+func SimilarContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		limit, _ := strconv.Atoi(c.Query("limit"))
+
+		similar, err := contentService.FindSimilar(contentID, userID, limit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"similar": similar})
+	}
+}
+
+func DeleteContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		if err := contentService.DeleteContent(contentID, userID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "content deleted"})
+	}
+}
+
+func TransferContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		var req struct {
+			TeamID   uuid.UUID  `json:"team_id" binding:"required"`
+			FolderID *uuid.UUID `json:"folder_id"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		content, err := contentService.TransferToTeam(contentID, userID, req.TeamID, req.FolderID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"content": content})
+	}
+}
+
+func MoveContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		var req struct {
+			FolderID *uuid.UUID `json:"folder_id"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		content, err := contentService.MoveContent(contentID, userID, req.FolderID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"content": content})
+	}
+}
+
+func SetContentBrandToneHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		var req struct {
+			BrandToneID      *uuid.UUID `json:"brand_tone_id"`
+			BrandToneVersion *int       `json:"brand_tone_version"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		content, err := contentService.SetBrandTone(contentID, userID, req.BrandToneID, req.BrandToneVersion)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"content": content})
+	}
+}
+
+// Workflow Handlers
+func GetWorkflowHandler(workflowService *services.WorkflowService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		workflow, err := workflowService.GetWorkflow(contentID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"workflow": workflow})
+	}
+}
+
+func AssignReviewerHandler(workflowService *services.WorkflowService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		var req struct {
+			UserID uuid.UUID `json:"user_id" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		assignment, err := workflowService.AssignReviewer(contentID, actorID, req.UserID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"reviewer": assignment})
+	}
+}
+
+func RemoveReviewerHandler(workflowService *services.WorkflowService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+		reviewerID, err := uuid.Parse(c.Param("userId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		if err := workflowService.RemoveReviewer(contentID, actorID, reviewerID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "reviewer removed"})
+	}
+}
+
+func TransitionContentHandler(workflowService *services.WorkflowService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		var req struct {
+			Status  string `json:"status" binding:"required"`
+			Comment string `json:"comment"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		content, err := workflowService.Transition(contentID, actorID, req.Status, req.Comment)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"content": content})
+	}
+}
+
+func ReviewContentHandler(workflowService *services.WorkflowService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reviewerID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		var req struct {
+			Decision string `json:"decision" binding:"required"`
+			Comment  string `json:"comment"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		content, err := workflowService.Review(contentID, reviewerID, req.Decision, req.Comment)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"content": content})
+	}
+}
+
+// Activity Handlers
+func ContentActivityHandler(activityService *services.ActivityService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		filter, err := activityFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actor id"})
+			return
+		}
+
+		events, total, err := activityService.ContentActivity(contentID, userID, filter)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"activity": events,
+			"total":    total,
+		})
+	}
+}
+
+func TeamActivityHandler(activityService *services.ActivityService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		filter, err := activityFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actor id"})
+			return
+		}
+
+		events, total, err := activityService.TeamActivity(teamID, userID, filter)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"activity": events,
+			"total":    total,
+		})
+	}
+}
+
+// activityFilter reads limit, offset, actor and a comma-separated type list.
+func activityFilter(c *gin.Context) (services.ActivityFilter, error) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	actorID, err := optionalUUIDQuery(c, "actor")
+	if err != nil {
+		return services.ActivityFilter{}, err
+	}
+
+	var types []string
+	if raw := c.Query("type"); raw != "" {
+		for _, t := range strings.Split(raw, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+
+	return services.ActivityFilter{
+		ActorID: actorID,
+		Types:   types,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+// Folder Handlers
+func CreateFolderHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			Name     string     `json:"name" binding:"required"`
+			TeamID   *uuid.UUID `json:"team_id"`
+			ParentID *uuid.UUID `json:"parent_id"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		folder, err := contentService.CreateFolder(userID, req.Name, req.TeamID, req.ParentID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"folder": folder})
+	}
+}
+
+func ListFoldersHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		folders, err := contentService.ListFolders(userID, teamID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"folders": folders})
+	}
+}
+
+func RenameFolderHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		folderID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder id"})
+			return
+		}
+
+		var req struct {
+			Name string `json:"name" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		folder, err := contentService.RenameFolder(folderID, userID, req.Name)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"folder": folder})
+	}
+}
+
+func DeleteFolderHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		folderID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder id"})
+			return
+		}
+
+		if err := contentService.DeleteFolder(folderID, userID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "folder deleted"})
+	}
+}
+
+// Brand Tone Handlers
+func CreateBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			Name        string          `json:"name" binding:"required"`
+			Description string          `json:"description"`
+			Settings    json.RawMessage `json:"settings"`
+			TeamID      *uuid.UUID      `json:"team_id"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		settings, err := parseBrandToneSettings(req.Settings)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		brandTone, err := brandService.CreateBrandTone(userID, req.Name, req.Description, settings, req.TeamID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"brand_tone": brandTone})
+	}
+}
+
+func ListBrandTonesHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		brandTones, err := brandService.ListBrandTones(userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"brand_tones": brandTones})
+	}
+}
+
+func GetBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		brandToneID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			return
+		}
+
+		brandTone, err := brandService.GetBrandToneByID(brandToneID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"brand_tone": brandTone})
+	}
+}
+
+func UpdateBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		brandToneID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			return
+		}
+
+		var req struct {
+			Name        string          `json:"name"`
+			Description string          `json:"description"`
+			Settings    json.RawMessage `json:"settings"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		settings, err := parseBrandToneSettings(req.Settings)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		brandTone, err := brandService.UpdateBrandTone(brandToneID, userID, req.Name, req.Description, settings)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"brand_tone": brandTone})
+	}
+}
+
+func DeleteBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		brandToneID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			return
+		}
+
+		if err := brandService.DeleteBrandTone(brandToneID, userID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "brand tone deleted"})
+	}
+}
+
+func AnalyzeBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		brandToneID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			return
+		}
+
+		var req struct {
+			Text string `json:"text" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		analysis, err := brandService.AnalyzeText(c.Request.Context(), brandToneID, userID, req.Text)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"analysis": analysis})
+	}
+}
+
+func ListBrandToneVersionsHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		brandToneID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			return
+		}
+
+		versions, err := brandService.ListBrandToneVersions(brandToneID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"versions": versions})
+	}
+}
+
+func GetBrandToneVersionHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		brandToneID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			return
+		}
+		version, err := strconv.Atoi(c.Param("version"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+
+		v, err := brandService.GetBrandToneVersion(brandToneID, userID, version)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"version": v})
+	}
+}
+
+func RollbackBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		brandToneID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			return
+		}
+		version, err := strconv.Atoi(c.Param("version"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+
+		brandTone, err := brandService.RollbackBrandTone(brandToneID, userID, version)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"brand_tone": brandTone})
+	}
+}
+
+func DiffBrandToneVersionsHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		brandToneID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			return
+		}
+		from, err := strconv.Atoi(c.Query("from"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a version number"})
+			return
+		}
+		to, err := strconv.Atoi(c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a version number"})
+			return
+		}
+
+		diff, err := brandService.DiffBrandToneVersions(brandToneID, userID, from, to)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"diff": diff})
+	}
+}
+
+func ListBrandToneDefaultsHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		defaults, err := brandService.ListBrandToneDefaults(userID, teamID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"defaults": defaults})
+	}
+}
+
+func SetBrandToneDefaultHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			BrandToneID uuid.UUID  `json:"brand_tone_id" binding:"required"`
+			TeamID      *uuid.UUID `json:"team_id"`
 			ContentType string     `json:"content_type"`
-			BrandToneID *uuid.UUID `json:"brand_tone_id"`
 		}
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		def, err := brandService.SetBrandToneDefault(userID, req.TeamID, req.ContentType, req.BrandToneID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"default": def})
+	}
+}
+
+func ClearBrandToneDefaultHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		if err := brandService.ClearBrandToneDefault(userID, teamID, c.Query("content_type")); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "default cleared"})
+	}
+}
+
+// LearnBrandToneHandler drafts a brand tone from content and pasted samples.
+// The draft is returned for review and is not saved.
+func LearnBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			Name       string      `json:"name"`
+			ContentIDs []uuid.UUID `json:"content_ids"`
+			Samples    []string    `json:"samples"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		learned, err := brandService.LearnBrandTone(c.Request.Context(), userID, req.Name, req.ContentIDs, req.Samples)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, learned)
+	}
+}
+
+// maxImportSize caps brand tone import uploads.
+const maxImportSize = 4 << 20
+
+func ExportBrandTonesHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var ids []uuid.UUID
+		if raw := c.Query("ids"); raw != "" {
+			for _, s := range strings.Split(raw, ",") {
+				id, err := uuid.Parse(strings.TrimSpace(s))
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+					return
+				}
+				ids = append(ids, id)
+			}
+		}
+
+		format := strings.ToLower(c.DefaultQuery("format", "json"))
+		if format != "json" && format != "yaml" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or yaml"})
+			return
+		}
+
+		bundle, err := brandService.ExportBrandTones(userID, ids)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		filename := "brand-tones-" + bundle.ExportedAt.Format("20060102") + "." + format
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		if format == "yaml" {
+			c.YAML(http.StatusOK, bundle)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, bundle)
+	}
+}
+
+func ImportBrandTonesHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+		dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+
+		format := c.Query("format")
+		if format == "" && strings.Contains(c.ContentType(), "yaml") {
+			format = "yaml"
+		}
+
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxImportSize+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(data) > maxImportSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "import file is too large"})
+			return
+		}
+
+		bundle, err := services.DecodeBrandToneBundle(data, format)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		report, err := brandService.ImportBrandTones(userID, teamID, bundle, c.Query("mode"), dryRun)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		if report.Invalid > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "bundle has invalid brand tones", "report": report})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"report": report})
+	}
+}
+
+// Glossary Handlers
+func CreateGlossaryTermHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			BrandToneID       *uuid.UUID `json:"brand_tone_id"`
+			TeamID            *uuid.UUID `json:"team_id"`
+			Term              string     `json:"term" binding:"required"`
+			PreferredForm     string     `json:"preferred_form"`
+			ForbiddenVariants []string   `json:"forbidden_variants"`
+			Notes             string     `json:"notes"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		term, err := brandService.CreateGlossaryTerm(userID, req.BrandToneID, req.TeamID, req.Term, req.PreferredForm, req.ForbiddenVariants, req.Notes)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"term": term})
+	}
+}
+
+func ListGlossaryHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		brandToneID, err := optionalUUIDQuery(c, "brand_tone_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			return
+		}
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		terms, err := brandService.ListGlossary(userID, brandToneID, teamID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"terms": terms})
+	}
+}
+
+func UpdateGlossaryTermHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		termID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid glossary term id"})
+			return
+		}
+
+		var req struct {
+			Term              string   `json:"term" binding:"required"`
+			PreferredForm     string   `json:"preferred_form"`
+			ForbiddenVariants []string `json:"forbidden_variants"`
+			Notes             string   `json:"notes"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		term, err := brandService.UpdateGlossaryTerm(termID, userID, req.Term, req.PreferredForm, req.ForbiddenVariants, req.Notes)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"term": term})
+	}
+}
+
+func DeleteGlossaryTermHandler(brandService *services.BrandService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		termID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid glossary term id"})
+			return
+		}
+
+		if err := brandService.DeleteGlossaryTerm(termID, userID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "glossary term deleted"})
+	}
+}
+
+// parseBrandToneSettings accepts settings as a JSON object or, for older
+// clients, a string containing one. Unknown fields are rejected so typos
+// don't silently drop a setting.
+func parseBrandToneSettings(raw json.RawMessage) (models.BrandToneSettings, error) {
+	var settings models.BrandToneSettings
+	if len(raw) == 0 || string(raw) == "null" {
+		return settings, nil
+	}
+
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		if strings.TrimSpace(encoded) == "" {
+			return settings, nil
+		}
+		raw = json.RawMessage(encoded)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&settings); err != nil {
+		return settings, fmt.Errorf("invalid settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Collaboration Handlers
+func ShareContentHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ownerID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			ContentID uuid.UUID `json:"content_id" binding:"required"`
+			UserID    uuid.UUID `json:"user_id" binding:"required"`
+			Action    string    `json:"action" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		collab, err := collabService.ShareContent(req.ContentID, ownerID, req.UserID, req.Action)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"collaboration": collab})
+	}
+}
+
+func AddCommentHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			ContentID uuid.UUID `json:"content_id" binding:"required"`
+			Comment   string    `json:"comment" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		collab, err := collabService.AddComment(req.ContentID, userID, req.Comment)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"collaboration": collab})
+	}
+}
+
+func GetCollaborationsHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		collabs, err := collabService.GetCollaborations(contentID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"collaborations": collabs})
+	}
+}
+
+func CreateShareLinkHandler(shareService *services.ShareLinkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			ContentID      uuid.UUID `json:"content_id" binding:"required"`
+			Scope          string    `json:"scope"`
+			ExpiresInHours int       `json:"expires_in_hours"`
+			Password       string    `json:"password"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Scope == "" {
+			req.Scope = "view"
+		}
+
+		link, token, err := shareService.CreateShareLink(req.ContentID, userID, req.Scope, time.Duration(req.ExpiresInHours)*time.Hour, req.Password)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"share_link": link,
+			"token":      token,
+			"url":        requestBaseURL(c) + "/api/public/share/" + token,
+		})
+	}
+}
+
+func ListShareLinksHandler(shareService *services.ShareLinkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		contentID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			return
+		}
+
+		links, err := shareService.ListShareLinks(contentID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"share_links": links})
+	}
+}
+
+func RevokeShareLinkHandler(shareService *services.ShareLinkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		linkID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid share link id"})
+			return
+		}
+
+		if err := shareService.RevokeShareLink(linkID, userID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "share link revoked"})
+	}
+}
+
+// Public Share Handlers
+
+// ViewSharedContentHandler serves shared content without authentication.
+// Browsers get a rendered page, other clients JSON. The password can be sent
+// in the X-Share-Password header or as a form field; once it is accepted a
+// short-lived cookie keeps the link unlocked.
+func ViewSharedContentHandler(shareService *services.ShareLinkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Param("token")
+		access := shareAccess(c)
+		wantsHTML := c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+
+		link, content, err := shareService.OpenShareLink(token, access)
+		if err != nil {
+			if !wantsHTML {
+				respondError(c, err)
+				return
+			}
+			data := sharePageData{Error: err.Error()}
+			status := http.StatusNotFound
+			if errors.Is(err, services.ErrUnauthorized) {
+				data.NeedsPassword = true
+				status = http.StatusUnauthorized
+				if access.Password == "" {
+					data.Error = ""
+				}
+			} else if errors.Is(err, services.ErrRateLimited) {
+				data.NeedsPassword = true
+				status = http.StatusTooManyRequests
+			} else if errors.Is(err, services.ErrGone) {
+				status = http.StatusGone
+			}
+			renderSharePage(c, status, data)
+			return
+		}
+		if access.Password != "" {
+			setShareUnlockCookie(c, shareService, link)
+		}
+
+		var comments []models.ShareComment
+		if link.Scope == "comment" {
+			comments, err = shareService.ListShareComments(link.ID)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+		}
+
+		if wantsHTML {
+			renderSharePage(c, http.StatusOK, sharePageData{
+				Link:       link,
+				Content:    content,
+				Comments:   comments,
+				CommentURL: c.Request.URL.Path + "/comments",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"content": gin.H{
+				"title":        content.Title,
+				"content":      content.Content,
+				"content_type": content.ContentType,
+				"updated_at":   content.UpdatedAt,
+			},
+			"scope":    link.Scope,
+			"comments": comments,
+		})
+	}
+}
+
+func AddSharedCommentHandler(shareService *services.ShareLinkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Param("token")
+
+		var req struct {
+			Name     string `json:"name" form:"name"`
+			Comment  string `json:"comment" form:"comment" binding:"required"`
+			Password string `json:"password" form:"password"`
+		}
+
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		access := shareAccess(c)
+		if req.Password != "" {
+			access.Password = req.Password
+		}
+
+		comment, err := shareService.AddShareComment(token, access, req.Name, req.Comment)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		// Comments posted from the rendered page go back to it
+		if c.ContentType() == "application/x-www-form-urlencoded" {
+			c.Redirect(http.StatusSeeOther, strings.TrimSuffix(c.Request.URL.Path, "/comments"))
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"comment": comment})
+	}
+}
+
+func CreateTeamHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ownerID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			Name string `json:"name" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		team, err := collabService.CreateTeam(ownerID, req.Name)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"team": team})
+	}
+}
+
+func GetUserTeamsHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		teams, err := collabService.GetUserTeams(userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"teams": teams})
+	}
+}
+
+func AddTeamMemberHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		var req struct {
+			UserID uuid.UUID `json:"user_id" binding:"required"`
+			Role   string    `json:"role" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := collabService.AddTeamMember(teamID, actorID, req.UserID, req.Role); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "team member added"})
+	}
+}
+
+func GetTeamHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		team, err := collabService.GetTeam(teamID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"team": team})
+	}
+}
+
+func UpdateWorkflowSettingsHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		var req struct {
+			RequiredApprovals *int `json:"required_approvals" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		team, err := collabService.UpdateWorkflowSettings(teamID, actorID, *req.RequiredApprovals)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"team": team})
+	}
+}
+
+func RenameTeamHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		var req struct {
+			Name string `json:"name" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		team, err := collabService.RenameTeam(teamID, actorID, req.Name)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"team": team})
+	}
+}
+
+func DeleteTeamHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		if err := collabService.DeleteTeam(teamID, actorID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "team deleted"})
+	}
+}
+
+func UpdateTeamMemberRoleHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+		userID, err := uuid.Parse(c.Param("userId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req struct {
+			Role string `json:"role" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		member, err := collabService.UpdateTeamMemberRole(teamID, actorID, userID, req.Role)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"member": member})
+	}
+}
+
+func RemoveTeamMemberHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+		userID, err := uuid.Parse(c.Param("userId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		if err := collabService.RemoveTeamMember(teamID, actorID, userID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "team member removed"})
+	}
+}
+
+func LeaveTeamHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		if err := collabService.LeaveTeam(teamID, userID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "left team"})
+	}
+}
+
+func TransferOwnershipHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ownerID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		var req struct {
+			UserID uuid.UUID `json:"user_id" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		team, err := collabService.TransferOwnership(teamID, ownerID, req.UserID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"team": team})
+	}
+}
+
+func InviteTeamMemberHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		var req struct {
+			Email string `json:"email" binding:"required,email"`
+			Role  string `json:"role"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Role == "" {
+			req.Role = models.RoleMember
+		}
+
+		invitation, token, err := collabService.InviteTeamMember(teamID, actorID, req.Email, req.Role)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"invitation": invitation,
+			"token":      token,
+			"accept_url": appURL() + "/invitations/" + token,
+		})
+	}
+}
+
+func ListInvitationsHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		invitations, err := collabService.ListInvitations(teamID, actorID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+	}
+}
+
+func RevokeInvitationHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+		invitationID, err := uuid.Parse(c.Param("invitationId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invitation id"})
+			return
+		}
+
+		if err := collabService.RevokeInvitation(teamID, invitationID, actorID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "invitation revoked"})
+	}
+}
+
+func AcceptInvitationHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		team, err := collabService.AcceptInvitation(c.Param("token"), userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"team": team})
+	}
+}
+
+func ListTeamRolesHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		roles, err := collabService.ListTeamRoles(teamID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"roles":       roles,
+			"permissions": services.AllPermissions,
+		})
+	}
+}
+
+func CreateTeamRoleHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		var req struct {
+			Name        string   `json:"name" binding:"required"`
+			Permissions []string `json:"permissions"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		role, err := collabService.CreateTeamRole(teamID, actorID, req.Name, req.Permissions)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"role": role})
+	}
+}
+
+func UpdateTeamRoleHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+		roleID, err := uuid.Parse(c.Param("roleId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role id"})
+			return
+		}
+
+		var req struct {
+			Name        string   `json:"name" binding:"required"`
+			Permissions []string `json:"permissions"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		role, err := collabService.UpdateTeamRole(teamID, roleID, actorID, req.Name, req.Permissions)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"role": role})
+	}
+}
+
+func DeleteTeamRoleHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+		roleID, err := uuid.Parse(c.Param("roleId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role id"})
+			return
+		}
+
+		if err := collabService.DeleteTeamRole(teamID, roleID, actorID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "role deleted"})
+	}
+}
+
+// Webhook Handlers
+func CreateWebhookHandler(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			URL    string     `json:"url" binding:"required"`
+			Events []string   `json:"events"`
+			TeamID *uuid.UUID `json:"team_id"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		webhook, secret, err := webhookService.CreateWebhook(userID, req.TeamID, req.URL, req.Events)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"webhook": webhook,
+			"secret":  secret,
+		})
+	}
+}
+
+func ListWebhooksHandler(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		webhooks, err := webhookService.ListWebhooks(userID, teamID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+	}
+}
+
+func UpdateWebhookHandler(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		webhookID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+			return
+		}
+
+		var req struct {
+			URL    string   `json:"url" binding:"required"`
+			Events []string `json:"events"`
+			Active *bool    `json:"active"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		webhook, err := webhookService.UpdateWebhook(webhookID, userID, req.URL, req.Events, req.Active)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+func DeleteWebhookHandler(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		webhookID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+			return
+		}
+
+		if err := webhookService.DeleteWebhook(webhookID, userID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+	}
+}
+
+func ListWebhookDeliveriesHandler(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		webhookID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+			return
+		}
+
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+		deliveries, total, err := webhookService.ListDeliveries(webhookID, userID, limit, offset)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"deliveries": deliveries,
+			"total":      total,
+		})
+	}
+}
+
+func RedeliverWebhookHandler(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		webhookID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+			return
+		}
+		deliveryID, err := uuid.Parse(c.Param("deliveryId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delivery id"})
+			return
+		}
+
+		delivery, err := webhookService.Redeliver(webhookID, deliveryID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, delivery)
+	}
+}
+
+func PingWebhookHandler(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		webhookID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+			return
+		}
+
+		delivery, err := webhookService.Ping(webhookID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, delivery)
+	}
+}
+
+// History Handler
+func HistoryHandler(contentService *services.ContentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+		contents, total, err := contentService.ListContent(userID, services.ContentFilter{Limit: limit, Offset: offset})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"history": contents,
+			"total":   total,
+		})
+	}
+}
+
+// Prompt Template Handlers
+func ListPromptTemplatesHandler(promptService *services.PromptService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		templates, err := promptService.ListPromptTemplates(userID, teamID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"templates": templates})
+	}
+}
+
+func ListPromptTemplateVersionsHandler(promptService *services.PromptService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+
+		versions, err := promptService.ListPromptTemplateVersions(userID, c.Param("action"), teamID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"versions": versions})
+	}
+}
+
+func UpdatePromptTemplateHandler(promptService *services.PromptService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		var req struct {
+			Body   string     `json:"body" binding:"required"`
+			Note   string     `json:"note"`
+			TeamID *uuid.UUID `json:"team_id"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		template, err := promptService.UpdatePromptTemplate(userID, c.Param("action"), req.TeamID, req.Body, req.Note)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"template": template})
+	}
+}
+
+func RestorePromptTemplateHandler(promptService *services.PromptService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+		version, err := strconv.Atoi(c.Param("version"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+
+		template, err := promptService.RestorePromptTemplate(userID, c.Param("action"), teamID, version)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"template": template})
+	}
+}
+
+func ResetPromptTemplateHandler(promptService *services.PromptService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
 			return
 		}
 
-		content, err := contentService.ComposeContent(userID, req.Prompt, req.ContentType, req.BrandToneID)
+		template, err := promptService.ResetPromptTemplate(userID, c.Param("action"), teamID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"content": content})
+		c.JSON(http.StatusOK, gin.H{"template": template})
 	}
 }
 
-func EnhanceHandler(contentService *services.ContentService) gin.HandlerFunc {
+func PreviewPromptHandler(promptService *services.PromptService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
 
 		var req struct {
-			Content     string     `json:"content" binding:"required"`
-			BrandToneID *uuid.UUID `json:"brand_tone_id"`
+			Action           string                 `json:"action" binding:"required"`
+			Body             *string                `json:"body"`
+			Input            string                 `json:"input"`
+			Context          string                 `json:"context"`
+			ContentType      string                 `json:"content_type"`
+			BrandToneID      *uuid.UUID             `json:"brand_tone_id"`
+			BrandToneVersion *int                   `json:"brand_tone_version"`
+			TeamID           *uuid.UUID             `json:"team_id"`
+			Params           map[string]interface{} `json:"params"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -99,24 +2383,44 @@ func EnhanceHandler(contentService *services.ContentService) gin.HandlerFunc {
 			return
 		}
 
-		enhanced, err := contentService.EnhanceContent(userID, req.Content, req.BrandToneID)
+		params, err := transformParams(req.Params)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		preview, err := promptService.PreviewPrompt(userID, services.PromptPreviewInput{
+			Action:           req.Action,
+			TeamID:           req.TeamID,
+			Draft:            req.Body,
+			Input:            req.Input,
+			Context:          req.Context,
+			ContentType:      req.ContentType,
+			BrandToneID:      req.BrandToneID,
+			BrandToneVersion: req.BrandToneVersion,
+			Params:           params,
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"content": enhanced})
+		c.JSON(http.StatusOK, preview)
 	}
 }
 
-func CreateContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+// Long-form Handlers
+func CreateLongFormHandler(longFormService *services.LongFormService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
 
 		var req struct {
 			Title       string     `json:"title" binding:"required"`
+			Brief       string     `json:"brief"`
 			ContentType string     `json:"content_type"`
-			BrandToneID *uuid.UUID `json:"brand_tone_id"`
+			Sections    int        `json:"sections"`
+			FolderID    *uuid.UUID `json:"folder_id"`
+			generationRequest
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -124,67 +2428,75 @@ func CreateContentHandler(contentService *services.ContentService) gin.HandlerFu
 			return
 		}
 
-		content, err := contentService.CreateContent(userID, req.Title, req.ContentType, req.BrandToneID)
+		doc, err := longFormService.CreateLongForm(userID, services.LongFormInput{
+			Title:       req.Title,
+			Brief:       req.Brief,
+			ContentType: req.ContentType,
+			Sections:    req.Sections,
+			FolderID:    req.FolderID,
+		}, req.interactiveOptions(c))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"content": content})
+		c.JSON(http.StatusCreated, gin.H{"document": doc})
 	}
 }
 
-func GetContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+func ListLongFormsHandler(longFormService *services.LongFormService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
-		contentID, err := uuid.Parse(c.Param("id"))
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
 			return
 		}
 
-		content, err := contentService.GetContentByID(contentID, userID)
+		docs, err := longFormService.ListLongForms(userID, teamID)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "content not found"})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"content": content})
+		c.JSON(http.StatusOK, gin.H{"documents": docs})
 	}
 }
 
-func ListContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+func GetLongFormHandler(longFormService *services.LongFormService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
+		docID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document id"})
+			return
+		}
 
-		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
-		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
-
-		contents, total, err := contentService.ListContent(userID, limit, offset)
+		doc, err := longFormService.GetLongForm(docID, userID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"contents": contents,
-			"total":    total,
-		})
+		c.JSON(http.StatusOK, gin.H{"document": doc})
 	}
 }
 
-func UpdateContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+func UpdateOutlineHandler(longFormService *services.LongFormService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
-		contentID, err := uuid.Parse(c.Param("id"))
+		docID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document id"})
 			return
 		}
 
 		var req struct {
-			Title   string `json:"title"`
-			Content string `json:"content"`
+			Outline []struct {
+				Heading string `json:"heading"`
+				Notes   string `json:"notes"`
+			} `json:"outline" binding:"required"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -192,293 +2504,456 @@ func UpdateContentHandler(contentService *services.ContentService) gin.HandlerFu
 			return
 		}
 
-		content, err := contentService.UpdateContent(contentID, userID, req.Title, req.Content)
+		outline := make([]models.OutlineSection, len(req.Outline))
+		for i, s := range req.Outline {
+			outline[i] = models.OutlineSection{Heading: s.Heading, Notes: s.Notes}
+		}
+
+		doc, err := longFormService.UpdateOutline(docID, userID, outline)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"content": content})
+		c.JSON(http.StatusOK, gin.H{"document": doc})
 	}
 }
 
-func DeleteContentHandler(contentService *services.ContentService) gin.HandlerFunc {
+func GenerateLongFormHandler(longFormService *services.LongFormService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
-		contentID, err := uuid.Parse(c.Param("id"))
+		docID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document id"})
 			return
 		}
 
-		if err := contentService.DeleteContent(contentID, userID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		doc, err := longFormService.GenerateLongForm(docID, userID)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "content deleted"})
+		c.JSON(http.StatusAccepted, gin.H{"document": doc})
 	}
 }
 
-// Brand Tone Handlers
-func CreateBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+// LongFormEventsHandler streams generation progress as server-sent events:
+// a "document" event with the current state, then progress events until
+// the run completes or fails. The stream ends at once when nothing is
+// generating.
+func LongFormEventsHandler(longFormService *services.LongFormService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
+		docID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document id"})
+			return
+		}
 
-		var req struct {
-			Name        string     `json:"name" binding:"required"`
-			Description string     `json:"description"`
-			Settings    string     `json:"settings"`
-			TeamID      *uuid.UUID `json:"team_id"`
+		doc, events, unsubscribe, err := longFormService.Subscribe(docID, userID)
+		if err != nil {
+			respondError(c, err)
+			return
 		}
+		defer unsubscribe()
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Header("Cache-Control", "no-cache")
+		c.SSEvent("document", doc)
+		c.Writer.Flush()
+		if events == nil {
 			return
 		}
 
-		brandTone, err := brandService.CreateBrandTone(userID, req.Name, req.Description, req.Settings, req.TeamID)
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return false
+				}
+				c.SSEvent(event.Type, event)
+				return true
+			case <-c.Request.Context().Done():
+				return false
+			}
+		})
+	}
+}
+
+func DeleteLongFormHandler(longFormService *services.LongFormService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		docID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document id"})
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"brand_tone": brandTone})
+		if err := longFormService.DeleteLongForm(docID, userID); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "document deleted"})
 	}
 }
 
-func ListBrandTonesHandler(brandService *services.BrandService) gin.HandlerFunc {
+// Usage Handlers
+func UsageReportHandler(usageService *services.UsageService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
 
-		brandTones, err := brandService.ListBrandTones(userID)
+		teamID, err := optionalUUIDQuery(c, "team_id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
+		}
+		filter := services.UsageFilter{TeamID: teamID, GroupBy: c.Query("group_by")}
+		if filter.From, err = dateQuery(c, "from"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+			return
+		}
+		if filter.To, err = dateQuery(c, "to"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+			return
+		}
+
+		report, err := usageService.UsageReport(userID, filter)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"brand_tones": brandTones})
+		c.JSON(http.StatusOK, gin.H{"report": report})
 	}
 }
 
-func GetBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+// dateQuery parses an optional YYYY-MM-DD or RFC 3339 query parameter.
+func dateQuery(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func QuotaStatusHandler(usageService *services.UsageService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
-		brandToneID, err := uuid.Parse(c.Param("id"))
+
+		teamID, err := optionalUUIDQuery(c, "team_id")
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
 			return
 		}
 
-		brandTone, err := brandService.GetBrandToneByID(brandToneID, userID)
+		status, err := usageService.QuotaStatus(userID, teamID)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "brand tone not found"})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"brand_tone": brandTone})
+		c.JSON(http.StatusOK, gin.H{"quota": status})
 	}
 }
 
-func UpdateBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+func ListPlansHandler(usageService *services.UsageService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.MustGet("user_id").(uuid.UUID)
-		brandToneID, err := uuid.Parse(c.Param("id"))
+		plans, err := usageService.ListPlans()
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
+			respondError(c, err)
 			return
 		}
 
-		var req struct {
-			Name        string `json:"name"`
-			Description string `json:"description"`
-			Settings    string `json:"settings"`
-		}
+		c.JSON(http.StatusOK, gin.H{"plans": plans})
+	}
+}
+
+func SetPlanQuotaHandler(usageService *services.UsageService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
 
+		var req services.Quota
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		brandTone, err := brandService.UpdateBrandTone(brandToneID, userID, req.Name, req.Description, req.Settings)
+		plan, err := usageService.SetPlanQuota(userID, c.Param("plan"), req)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"brand_tone": brandTone})
+		c.JSON(http.StatusOK, gin.H{"plan": plan})
 	}
 }
 
-func DeleteBrandToneHandler(brandService *services.BrandService) gin.HandlerFunc {
+func ResetPlanQuotaHandler(usageService *services.UsageService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
-		brandToneID, err := uuid.Parse(c.Param("id"))
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid brand tone id"})
-			return
-		}
 
-		if err := brandService.DeleteBrandTone(brandToneID, userID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := usageService.ResetPlanQuota(userID, c.Param("plan")); err != nil {
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "brand tone deleted"})
+		c.JSON(http.StatusOK, gin.H{"message": "plan limits reset"})
 	}
 }
 
-// Collaboration Handlers
-func ShareContentHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+func SetTeamQuotaHandler(usageService *services.UsageService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ownerID := c.MustGet("user_id").(uuid.UUID)
-
-		var req struct {
-			ContentID uuid.UUID `json:"content_id" binding:"required"`
-			UserID    uuid.UUID `json:"user_id" binding:"required"`
-			Action    string    `json:"action" binding:"required"`
+		userID := c.MustGet("user_id").(uuid.UUID)
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			return
 		}
 
+		var req services.Quota
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		collab, err := collabService.ShareContent(req.ContentID, ownerID, req.UserID, req.Action)
+		quota, err := usageService.SetTeamQuota(userID, teamID, req)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"collaboration": collab})
+		c.JSON(http.StatusOK, gin.H{"quota": quota})
 	}
 }
 
-func AddCommentHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+func RemoveTeamQuotaHandler(usageService *services.UsageService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
-
-		var req struct {
-			ContentID uuid.UUID `json:"content_id" binding:"required"`
-			Comment   string    `json:"comment" binding:"required"`
-		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
 			return
 		}
 
-		collab, err := collabService.AddComment(req.ContentID, userID, req.Comment)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := usageService.RemoveTeamQuota(userID, teamID); err != nil {
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"collaboration": collab})
+		c.JSON(http.StatusOK, gin.H{"message": "team quota removed"})
 	}
 }
 
-func GetCollaborationsHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+func SetUserPlanHandler(usageService *services.UsageService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		contentID, err := uuid.Parse(c.Param("id"))
+		userID := c.MustGet("user_id").(uuid.UUID)
+		targetID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content id"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req struct {
+			Plan string `json:"plan" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		collabs, err := collabService.GetCollaborations(contentID)
+		user, err := usageService.SetUserPlan(userID, targetID, req.Plan)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"collaborations": collabs})
+		c.JSON(http.StatusOK, gin.H{"user": user})
 	}
 }
 
-func CreateTeamHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+// Batch Handlers
+
+// maxBatchUploadSize caps batch job CSV uploads.
+const maxBatchUploadSize = 4 << 20
+
+// CreateBatchHandler accepts a JSON body with items, or a CSV upload
+// (Content-Type text/csv) with the shared options in the query string.
+func CreateBatchHandler(batchService *services.BatchService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ownerID := c.MustGet("user_id").(uuid.UUID)
+		userID := c.MustGet("user_id").(uuid.UUID)
 
 		var req struct {
-			Name string `json:"name" binding:"required"`
+			Name        string                    `json:"name"`
+			ContentType string                    `json:"content_type"`
+			FolderID    *uuid.UUID                `json:"folder_id"`
+			Items       []services.BatchItemInput `json:"items" binding:"required"`
+			generationRequest
 		}
 
-		if err := c.ShouldBindJSON(&req); err != nil {
+		if c.ContentType() == "text/csv" {
+			data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBatchUploadSize+1))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if len(data) > maxBatchUploadSize {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "CSV file is too large"})
+				return
+			}
+			if req.Items, err = services.ParseBatchCSV(data); err != nil {
+				respondError(c, err)
+				return
+			}
+			if err := batchQueryOptions(c, &req.Name, &req.ContentType, &req.FolderID, &req.generationRequest); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		} else if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		team, err := collabService.CreateTeam(ownerID, req.Name)
+		status, err := batchService.CreateBatch(userID, services.BatchInput{
+			Name:        req.Name,
+			ContentType: req.ContentType,
+			FolderID:    req.FolderID,
+			Items:       req.Items,
+		}, req.options())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"team": team})
+		c.JSON(http.StatusAccepted, status)
 	}
 }
 
-func GetUserTeamsHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+// batchQueryOptions reads a CSV upload's shared options from the query
+// string. Platforms are comma-separated.
+func batchQueryOptions(c *gin.Context, name, contentType *string, folderID **uuid.UUID, opts *generationRequest) error {
+	var err error
+	*name = c.Query("name")
+	*contentType = c.Query("content_type")
+	if *folderID, err = optionalUUIDQuery(c, "folder_id"); err != nil {
+		return errors.New("invalid folder id")
+	}
+	if opts.TeamID, err = optionalUUIDQuery(c, "team_id"); err != nil {
+		return errors.New("invalid team id")
+	}
+	if opts.BrandToneID, err = optionalUUIDQuery(c, "brand_tone_id"); err != nil {
+		return errors.New("invalid brand tone id")
+	}
+	if raw := c.Query("brand_tone_version"); raw != "" {
+		version, err := strconv.Atoi(raw)
+		if err != nil {
+			return errors.New("invalid brand tone version")
+		}
+		opts.BrandToneVersion = &version
+	}
+	if opts.AutoCorrect, err = strconv.ParseBool(c.DefaultQuery("auto_correct", "false")); err != nil {
+		return errors.New("invalid auto_correct")
+	}
+	if opts.Structured, err = strconv.ParseBool(c.DefaultQuery("structured", "false")); err != nil {
+		return errors.New("invalid structured")
+	}
+	if raw := c.Query("platforms"); raw != "" {
+		opts.Platforms = strings.Split(raw, ",")
+	}
+	if raw := c.Query("retrieve_top_k"); raw != "" {
+		if opts.RetrieveTopK, err = strconv.Atoi(raw); err != nil {
+			return errors.New("invalid retrieve_top_k")
+		}
+	}
+	return nil
+}
+
+func ListBatchesHandler(batchService *services.BatchService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
 
-		teams, err := collabService.GetUserTeams(userID)
+		teamID, err := optionalUUIDQuery(c, "team_id")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"teams": teams})
+		jobs, err := batchService.ListBatches(userID, teamID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"jobs": jobs})
 	}
 }
 
-func AddTeamMemberHandler(collabService *services.CollaborationService) gin.HandlerFunc {
+func GetBatchHandler(batchService *services.BatchService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ownerID := c.MustGet("user_id").(uuid.UUID)
-		teamID, err := uuid.Parse(c.Param("id"))
+		userID := c.MustGet("user_id").(uuid.UUID)
+		jobID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team id"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
 			return
 		}
 
-		var req struct {
-			UserID uuid.UUID `json:"user_id" binding:"required"`
-			Role   string    `json:"role" binding:"required"`
+		status, err := batchService.GetBatch(jobID, userID, c.Query("status"))
+		if err != nil {
+			respondError(c, err)
+			return
 		}
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+func CancelBatchHandler(batchService *services.BatchService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		jobID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
 			return
 		}
 
-		if err := collabService.AddTeamMember(teamID, ownerID, req.UserID, req.Role); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status, err := batchService.CancelBatch(jobID, userID)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "team member added"})
+		c.JSON(http.StatusOK, status)
 	}
 }
 
-// History Handler
-func HistoryHandler(contentService *services.ContentService) gin.HandlerFunc {
+func RetryBatchHandler(batchService *services.BatchService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.MustGet("user_id").(uuid.UUID)
+		jobID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+			return
+		}
 
-		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
-
-		contents, total, err := contentService.ListContent(userID, limit, offset)
+		status, err := batchService.RetryBatch(jobID, userID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"history": contents,
-			"total":   total,
-		})
+		c.JSON(http.StatusAccepted, status)
+	}
+}
+
+// Generation Queue Handlers
+func GenerationQueueHandler(generationQueue *services.GenerationQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		c.JSON(http.StatusOK, gin.H{"queue": generationQueue.Status(userID)})
 	}
 }
 
@@ -529,3 +3004,62 @@ func UpdateSettingsHandler(authService *services.AuthService) gin.HandlerFunc {
 	}
 }
 
+// appURL is the frontend base URL used to build links sent to users.
+func appURL() string {
+	url := os.Getenv("APP_URL")
+	if url == "" {
+		url = "http://localhost:3000"
+	}
+	return strings.TrimSuffix(url, "/")
+}
+
+// optionalUUIDQuery parses an optional UUID query parameter.
+func optionalUUIDQuery(c *gin.Context, name string) (*uuid.UUID, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// shareUnlockCookie holds the unlock token of a password-protected link.
+// It is scoped to the link's page, and so its comments, so each link has
+// its own.
+const shareUnlockCookie = "share_unlock"
+
+func shareAccess(c *gin.Context) services.ShareAccess {
+	access := services.ShareAccess{
+		Password: c.GetHeader("X-Share-Password"),
+		ClientIP: c.ClientIP(),
+	}
+	if access.Password == "" {
+		access.Password = c.PostForm("password")
+	}
+	access.Unlock, _ = c.Cookie(shareUnlockCookie)
+	return access
+}
+
+func setShareUnlockCookie(c *gin.Context, shareService *services.ShareLinkService, link *models.ShareLink) {
+	if link.PasswordHash == "" {
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(shareUnlockCookie, shareService.UnlockToken(link), int(services.ShareUnlockTTL.Seconds()),
+		c.Request.URL.Path, "", c.Request.TLS != nil, true)
+}
+
+// requestBaseURL is the scheme and host the current request was made to.
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
@@ -12,6 +12,15 @@ func SetupRoutes(
 	contentService *services.ContentService,
 	brandService *services.BrandService,
 	collabService *services.CollaborationService,
+	shareService *services.ShareLinkService,
+	workflowService *services.WorkflowService,
+	activityService *services.ActivityService,
+	webhookService *services.WebhookService,
+	promptService *services.PromptService,
+	longFormService *services.LongFormService,
+	usageService *services.UsageService,
+	generationQueue *services.GenerationQueue,
+	batchService *services.BatchService,
 ) {
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -25,6 +34,14 @@ func SetupRoutes(
 		auth.POST("/login", LoginHandler(authService))
 	}
 
+	// Public share links, readable without an account
+	public := router.Group("/api/public")
+	{
+		public.GET("/share/:token", ViewSharedContentHandler(shareService))
+		public.POST("/share/:token", ViewSharedContentHandler(shareService))
+		public.POST("/share/:token/comments", AddSharedCommentHandler(shareService))
+	}
+
 	// Protected routes
 	protected := router.Group("/api")
 	protected.Use(AuthMiddleware(authService))
@@ -34,11 +51,34 @@ func SetupRoutes(
 		{
 			content.POST("/compose", ComposeHandler(contentService))
 			content.POST("/enhance", EnhanceHandler(contentService))
+			content.POST("/generations/:id/save", SaveVariantHandler(contentService))
+			content.GET("/transform/actions", ListTransformActionsHandler())
+			content.GET("/schemas", ListContentSchemasHandler())
+			content.POST("/transform", TransformHandler(contentService))
 			content.GET("", ListContentHandler(contentService))
 			content.GET("/:id", GetContentHandler(contentService))
 			content.POST("", CreateContentHandler(contentService))
 			content.PUT("/:id", UpdateContentHandler(contentService))
 			content.DELETE("/:id", DeleteContentHandler(contentService))
+			content.GET("/:id/similar", SimilarContentHandler(contentService))
+			content.POST("/:id/transfer", TransferContentHandler(contentService))
+			content.PUT("/:id/folder", MoveContentHandler(contentService))
+			content.PUT("/:id/brand-tone", SetContentBrandToneHandler(contentService))
+			content.GET("/:id/workflow", GetWorkflowHandler(workflowService))
+			content.POST("/:id/reviewers", AssignReviewerHandler(workflowService))
+			content.DELETE("/:id/reviewers/:userId", RemoveReviewerHandler(workflowService))
+			content.POST("/:id/transition", TransitionContentHandler(workflowService))
+			content.POST("/:id/review", ReviewContentHandler(workflowService))
+			content.GET("/:id/activity", ContentActivityHandler(activityService))
+		}
+
+		// Folder routes
+		folders := protected.Group("/folders")
+		{
+			folders.POST("", CreateFolderHandler(contentService))
+			folders.GET("", ListFoldersHandler(contentService))
+			folders.PUT("/:id", RenameFolderHandler(contentService))
+			folders.DELETE("/:id", DeleteFolderHandler(contentService))
 		}
 
 		// Brand tone routes
@@ -46,9 +86,29 @@ func SetupRoutes(
 		{
 			brand.POST("", CreateBrandToneHandler(brandService))
 			brand.GET("", ListBrandTonesHandler(brandService))
+			brand.POST("/learn", LearnBrandToneHandler(brandService))
+			brand.GET("/defaults", ListBrandToneDefaultsHandler(brandService))
+			brand.PUT("/defaults", SetBrandToneDefaultHandler(brandService))
+			brand.DELETE("/defaults", ClearBrandToneDefaultHandler(brandService))
+			brand.GET("/export", ExportBrandTonesHandler(brandService))
+			brand.POST("/import", ImportBrandTonesHandler(brandService))
 			brand.GET("/:id", GetBrandToneHandler(brandService))
 			brand.PUT("/:id", UpdateBrandToneHandler(brandService))
 			brand.DELETE("/:id", DeleteBrandToneHandler(brandService))
+			brand.POST("/:id/analyze", AnalyzeBrandToneHandler(brandService))
+			brand.GET("/:id/versions", ListBrandToneVersionsHandler(brandService))
+			brand.GET("/:id/versions/diff", DiffBrandToneVersionsHandler(brandService))
+			brand.GET("/:id/versions/:version", GetBrandToneVersionHandler(brandService))
+			brand.POST("/:id/versions/:version/rollback", RollbackBrandToneHandler(brandService))
+		}
+
+		// Glossary routes
+		glossary := protected.Group("/glossary")
+		{
+			glossary.POST("", CreateGlossaryTermHandler(brandService))
+			glossary.GET("", ListGlossaryHandler(brandService))
+			glossary.PUT("/:id", UpdateGlossaryTermHandler(brandService))
+			glossary.DELETE("/:id", DeleteGlossaryTermHandler(brandService))
 		}
 
 		// Collaboration routes
@@ -57,11 +117,92 @@ func SetupRoutes(
 			collab.POST("/share", ShareContentHandler(collabService))
 			collab.POST("/comment", AddCommentHandler(collabService))
 			collab.GET("/content/:id", GetCollaborationsHandler(collabService))
+			collab.POST("/share-links", CreateShareLinkHandler(shareService))
+			collab.GET("/content/:id/share-links", ListShareLinksHandler(shareService))
+			collab.DELETE("/share-links/:id", RevokeShareLinkHandler(shareService))
 			collab.POST("/teams", CreateTeamHandler(collabService))
 			collab.GET("/teams", GetUserTeamsHandler(collabService))
+			collab.GET("/teams/:id", GetTeamHandler(collabService))
+			collab.PUT("/teams/:id", RenameTeamHandler(collabService))
+			collab.DELETE("/teams/:id", DeleteTeamHandler(collabService))
+			collab.PUT("/teams/:id/workflow", UpdateWorkflowSettingsHandler(collabService))
+			collab.GET("/teams/:id/activity", TeamActivityHandler(activityService))
 			collab.POST("/teams/:id/members", AddTeamMemberHandler(collabService))
+			collab.PUT("/teams/:id/members/:userId", UpdateTeamMemberRoleHandler(collabService))
+			collab.DELETE("/teams/:id/members/:userId", RemoveTeamMemberHandler(collabService))
+			collab.POST("/teams/:id/leave", LeaveTeamHandler(collabService))
+			collab.POST("/teams/:id/transfer", TransferOwnershipHandler(collabService))
+			collab.POST("/teams/:id/invitations", InviteTeamMemberHandler(collabService))
+			collab.GET("/teams/:id/invitations", ListInvitationsHandler(collabService))
+			collab.DELETE("/teams/:id/invitations/:invitationId", RevokeInvitationHandler(collabService))
+			collab.GET("/teams/:id/roles", ListTeamRolesHandler(collabService))
+			collab.POST("/teams/:id/roles", CreateTeamRoleHandler(collabService))
+			collab.PUT("/teams/:id/roles/:roleId", UpdateTeamRoleHandler(collabService))
+			collab.DELETE("/teams/:id/roles/:roleId", DeleteTeamRoleHandler(collabService))
+			collab.POST("/invitations/:token/accept", AcceptInvitationHandler(collabService))
+		}
+
+		// Webhook routes
+		webhooks := protected.Group("/webhooks")
+		{
+			webhooks.POST("", CreateWebhookHandler(webhookService))
+			webhooks.GET("", ListWebhooksHandler(webhookService))
+			webhooks.PUT("/:id", UpdateWebhookHandler(webhookService))
+			webhooks.DELETE("/:id", DeleteWebhookHandler(webhookService))
+			webhooks.GET("/:id/deliveries", ListWebhookDeliveriesHandler(webhookService))
+			webhooks.POST("/:id/deliveries/:deliveryId/redeliver", RedeliverWebhookHandler(webhookService))
+			webhooks.POST("/:id/ping", PingWebhookHandler(webhookService))
 		}
 
+		// Prompt template routes
+		prompts := protected.Group("/prompts")
+		{
+			prompts.GET("", ListPromptTemplatesHandler(promptService))
+			prompts.POST("/preview", PreviewPromptHandler(promptService))
+			prompts.PUT("/:action", UpdatePromptTemplateHandler(promptService))
+			prompts.DELETE("/:action", ResetPromptTemplateHandler(promptService))
+			prompts.GET("/:action/versions", ListPromptTemplateVersionsHandler(promptService))
+			prompts.POST("/:action/versions/:version/restore", RestorePromptTemplateHandler(promptService))
+		}
+
+		// Long-form document routes
+		longForm := protected.Group("/longform")
+		{
+			longForm.POST("", CreateLongFormHandler(longFormService))
+			longForm.GET("", ListLongFormsHandler(longFormService))
+			longForm.GET("/:id", GetLongFormHandler(longFormService))
+			longForm.PUT("/:id/outline", UpdateOutlineHandler(longFormService))
+			longForm.POST("/:id/generate", GenerateLongFormHandler(longFormService))
+			longForm.GET("/:id/events", LongFormEventsHandler(longFormService))
+			longForm.DELETE("/:id", DeleteLongFormHandler(longFormService))
+		}
+
+		// Usage and quota routes
+		usage := protected.Group("/usage")
+		{
+			usage.GET("", UsageReportHandler(usageService))
+			usage.GET("/quota", QuotaStatusHandler(usageService))
+			usage.GET("/plans", ListPlansHandler(usageService))
+			usage.PUT("/plans/:plan", SetPlanQuotaHandler(usageService))
+			usage.DELETE("/plans/:plan", ResetPlanQuotaHandler(usageService))
+			usage.PUT("/teams/:id/quota", SetTeamQuotaHandler(usageService))
+			usage.DELETE("/teams/:id/quota", RemoveTeamQuotaHandler(usageService))
+			usage.PUT("/users/:id/plan", SetUserPlanHandler(usageService))
+		}
+
+		// Batch job routes
+		batches := protected.Group("/batches")
+		{
+			batches.POST("", CreateBatchHandler(batchService))
+			batches.GET("", ListBatchesHandler(batchService))
+			batches.GET("/:id", GetBatchHandler(batchService))
+			batches.POST("/:id/cancel", CancelBatchHandler(batchService))
+			batches.POST("/:id/retry", RetryBatchHandler(batchService))
+		}
+
+		// Generation queue route
+		protected.GET("/generation/queue", GenerationQueueHandler(generationQueue))
+
 		// History route
 		protected.GET("/history", HistoryHandler(contentService))
 
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+
+	"inscribeai/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+var sharePageTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Content}}{{.Content.Title}}{{else}}Shared content{{end}} · InscribeAI</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 46rem; margin: 3rem auto; padding: 0 1rem; color: #1f2937; line-height: 1.6; }
+.body { white-space: pre-wrap; }
+.meta, .comment small { color: #6b7280; font-size: .875rem; }
+.error { color: #b91c1c; }
+form { display: grid; gap: .5rem; margin-top: 1.5rem; }
+input, textarea, button { font: inherit; padding: .5rem; }
+.comment { border-top: 1px solid #e5e7eb; padding: .75rem 0; }
+</style>
+</head>
+<body>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .NeedsPassword}}
+<form method="post">
+  <label for="password">This document is password protected.</label>
+  <input id="password" name="password" type="password" autofocus>
+  <button type="submit">View</button>
+</form>
+{{else if .Content}}
+<h1>{{.Content.Title}}</h1>
+<p class="meta">{{.Content.ContentType}} · updated {{.Content.UpdatedAt.Format "2 Jan 2006"}}</p>
+<div class="body">{{.Content.Content}}</div>
+{{if eq .Link.Scope "comment"}}
+<h2>Comments</h2>
+{{range .Comments}}<div class="comment"><small>{{.AuthorName}} · {{.CreatedAt.Format "2 Jan 2006 15:04"}}</small><div class="body">{{.Comment}}</div></div>{{end}}
+<form method="post" action="{{.CommentURL}}">
+  <input name="name" placeholder="Your name">
+  <textarea name="comment" rows="4" required></textarea>
+  <button type="submit">Add comment</button>
+</form>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+type sharePageData struct {
+	Link          *models.ShareLink
+	Content       *models.Content
+	Comments      []models.ShareComment
+	CommentURL    string
+	NeedsPassword bool
+	Error         string
+}
+
+func renderSharePage(c *gin.Context, status int, data sharePageData) {
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("X-Robots-Tag", "noindex")
+	if err := sharePageTemplate.Execute(c.Writer, data); err != nil {
+		c.String(http.StatusInternalServerError, "failed to render page")
+	}
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Values older clients stored for the enumerated settings, mapped to the
+// closest allowed value.
+var (
+	legacyFormality = map[string]string{
+		"formal": models.FormalityFormal, "professional": models.FormalityFormal, "business": models.FormalityFormal,
+		"corporate": models.FormalityFormal, "academic": models.FormalityFormal,
+		"neutral": models.FormalityNeutral, "balanced": models.FormalityNeutral, "standard": models.FormalityNeutral,
+		"casual": models.FormalityCasual, "informal": models.FormalityCasual, "friendly": models.FormalityCasual,
+		"conversational": models.FormalityCasual, "playful": models.FormalityCasual,
+	}
+	legacyReadingLevel = map[string]string{
+		"simple": models.ReadingLevelSimple, "easy": models.ReadingLevelSimple, "basic": models.ReadingLevelSimple,
+		"general": models.ReadingLevelGeneral, "intermediate": models.ReadingLevelGeneral, "standard": models.ReadingLevelGeneral,
+		"advanced": models.ReadingLevelAdvanced, "expert": models.ReadingLevelAdvanced,
+		"technical": models.ReadingLevelTechnical,
+	}
+	legacyEmojiPolicy = map[string]string{
+		"none": models.EmojiNone, "no": models.EmojiNone, "never": models.EmojiNone, "false": models.EmojiNone,
+		"sparing": models.EmojiSparing, "some": models.EmojiSparing, "minimal": models.EmojiSparing, "few": models.EmojiSparing,
+		"encouraged": models.EmojiEncouraged, "yes": models.EmojiEncouraged, "lots": models.EmojiEncouraged, "true": models.EmojiEncouraged,
+	}
+)
+
+// migrateBrandToneSettings rewrites settings saved when they were free-form
+// JSON into the BrandToneSettings schema, so every row loads. Known keys and
+// their common spellings are mapped; anything else that is a plain value is
+// kept as a "key: value" note in voice rather than lost. It runs once:
+// settings have only been written in the schema since.
+func migrateBrandToneSettings(db *gorm.DB) error {
+	for _, model := range []interface{}{&models.BrandTone{}, &models.BrandToneVersion{}} {
+		if !db.Migrator().HasTable(model) {
+			continue
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		table := stmt.Schema.Table
+
+		var rows []struct {
+			ID       uuid.UUID
+			Settings *string
+		}
+		if err := db.Table(table).Select("id, CAST(settings AS TEXT) AS settings").Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		rewritten := 0
+		for _, row := range rows {
+			raw := ""
+			if row.Settings != nil {
+				raw = *row.Settings
+			}
+			settings := legacyBrandToneSettings(raw)
+			if current, ok := decodeBrandToneSettings(raw); ok && reflect.DeepEqual(current, settings) {
+				continue
+			}
+			encoded, err := json.Marshal(settings)
+			if err != nil {
+				return err
+			}
+			if err := db.Table(table).Where("id = ?", row.ID).Update("settings", string(encoded)).Error; err != nil {
+				return fmt.Errorf("brand tone %s: %w", row.ID, err)
+			}
+			rewritten++
+		}
+		if rewritten > 0 {
+			log.Printf("Migrated settings of %d rows in %s", rewritten, table)
+		}
+	}
+	return nil
+}
+
+// decodeBrandToneSettings reports whether raw already matches the schema
+// exactly.
+func decodeBrandToneSettings(raw string) (models.BrandToneSettings, bool) {
+	var settings models.BrandToneSettings
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&settings); err != nil {
+		return settings, false
+	}
+	return settings, true
+}
+
+// legacyBrandToneSettings maps stored settings of any shape onto the schema.
+// Settings saved as a JSON string holding an object are unwrapped; any other
+// string is taken as a description of the voice.
+func legacyBrandToneSettings(raw string) models.BrandToneSettings {
+	var settings models.BrandToneSettings
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return settings
+	}
+	if text, ok := value.(string); ok {
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			settings.Voice = strings.TrimSpace(text)
+			return settings
+		}
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return settings
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var voice, notes []string
+	for _, key := range keys {
+		field := fields[key]
+		text := legacyText(field)
+		switch strings.ReplaceAll(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "-", "_"), " ", "_") {
+		case "formality":
+			if settings.Formality = legacyFormality[strings.ToLower(text)]; settings.Formality == "" && text != "" {
+				notes = append(notes, key+": "+text)
+			}
+		case "reading_level", "readinglevel", "reading":
+			if settings.ReadingLevel = legacyReadingLevel[strings.ToLower(text)]; settings.ReadingLevel == "" && text != "" {
+				notes = append(notes, key+": "+text)
+			}
+		case "emoji_policy", "emoji", "emojis":
+			if settings.EmojiPolicy = legacyEmojiPolicy[strings.ToLower(text)]; settings.EmojiPolicy == "" && text != "" {
+				notes = append(notes, key+": "+text)
+			}
+		case "voice", "tone":
+			if text != "" {
+				voice = append(voice, text)
+			}
+		case "target_audience", "audience":
+			settings.TargetAudience = text
+		case "preferred_terms", "preferred":
+			settings.PreferredTerms = legacyList(field)
+		case "banned_terms", "banned", "avoid":
+			settings.BannedTerms = legacyList(field)
+		case "sample_passages", "samples", "examples":
+			if text != "" {
+				settings.SamplePassages = []string{text}
+			} else {
+				settings.SamplePassages = legacyList(field)
+			}
+		default:
+			if text != "" {
+				notes = append(notes, key+": "+text)
+			}
+		}
+	}
+	settings.Voice = strings.Join(append(voice, notes...), "; ")
+
+	settings, _ = settings.Sanitize()
+	return settings
+}
+
+// legacyText renders a plain JSON value as text; objects and arrays give "".
+func legacyText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case bool, float64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// legacyList accepts a list of values or a comma-separated string.
+func legacyList(value interface{}) []string {
+	var items []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if text := legacyText(item); text != "" {
+				items = append(items, text)
+			}
+		}
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
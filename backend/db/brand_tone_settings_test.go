@@ -0,0 +1,113 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"inscribeai/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB opens a private in-memory SQLite database. SQLite cannot use
+// gen_random_uuid() as a column default, so the default is dropped; the
+// models set their IDs in BeforeCreate anyway.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	database, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	for _, model := range Models {
+		stmt := &gorm.Statement{DB: database}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("parse %T: %v", model, err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DefaultValue == "gen_random_uuid()" {
+				field.DefaultValue, field.DefaultValueInterface, field.HasDefaultValue = "", nil, false
+			}
+		}
+	}
+	return database
+}
+
+func TestLegacyBrandToneSettings(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want models.BrandToneSettings
+	}{
+		{`{"formality":"Professional","emoji":"never","audience":"developers"}`, models.BrandToneSettings{
+			Formality: models.FormalityFormal, EmojiPolicy: models.EmojiNone, TargetAudience: "developers",
+		}},
+		{`{"tone":"warm","banned":"synergy, leverage","humour":"dry"}`, models.BrandToneSettings{
+			Voice: "warm; humour: dry", BannedTerms: []string{"synergy", "leverage"},
+		}},
+		{`"{\"reading_level\":\"expert\"}"`, models.BrandToneSettings{ReadingLevel: models.ReadingLevelAdvanced}},
+		{`"Plain and friendly"`, models.BrandToneSettings{Voice: "Plain and friendly"}},
+		{`null`, models.BrandToneSettings{}},
+	}
+	for _, tt := range tests {
+		if got := legacyBrandToneSettings(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("legacyBrandToneSettings(%s) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestBrandToneSettingsMigrateOnce(t *testing.T) {
+	database := openTestDB(t)
+	if err := database.AutoMigrate(Models...); err != nil {
+		t.Fatalf("create tables: %v", err)
+	}
+
+	user := &models.User{Email: "alice@example.com", Name: "alice", Password: "unused"}
+	if err := database.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	insertTone := func(settings string) uuid.UUID {
+		id := uuid.New()
+		if err := database.Exec("INSERT INTO brand_tones (id, user_id, name, settings, version) VALUES (?, ?, ?, ?, 0)",
+			id, user.ID, "Legacy", settings).Error; err != nil {
+			t.Fatalf("insert tone: %v", err)
+		}
+		return id
+	}
+	storedSettings := func(id uuid.UUID) string {
+		var settings string
+		database.Raw("SELECT CAST(settings AS TEXT) FROM brand_tones WHERE id = ?", id).Scan(&settings)
+		return settings
+	}
+
+	legacy := insertTone(`{"formality":"casual","vibe":"upbeat"}`)
+	if err := Migrate(database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var tone models.BrandTone
+	if err := database.First(&tone, legacy).Error; err != nil {
+		t.Fatalf("load tone: %v", err)
+	}
+	if tone.Settings.Formality != models.FormalityCasual || tone.Settings.Voice != "vibe: upbeat" {
+		t.Errorf("migrated settings %+v", tone.Settings)
+	}
+
+	// Later starts leave the table alone
+	late := insertTone(`{"vibe":"calm"}`)
+	if err := Migrate(database); err != nil {
+		t.Fatalf("migrate again: %v", err)
+	}
+	if got := storedSettings(late); got != `{"vibe":"calm"}` {
+		t.Errorf("second start rewrote settings to %s", got)
+	}
+}
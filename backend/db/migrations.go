@@ -0,0 +1,36 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// appliedMigration records a one-time data migration that has run, so it
+// is not repeated on every start.
+type appliedMigration struct {
+	Name      string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// runOnce runs migrate unless a migration called name has already been
+// applied, and records it in the same transaction.
+func runOnce(db *gorm.DB, name string, migrate func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&appliedMigration{}).Where("name = ?", name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		if err := migrate(tx); err != nil {
+			return err
+		}
+		return tx.Create(&appliedMigration{Name: name, AppliedAt: time.Now()}).Error
+	})
+}
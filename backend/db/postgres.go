@@ -14,6 +14,36 @@ import (
 
 var DB *gorm.DB
 
+// Models lists every model Migrate creates tables for.
+var Models = []interface{}{
+	&models.User{},
+	&models.Content{},
+	&models.Folder{},
+	&models.BrandTone{},
+	&models.BrandToneVersion{},
+	&models.BrandToneDefault{},
+	&models.Collaboration{},
+	&models.Team{},
+	&models.TeamMember{},
+	&models.TeamInvitation{},
+	&models.TeamRole{},
+	&models.ShareLink{},
+	&models.ShareComment{},
+	&models.ReviewAssignment{},
+	&models.WorkflowTransition{},
+	&models.ActivityEvent{},
+	&models.Webhook{},
+	&models.WebhookDelivery{},
+	&models.GlossaryTerm{},
+	&models.PromptTemplate{},
+	&models.LongFormDocument{},
+	&models.ContentChunk{},
+	&models.UsageRecord{},
+	&models.UsageQuota{},
+	&models.BatchJob{},
+	&models.BatchItem{},
+}
+
 func Initialize() (*gorm.DB, error) {
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
@@ -31,16 +61,8 @@ func Initialize() (*gorm.DB, error) {
 
 	log.Println("Database connection established")
 
-	// Auto-migrate models
-	if err := DB.AutoMigrate(
-		&models.User{},
-		&models.Content{},
-		&models.BrandTone{},
-		&models.Collaboration{},
-		&models.Team{},
-		&models.TeamMember{},
-	); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	if err := Migrate(DB); err != nil {
+		return nil, err
 	}
 
 	log.Println("Database migration completed")
@@ -48,3 +70,70 @@ func Initialize() (*gorm.DB, error) {
 	return DB, nil
 }
 
+// Migrate brings the schema up to date, first fixing existing data that
+// would stop the new schema from applying, then converting data the models
+// can no longer read.
+func Migrate(db *gorm.DB) error {
+	if err := dedupeTeamMembers(db); err != nil {
+		return fmt.Errorf("failed to remove duplicate team members: %w", err)
+	}
+
+	// Auto-migrate models
+	if err := db.AutoMigrate(append(Models, &appliedMigration{})...); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	if err := repairBrandToneVersions(db); err != nil {
+		return fmt.Errorf("failed to repair brand tone versions: %w", err)
+	}
+	if err := runOnce(db, "brand_tone_settings_schema", migrateBrandToneSettings); err != nil {
+		return fmt.Errorf("failed to migrate brand tone settings: %w", err)
+	}
+	return nil
+}
+
+// repairBrandToneVersions points tones that have versions but still record
+// version 0 at their latest version. Tones created before the version was
+// saved on create were left like this, and editing them would otherwise
+// snapshot version 1 a second time.
+func repairBrandToneVersions(db *gorm.DB) error {
+	result := db.Exec(`UPDATE brand_tones SET version = (
+		SELECT MAX(v.version) FROM brand_tone_versions v WHERE v.brand_tone_id = brand_tones.id
+	)
+	WHERE version = 0 AND EXISTS (
+		SELECT 1 FROM brand_tone_versions v WHERE v.brand_tone_id = brand_tones.id
+	)`)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Repaired the version of %d brand tones", result.RowsAffected)
+	}
+	return nil
+}
+
+// dedupeTeamMembers removes duplicate memberships, which older versions
+// could create and which the unique index on team and user rejects. The
+// most privileged, then the oldest, membership of each pair is kept.
+func dedupeTeamMembers(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.TeamMember{}) {
+		return nil
+	}
+	result := db.Exec(`DELETE FROM team_members WHERE id IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (
+				PARTITION BY team_id, user_id
+				ORDER BY CASE role WHEN ? THEN 0 WHEN ? THEN 1 ELSE 2 END, created_at, id
+			) AS n
+			FROM team_members
+		) ranked
+		WHERE n > 1
+	)`, models.RoleOwner, models.RoleAdmin)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed %d duplicate team memberships", result.RowsAffected)
+	}
+	return nil
+}
@@ -19,6 +19,12 @@ func main() {
 		log.Println("No .env file found, using environment variables")
 	}
 
+	// Tokens signed with a guessable secret could be forged
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		log.Fatal("JWT_SECRET environment variable is not set")
+	}
+
 	// Initialize database
 	database, err := db.Initialize()
 	if err != nil {
@@ -27,11 +33,26 @@ func main() {
 
 	// Initialize services
 	cacheService := services.NewCacheService()
-	aiService := services.NewAIService(cacheService)
+	policyService := services.NewPolicyService(database)
+	activityService := services.NewActivityService(database, policyService)
+	promptService := services.NewPromptService(database, policyService)
+	usageService := services.NewUsageService(database, policyService)
+	generationQueue := services.NewGenerationQueueFromEnv()
+	aiService := services.NewAIService(cacheService, promptService, usageService, generationQueue)
 	authService := services.NewAuthService(database)
-	contentService := services.NewContentService(database, aiService, cacheService)
-	brandService := services.NewBrandService(database)
-	collabService := services.NewCollaborationService(database)
+	retrievalService := services.NewRetrievalService(database, policyService, services.NewEmbedderFromEnv())
+	activityService.AddListener(retrievalService)
+	retrievalService.Start()
+	contentService := services.NewContentService(database, aiService, cacheService, policyService, activityService, retrievalService)
+	brandService := services.NewBrandService(database, aiService, policyService, activityService)
+	collabService := services.NewCollaborationService(database, policyService, activityService)
+	shareService := services.NewShareLinkService(database, policyService, activityService, jwtSecret)
+	workflowService := services.NewWorkflowService(database, policyService, activityService)
+	webhookService := services.NewWebhookService(database, policyService)
+	longFormService := services.NewLongFormService(database, contentService)
+	batchService := services.NewBatchService(database, contentService)
+	activityService.AddListener(webhookService)
+	webhookService.Start()
 
 	// Setup router
 	router := gin.Default()
@@ -41,11 +62,11 @@ func main() {
 	config.AllowOrigins = []string{"http://localhost:3000"}
 	config.AllowCredentials = true
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "X-Share-Password"}
 	router.Use(cors.New(config))
 
 	// Setup routes
-	api.SetupRoutes(router, authService, contentService, brandService, collabService)
+	api.SetupRoutes(router, authService, contentService, brandService, collabService, shareService, workflowService, activityService, webhookService, promptService, longFormService, usageService, generationQueue, batchService)
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -58,4 +79,3 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
-
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ActivityEvent is an entry in the activity log. Events deliberately have no
+// foreign keys to their objects so they outlive deleted content.
+type ActivityEvent struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ActorID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"actor_id"`
+	Verb       string     `gorm:"not null;index" json:"verb"` // e.g. content.updated, team.member_added
+	ObjectType string     `gorm:"not null" json:"object_type"`
+	ObjectID   *uuid.UUID `gorm:"type:uuid" json:"object_id,omitempty"`
+	ContentID  *uuid.UUID `gorm:"type:uuid;index" json:"content_id,omitempty"`
+	TeamID     *uuid.UUID `gorm:"type:uuid;index" json:"team_id,omitempty"`
+	Summary    string     `gorm:"type:text" json:"summary,omitempty"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+	Actor      User       `gorm:"foreignKey:ActorID" json:"actor,omitempty"`
+}
+
+func (ae *ActivityEvent) BeforeCreate(tx *gorm.DB) error {
+	if ae.ID == uuid.Nil {
+		ae.ID = uuid.New()
+	}
+	return nil
+}
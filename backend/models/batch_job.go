@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Batch job statuses.
+const (
+	BatchRunning   = "running"
+	BatchCompleted = "completed" // every item succeeded or failed
+	BatchCancelled = "cancelled"
+)
+
+// Batch item statuses.
+const (
+	BatchItemPending   = "pending"
+	BatchItemRunning   = "running"
+	BatchItemSucceeded = "succeeded"
+	BatchItemFailed    = "failed" // retrying the job runs it again
+	BatchItemCancelled = "cancelled"
+)
+
+// BatchJob generates content from a list of prompts in the background. The
+// options are shared by every item and the brand tone is pinned when the
+// job is created.
+type BatchJob struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	TeamID           *uuid.UUID `gorm:"type:uuid;index" json:"team_id"`
+	FolderID         *uuid.UUID `gorm:"type:uuid" json:"folder_id"`
+	Name             string     `json:"name"`
+	ContentType      string     `json:"content_type"`
+	BrandToneID      *uuid.UUID `gorm:"type:uuid" json:"brand_tone_id"`
+	BrandToneVersion *int       `json:"brand_tone_version"`
+	AutoCorrect      bool       `json:"auto_correct"`
+	Structured       bool       `json:"structured"`
+	Platforms        []string   `gorm:"type:jsonb;serializer:json" json:"platforms"`
+	RetrieveTopK     int        `json:"retrieve_top_k"`
+	Status           string     `gorm:"not null;index" json:"status"`
+	Total            int        `gorm:"not null" json:"total"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	FinishedAt       *time.Time `json:"finished_at"`
+	User             User       `gorm:"foreignKey:UserID" json:"-"`
+	Team             *Team      `gorm:"foreignKey:TeamID" json:"-"`
+}
+
+func (j *BatchJob) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	return nil
+}
+
+// BatchItem is one prompt of a batch job. Each successful item is saved as
+// a draft content item, referenced by ContentID.
+type BatchItem struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	JobID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"job_id"`
+	Position  int        `gorm:"not null" json:"position"`
+	Title     string     `json:"title"`
+	Prompt    string     `gorm:"type:text;not null" json:"prompt"`
+	Status    string     `gorm:"not null;index" json:"status"`
+	Error     string     `json:"error,omitempty"`
+	Attempts  int        `json:"attempts"`
+	ContentID *uuid.UUID `gorm:"type:uuid" json:"content_id"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Job       BatchJob   `gorm:"foreignKey:JobID" json:"-"`
+}
+
+func (i *BatchItem) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
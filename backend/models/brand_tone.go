@@ -1,23 +1,60 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Formality levels for BrandToneSettings.
+const (
+	FormalityFormal  = "formal"
+	FormalityNeutral = "neutral"
+	FormalityCasual  = "casual"
+)
+
+// Reading levels for BrandToneSettings.
+const (
+	ReadingLevelSimple    = "simple"
+	ReadingLevelGeneral   = "general"
+	ReadingLevelAdvanced  = "advanced"
+	ReadingLevelTechnical = "technical"
+)
+
+// Emoji policies for BrandToneSettings.
+const (
+	EmojiNone       = "none"
+	EmojiSparing    = "sparing"
+	EmojiEncouraged = "encouraged"
+)
+
 type BrandTone struct {
-	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
-	TeamID      *uuid.UUID `gorm:"type:uuid;index" json:"team_id"`
-	Name        string    `json:"name"`
-	Description string    `gorm:"type:text" json:"description"`
-	Settings    string    `gorm:"type:jsonb" json:"settings"` // JSON string for tone settings
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	User        User      `gorm:"foreignKey:UserID" json:"-"`
-	Team        *Team     `gorm:"foreignKey:TeamID" json:"team,omitempty"`
+	ID          uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID         `gorm:"type:uuid;not null;index" json:"user_id"`
+	TeamID      *uuid.UUID        `gorm:"type:uuid;index" json:"team_id"`
+	Name        string            `json:"name"`
+	Description string            `gorm:"type:text" json:"description"`
+	Settings    BrandToneSettings `gorm:"type:jsonb;serializer:json" json:"settings"`
+	Version     int               `gorm:"not null;default:0" json:"version"` // current version, 0 for tones created before versioning
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	User        User              `gorm:"foreignKey:UserID" json:"-"`
+	Team        *Team             `gorm:"foreignKey:TeamID" json:"team,omitempty"`
+}
+
+// BrandToneSettings is the structured part of a brand tone. Every field is
+// optional; empty fields add nothing to the prompt.
+type BrandToneSettings struct {
+	Formality      string   `json:"formality,omitempty" yaml:"formality,omitempty"`         // formal, neutral, casual
+	Voice          string   `json:"voice,omitempty" yaml:"voice,omitempty"`                 // e.g. "confident, warm, direct"
+	ReadingLevel   string   `json:"reading_level,omitempty" yaml:"reading_level,omitempty"` // simple, general, advanced, technical
+	EmojiPolicy    string   `json:"emoji_policy,omitempty" yaml:"emoji_policy,omitempty"`   // none, sparing, encouraged
+	TargetAudience string   `json:"target_audience,omitempty" yaml:"target_audience,omitempty"`
+	PreferredTerms []string `json:"preferred_terms,omitempty" yaml:"preferred_terms,omitempty"`
+	BannedTerms    []string `json:"banned_terms,omitempty" yaml:"banned_terms,omitempty"`
+	SamplePassages []string `json:"sample_passages,omitempty" yaml:"sample_passages,omitempty"`
 }
 
 func (b *BrandTone) BeforeCreate(tx *gorm.DB) error {
@@ -27,3 +64,32 @@ func (b *BrandTone) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// AfterFind checks settings stored before they were validated, so a bad
+// value never reaches a prompt.
+func (b *BrandTone) AfterFind(tx *gorm.DB) error {
+	b.Settings, _ = b.Settings.Sanitize()
+	return nil
+}
+
+// Sanitize normalizes the enumerated fields and clears values outside their
+// allowed set, returning the names of the fields it cleared.
+func (s BrandToneSettings) Sanitize() (BrandToneSettings, []string) {
+	var cleared []string
+	check := func(field string, value *string, allowed ...string) {
+		*value = strings.ToLower(strings.TrimSpace(*value))
+		if *value == "" {
+			return
+		}
+		for _, a := range allowed {
+			if *value == a {
+				return
+			}
+		}
+		*value = ""
+		cleared = append(cleared, field)
+	}
+	check("formality", &s.Formality, FormalityFormal, FormalityNeutral, FormalityCasual)
+	check("reading_level", &s.ReadingLevel, ReadingLevelSimple, ReadingLevelGeneral, ReadingLevelAdvanced, ReadingLevelTechnical)
+	check("emoji_policy", &s.EmojiPolicy, EmojiNone, EmojiSparing, EmojiEncouraged)
+	return s, cleared
+}
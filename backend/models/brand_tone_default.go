@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BrandToneDefault picks the brand tone used when a generation request names
+// none. It belongs to either a user or a team; an empty ContentType applies
+// to every type, otherwise it overrides the default for that type.
+type BrandToneDefault struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	TeamID      *uuid.UUID `gorm:"type:uuid;index" json:"team_id,omitempty"`
+	ContentType string     `gorm:"not null;default:''" json:"content_type"`
+	BrandToneID uuid.UUID  `gorm:"type:uuid;not null;index" json:"brand_tone_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	BrandTone   BrandTone  `gorm:"foreignKey:BrandToneID" json:"brand_tone,omitempty"`
+}
+
+func (btd *BrandToneDefault) BeforeCreate(tx *gorm.DB) error {
+	if btd.ID == uuid.Nil {
+		btd.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BrandToneVersion is an immutable snapshot of a brand tone, written each
+// time the tone changes.
+type BrandToneVersion struct {
+	ID          uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	BrandToneID uuid.UUID         `gorm:"type:uuid;not null;uniqueIndex:idx_brand_tone_versions_tone_version" json:"brand_tone_id"`
+	Version     int               `gorm:"not null;uniqueIndex:idx_brand_tone_versions_tone_version" json:"version"`
+	Name        string            `json:"name"`
+	Description string            `gorm:"type:text" json:"description"`
+	Settings    BrandToneSettings `gorm:"type:jsonb;serializer:json" json:"settings"`
+	CreatedBy   uuid.UUID         `gorm:"type:uuid;not null" json:"created_by"`
+	Note        string            `json:"note,omitempty"` // e.g. "rolled back to version 2"
+	CreatedAt   time.Time         `json:"created_at"`
+	BrandTone   BrandTone         `gorm:"foreignKey:BrandToneID" json:"-"`
+}
+
+func (btv *BrandToneVersion) BeforeCreate(tx *gorm.DB) error {
+	if btv.ID == uuid.Nil {
+		btv.ID = uuid.New()
+	}
+	return nil
+}
+
+func (btv *BrandToneVersion) AfterFind(tx *gorm.DB) error {
+	btv.Settings, _ = btv.Settings.Sanitize()
+	return nil
+}
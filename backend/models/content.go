@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,16 +9,23 @@ import (
 )
 
 type Content struct {
-	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
-	Title       string    `json:"title"`
-	Content     string    `gorm:"type:text" json:"content"`
-	ContentType string    `json:"content_type"` // email, blog, doc
-	BrandToneID *uuid.UUID `gorm:"type:uuid;index" json:"brand_tone_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	User        User      `gorm:"foreignKey:UserID" json:"-"`
-	BrandTone   *BrandTone `gorm:"foreignKey:BrandToneID" json:"brand_tone,omitempty"`
+	ID               uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID           uuid.UUID       `gorm:"type:uuid;not null;index" json:"user_id"`
+	Title            string          `json:"title"`
+	Content          string          `gorm:"type:text" json:"content"`
+	ContentType      string          `json:"content_type"`                           // email, blog, social, doc
+	Structured       json.RawMessage `gorm:"type:jsonb" json:"structured,omitempty"` // typed fields for email, blog and social content
+	BrandToneID      *uuid.UUID      `gorm:"type:uuid;index" json:"brand_tone_id"`
+	BrandToneVersion *int            `json:"brand_tone_version"`             // brand tone version the content was generated with
+	TeamID           *uuid.UUID      `gorm:"type:uuid;index" json:"team_id"` // set when the content lives in a team workspace
+	FolderID         *uuid.UUID      `gorm:"type:uuid;index" json:"folder_id"`
+	Status           string          `gorm:"not null;default:draft;index" json:"status"` // draft, in_review, changes_requested, approved, published
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	User             User            `gorm:"foreignKey:UserID" json:"-"`
+	BrandTone        *BrandTone      `gorm:"foreignKey:BrandToneID" json:"brand_tone,omitempty"`
+	Team             *Team           `gorm:"foreignKey:TeamID" json:"-"`
+	Folder           *Folder         `gorm:"foreignKey:FolderID" json:"-"`
 }
 
 func (c *Content) BeforeCreate(tx *gorm.DB) error {
@@ -26,4 +34,3 @@ func (c *Content) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
-
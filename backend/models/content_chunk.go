@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ContentChunk is a passage of a content item with its embedding, used to
+// retrieve related passages. Access follows the content item.
+type ContentChunk struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ContentID uuid.UUID `gorm:"type:uuid;not null;index" json:"content_id"`
+	Position  int       `gorm:"not null" json:"position"`
+	Text      string    `gorm:"type:text;not null" json:"text"`
+	Model     string    `gorm:"not null;index" json:"model"` // embedder that produced Embedding
+	Embedding []float32 `gorm:"type:jsonb;serializer:json" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	Content   Content   `gorm:"foreignKey:ContentID" json:"-"`
+}
+
+func (c *ContentChunk) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Folder groups content. Folders in a team workspace inherit the team's
+// permissions; personal folders are only visible to their creator.
+type Folder struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	TeamID    *uuid.UUID `gorm:"type:uuid;index" json:"team_id"`
+	ParentID  *uuid.UUID `gorm:"type:uuid;index" json:"parent_id"`
+	Name      string     `gorm:"not null" json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	User      User       `gorm:"foreignKey:UserID" json:"-"`
+	Team      *Team      `gorm:"foreignKey:TeamID" json:"-"`
+	Parent    *Folder    `gorm:"foreignKey:ParentID" json:"-"`
+}
+
+func (f *Folder) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GlossaryTerm is a terminology rule attached to a brand tone or a team. A
+// term with a PreferredForm is enforced by rewriting its forbidden variants
+// and miscapitalisations; without one, the variants are forbidden outright
+// (e.g. claims legal has ruled out) and can only be flagged.
+type GlossaryTerm struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	BrandToneID       *uuid.UUID `gorm:"type:uuid;index" json:"brand_tone_id,omitempty"`
+	TeamID            *uuid.UUID `gorm:"type:uuid;index" json:"team_id,omitempty"`
+	CreatedBy         uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+	Term              string     `gorm:"not null" json:"term"`
+	PreferredForm     string     `json:"preferred_form"`
+	ForbiddenVariants []string   `gorm:"type:jsonb;serializer:json" json:"forbidden_variants"`
+	Notes             string     `gorm:"type:text" json:"notes"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	BrandTone         *BrandTone `gorm:"foreignKey:BrandToneID" json:"-"`
+	Team              *Team      `gorm:"foreignKey:TeamID" json:"-"`
+}
+
+func (gt *GlossaryTerm) BeforeCreate(tx *gorm.DB) error {
+	if gt.ID == uuid.Nil {
+		gt.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Long-form document statuses.
+const (
+	LongFormOutlined   = "outlined" // outline ready for review and editing
+	LongFormGenerating = "generating"
+	LongFormFailed     = "failed" // generating again resumes at the failed step
+	LongFormCompleted  = "completed"
+)
+
+// OutlineSection is one planned section of a long-form document. Text is
+// set once the section has been written.
+type OutlineSection struct {
+	Heading string `json:"heading"`
+	Notes   string `json:"notes"`
+	Text    string `json:"text,omitempty"`
+}
+
+// LongFormDocument is a document generated section by section from an
+// outline. The finished document is saved as Content.
+type LongFormDocument struct {
+	ID               uuid.UUID        `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID           uuid.UUID        `gorm:"type:uuid;not null;index" json:"user_id"`
+	TeamID           *uuid.UUID       `gorm:"type:uuid;index" json:"team_id"`
+	FolderID         *uuid.UUID       `gorm:"type:uuid" json:"folder_id"`
+	Title            string           `gorm:"not null" json:"title"`
+	Brief            string           `gorm:"type:text" json:"brief"`
+	ContentType      string           `json:"content_type"`
+	BrandToneID      *uuid.UUID       `gorm:"type:uuid" json:"brand_tone_id"`
+	BrandToneVersion *int             `json:"brand_tone_version"`
+	AutoCorrect      bool             `json:"auto_correct"`
+	Outline          []OutlineSection `gorm:"type:jsonb;serializer:json" json:"outline"`
+	Status           string           `gorm:"not null;index" json:"status"`
+	Error            string           `json:"error,omitempty"`
+	ContentID        *uuid.UUID       `gorm:"type:uuid" json:"content_id"` // the assembled document
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	User             User             `gorm:"foreignKey:UserID" json:"-"`
+	Team             *Team            `gorm:"foreignKey:TeamID" json:"-"`
+}
+
+func (d *LongFormDocument) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
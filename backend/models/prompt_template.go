@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PromptTemplate is one immutable version of the prompt for an AI action,
+// either global (TeamID nil) or a team's override. The highest version is
+// current; an empty Body means the scope inherits the next template down.
+type PromptTemplate struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Action    string     `gorm:"not null;index:idx_prompt_template_scope" json:"action"`
+	TeamID    *uuid.UUID `gorm:"type:uuid;index:idx_prompt_template_scope" json:"team_id"`
+	Version   int        `gorm:"not null" json:"version"`
+	Body      string     `gorm:"type:text" json:"body"`
+	Note      string     `json:"note"`
+	CreatedBy uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (p *PromptTemplate) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
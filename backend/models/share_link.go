@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ShareLink grants read-only access to a content item to anyone holding the
+// signed link, without an InscribeAI account.
+type ShareLink struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ContentID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"content_id"`
+	CreatedBy      uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+	Scope          string     `gorm:"not null" json:"scope"` // view, comment
+	PasswordHash   string     `json:"-"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	AccessCount    int64      `gorm:"not null;default:0" json:"access_count"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Content        Content    `gorm:"foreignKey:ContentID" json:"-"`
+}
+
+func (sl *ShareLink) BeforeCreate(tx *gorm.DB) error {
+	if sl.ID == uuid.Nil {
+		sl.ID = uuid.New()
+	}
+	return nil
+}
+
+// ShareComment is a comment left by a guest through a comment-scoped link.
+type ShareComment struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ShareLinkID uuid.UUID `gorm:"type:uuid;not null;index" json:"share_link_id"`
+	ContentID   uuid.UUID `gorm:"type:uuid;not null;index" json:"content_id"`
+	AuthorName  string    `json:"author_name"`
+	Comment     string    `gorm:"type:text" json:"comment"`
+	CreatedAt   time.Time `json:"created_at"`
+	ShareLink   ShareLink `gorm:"foreignKey:ShareLinkID" json:"-"`
+}
+
+func (sc *ShareComment) BeforeCreate(tx *gorm.DB) error {
+	if sc.ID == uuid.Nil {
+		sc.ID = uuid.New()
+	}
+	return nil
+}
@@ -7,14 +7,22 @@ import (
 	"gorm.io/gorm"
 )
 
+// Team roles, from most to least privileged.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
 type Team struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Name      string    `json:"name"`
-	OwnerID   uuid.UUID `gorm:"type:uuid;not null;index" json:"owner_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Owner     User      `gorm:"foreignKey:OwnerID" json:"-"`
-	Members   []TeamMember `gorm:"foreignKey:TeamID" json:"members,omitempty"`
+	ID                uuid.UUID    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name              string       `json:"name"`
+	OwnerID           uuid.UUID    `gorm:"type:uuid;not null;index" json:"owner_id"`
+	RequiredApprovals int          `gorm:"not null;default:1" json:"required_approvals"` // approvals needed before publishing, 0 skips review
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	Owner             User         `gorm:"foreignKey:OwnerID" json:"-"`
+	Members           []TeamMember `gorm:"foreignKey:TeamID" json:"members,omitempty"`
 }
 
 func (t *Team) BeforeCreate(tx *gorm.DB) error {
@@ -26,8 +34,8 @@ func (t *Team) BeforeCreate(tx *gorm.DB) error {
 
 type TeamMember struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	TeamID    uuid.UUID `gorm:"type:uuid;not null;index" json:"team_id"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	TeamID    uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_team_members_team_user" json:"team_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_team_members_team_user" json:"user_id"`
 	Role      string    `json:"role"` // owner, admin, member
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -42,3 +50,24 @@ func (tm *TeamMember) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// TeamInvitation is a pending invite sent to an email address. Only a hash of
+// the accept token is stored; the raw token is returned once on creation.
+type TeamInvitation struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TeamID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"team_id"`
+	Email      string     `gorm:"not null;index" json:"email"`
+	Role       string     `json:"role"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	InvitedBy  uuid.UUID  `gorm:"type:uuid;not null" json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Team       Team       `gorm:"foreignKey:TeamID" json:"-"`
+}
+
+func (ti *TeamInvitation) BeforeCreate(tx *gorm.DB) error {
+	if ti.ID == uuid.Nil {
+		ti.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TeamRole is a custom role defined by a team in addition to the built-in
+// owner, admin and member roles.
+type TeamRole struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TeamID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_team_roles_team_name" json:"team_id"`
+	Name        string    `gorm:"not null;uniqueIndex:idx_team_roles_team_name" json:"name"`
+	Permissions []string  `gorm:"type:jsonb;serializer:json" json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Team        Team      `gorm:"foreignKey:TeamID" json:"-"`
+}
+
+func (tr *TeamRole) BeforeCreate(tx *gorm.DB) error {
+	if tr.ID == uuid.Nil {
+		tr.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UsageRecord is one model call, or an answer served from the cache
+// instead. Token counts are estimates. A reserved record is a call still in
+// flight, counted at its largest likely size until it is settled.
+type UsageRecord struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID           uuid.UUID  `gorm:"type:uuid;not null;index:idx_usage_user_created" json:"user_id"`
+	TeamID           *uuid.UUID `gorm:"type:uuid;index:idx_usage_team_created" json:"team_id"` // set for generations in a team workspace
+	Action           string     `gorm:"not null" json:"action"`
+	PromptTokens     int        `json:"prompt_tokens"`
+	CompletionTokens int        `json:"completion_tokens"`
+	LatencyMs        int64      `json:"latency_ms"`
+	CacheHit         bool       `json:"cache_hit"`
+	Failed           bool       `json:"failed"`
+	Reserved         bool       `gorm:"not null;default:false" json:"-"`
+	CreatedAt        time.Time  `gorm:"index:idx_usage_user_created;index:idx_usage_team_created" json:"created_at"`
+}
+
+func (u *UsageRecord) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	return nil
+}
+
+// UsageQuota overrides the built-in limits of a plan (Plan set) or gives a
+// team workspace its own limits (TeamID set). Zero means unlimited.
+type UsageQuota struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Plan            string     `gorm:"index" json:"plan,omitempty"`
+	TeamID          *uuid.UUID `gorm:"type:uuid;uniqueIndex" json:"team_id,omitempty"`
+	DailyRequests   int        `json:"daily_requests"`
+	MonthlyRequests int        `json:"monthly_requests"`
+	DailyTokens     int        `json:"daily_tokens"`
+	MonthlyTokens   int        `json:"monthly_tokens"`
+	UpdatedBy       uuid.UUID  `gorm:"type:uuid;not null" json:"updated_by"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (q *UsageQuota) BeforeCreate(tx *gorm.DB) error {
+	if q.ID == uuid.Nil {
+		q.ID = uuid.New()
+	}
+	return nil
+}
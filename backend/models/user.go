@@ -12,6 +12,7 @@ type User struct {
 	Email     string    `gorm:"uniqueIndex;not null" json:"email"`
 	Password  string    `gorm:"not null" json:"-"`
 	Name      string    `json:"name"`
+	Plan      string    `gorm:"not null;default:free" json:"plan"` // usage plan: free, pro or enterprise
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is an outbound subscription owned by a user or a team. An empty
+// Events list subscribes to every event.
+type Webhook struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	TeamID    *uuid.UUID `gorm:"type:uuid;index" json:"team_id"`
+	URL       string     `gorm:"not null" json:"url"`
+	Secret    string     `gorm:"not null" json:"-"`
+	Events    []string   `gorm:"type:jsonb;serializer:json" json:"events"`
+	Active    bool       `gorm:"not null;default:true" json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	User      User       `gorm:"foreignKey:UserID" json:"-"`
+	Team      *Team      `gorm:"foreignKey:TeamID" json:"-"`
+}
+
+func (w *Webhook) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+// WebhookDelivery is one queued or attempted delivery of an event.
+type WebhookDelivery struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	WebhookID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"webhook_id"`
+	Event          string     `gorm:"not null" json:"event"`
+	Payload        string     `gorm:"type:text" json:"payload"`
+	Status         string     `gorm:"not null;default:pending;index" json:"status"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"index" json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ResponseBody   string     `gorm:"type:text" json:"response_body,omitempty"`
+	Error          string     `gorm:"type:text" json:"error,omitempty"`
+	DurationMs     int64      `json:"duration_ms"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Webhook        Webhook    `gorm:"foreignKey:WebhookID" json:"-"`
+}
+
+func (wd *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if wd.ID == uuid.Nil {
+		wd.ID = uuid.New()
+	}
+	return nil
+}
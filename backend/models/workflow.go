@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Content workflow statuses.
+const (
+	StatusDraft            = "draft"
+	StatusInReview         = "in_review"
+	StatusChangesRequested = "changes_requested"
+	StatusApproved         = "approved"
+	StatusPublished        = "published"
+)
+
+// Review decisions.
+const (
+	DecisionPending          = "pending"
+	DecisionApproved         = "approved"
+	DecisionChangesRequested = "changes_requested"
+)
+
+// ReviewAssignment is a reviewer assigned to a content item. Decisions are
+// reset to pending each time the content is resubmitted.
+type ReviewAssignment struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ContentID  uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_review_assignments_content_reviewer" json:"content_id"`
+	ReviewerID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_review_assignments_content_reviewer" json:"reviewer_id"`
+	AssignedBy uuid.UUID  `gorm:"type:uuid;not null" json:"assigned_by"`
+	Decision   string     `gorm:"not null;default:pending" json:"decision"`
+	Comment    string     `gorm:"type:text" json:"comment,omitempty"`
+	DecidedAt  *time.Time `json:"decided_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Content    Content    `gorm:"foreignKey:ContentID" json:"-"`
+	Reviewer   User       `gorm:"foreignKey:ReviewerID" json:"reviewer,omitempty"`
+}
+
+func (ra *ReviewAssignment) BeforeCreate(tx *gorm.DB) error {
+	if ra.ID == uuid.Nil {
+		ra.ID = uuid.New()
+	}
+	return nil
+}
+
+// WorkflowTransition records each status change of a content item.
+type WorkflowTransition struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ContentID  uuid.UUID `gorm:"type:uuid;not null;index" json:"content_id"`
+	ActorID    uuid.UUID `gorm:"type:uuid;not null" json:"actor_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Comment    string    `gorm:"type:text" json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	Content    Content   `gorm:"foreignKey:ContentID" json:"-"`
+	Actor      User      `gorm:"foreignKey:ActorID" json:"actor,omitempty"`
+}
+
+func (wt *WorkflowTransition) BeforeCreate(tx *gorm.DB) error {
+	if wt.ID == uuid.Nil {
+		wt.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Activity verbs recorded by the services.
+const (
+	VerbContentCreated       = "content.created"
+	VerbContentUpdated       = "content.updated"
+	VerbContentDeleted       = "content.deleted"
+	VerbContentTransferred   = "content.transferred"
+	VerbContentMoved         = "content.moved"
+	VerbContentGenerated     = "content.generated"
+	VerbContentShared        = "content.shared"
+	VerbContentStatusChanged = "content.status_changed"
+	VerbContentReviewed      = "content.reviewed"
+	VerbReviewerAssigned     = "content.reviewer_assigned"
+	VerbCommentAdded         = "comment.added"
+	VerbShareLinkCreated     = "share_link.created"
+	VerbShareLinkRevoked     = "share_link.revoked"
+	VerbShareCommentAdded    = "share_link.comment_added"
+	VerbBrandToneCreated     = "brand_tone.created"
+	VerbBrandToneUpdated     = "brand_tone.updated"
+	VerbBrandToneDeleted     = "brand_tone.deleted"
+	VerbTeamCreated          = "team.created"
+	VerbTeamUpdated          = "team.updated"
+	VerbTeamDeleted          = "team.deleted"
+	VerbTeamMemberAdded      = "team.member_added"
+	VerbTeamMemberRemoved    = "team.member_removed"
+	VerbTeamMemberRole       = "team.member_role_changed"
+	VerbTeamOwnerChanged     = "team.ownership_transferred"
+	VerbTeamInvitationSent   = "team.invitation_sent"
+)
+
+// ActivityListener is notified after each event is recorded.
+type ActivityListener interface {
+	OnActivity(event *models.ActivityEvent)
+}
+
+type ActivityService struct {
+	db        *gorm.DB
+	policy    *PolicyService
+	listeners []ActivityListener
+}
+
+func NewActivityService(db *gorm.DB, policy *PolicyService) *ActivityService {
+	return &ActivityService{db: db, policy: policy}
+}
+
+// AddListener registers l for every subsequently recorded event. It must be
+// called during startup, before the service is in use.
+func (as *ActivityService) AddListener(l ActivityListener) {
+	as.listeners = append(as.listeners, l)
+}
+
+// Record appends an event to the log. Logging must never fail the action
+// being logged, so errors are only reported.
+func (as *ActivityService) Record(event *models.ActivityEvent) {
+	if err := as.db.Create(event).Error; err != nil {
+		log.Printf("failed to record activity %s: %v", event.Verb, err)
+		return
+	}
+	as.notify(event)
+}
+
+func (as *ActivityService) notify(event *models.ActivityEvent) {
+	for _, l := range as.listeners {
+		l.OnActivity(event)
+	}
+}
+
+// RecordContent records an event about a content item, attributing it to the
+// content's team workspace if it has one.
+func (as *ActivityService) RecordContent(actorID uuid.UUID, verb string, content *models.Content, summary string) {
+	as.Record(&models.ActivityEvent{
+		ActorID:    actorID,
+		Verb:       verb,
+		ObjectType: "content",
+		ObjectID:   &content.ID,
+		ContentID:  &content.ID,
+		TeamID:     content.TeamID,
+		Summary:    summary,
+	})
+}
+
+// ActivityFilter narrows an activity feed. Types holds verbs to match.
+type ActivityFilter struct {
+	ActorID *uuid.UUID
+	Types   []string
+	Limit   int
+	Offset  int
+}
+
+func (as *ActivityService) ContentActivity(contentID, userID uuid.UUID, filter ActivityFilter) ([]models.ActivityEvent, int64, error) {
+	var content models.Content
+	if err := as.db.First(&content, contentID).Error; err != nil {
+		return nil, 0, notFound("content not found")
+	}
+	if err := as.policy.AuthorizeContent(userID, &content, PermContentView); err != nil {
+		return nil, 0, err
+	}
+
+	return as.feed(as.db.Where("content_id = ?", contentID), filter)
+}
+
+func (as *ActivityService) TeamActivity(teamID, userID uuid.UUID, filter ActivityFilter) ([]models.ActivityEvent, int64, error) {
+	if err := as.policy.AuthorizeTeam(userID, teamID, PermContentView); err != nil {
+		return nil, 0, err
+	}
+
+	return as.feed(as.db.Where("team_id = ?", teamID), filter)
+}
+
+func (as *ActivityService) feed(query *gorm.DB, filter ActivityFilter) ([]models.ActivityEvent, int64, error) {
+	var events []models.ActivityEvent
+	var total int64
+
+	query = query.Model(&models.ActivityEvent{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("verb IN ?", filter.Types)
+	}
+	query.Count(&total)
+
+	if err := query.Preload("Actor").Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// diffSummary describes a content edit in a single line.
+func diffSummary(oldTitle, newTitle, oldBody, newBody string) string {
+	var parts []string
+	if oldTitle != newTitle {
+		parts = append(parts, fmt.Sprintf("title changed from %q to %q", oldTitle, newTitle))
+	}
+	if oldBody != newBody {
+		oldWords := len(strings.Fields(oldBody))
+		newWords := len(strings.Fields(newBody))
+		parts = append(parts, fmt.Sprintf("body edited (%d → %d words, %+d)", oldWords, newWords, newWords-oldWords))
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "…"
+}
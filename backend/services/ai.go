@@ -2,28 +2,61 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
 )
 
+// maxCompletionTokens caps each generation's length.
+const maxCompletionTokens = 1000
+
+// modelTimeout bounds a model call, so a hung model service cannot hold a
+// queue slot for good.
+const modelTimeout = 5 * time.Minute
+
 type AIService struct {
-	cache *CacheService
+	cache   *CacheService
+	prompts *PromptService
+	usage   *UsageService
+	queue   *GenerationQueue
+	client  *http.Client
 }
 
-func NewAIService(cache *CacheService) *AIService {
-	return &AIService{cache: cache}
+func NewAIService(cache *CacheService, prompts *PromptService, usage *UsageService, queue *GenerationQueue) *AIService {
+	return &AIService{
+		cache:   cache,
+		prompts: prompts,
+		usage:   usage,
+		queue:   queue,
+		client:  &http.Client{Timeout: modelTimeout},
+	}
 }
 
 type AIRequest struct {
-	Prompt      string                 `json:"prompt"`
-	Context     string                 `json:"context,omitempty"`
-	BrandTone   map[string]interface{} `json:"brand_tone,omitempty"`
-	ContentType string                 `json:"content_type,omitempty"`
-	Action      string                 `json:"action"` // compose, enhance, rewrite
+	Prompt      string                `json:"prompt"`
+	Context     string                `json:"context,omitempty"`
+	BrandTone   *models.BrandTone     `json:"brand_tone,omitempty"`
+	Glossary    []models.GlossaryTerm `json:"glossary,omitempty"`
+	ContentType string                `json:"content_type,omitempty"`
+	Action      string                `json:"action"`                // compose, enhance, or a transform action
+	Instruction string                `json:"instruction,omitempty"` // heads the prompt for transform and long-form actions
+	UserID      uuid.UUID             `json:"-"`                     // who the call is metered to; uuid.Nil skips metering
+	TeamID      *uuid.UUID            `json:"-"`                     // workspace whose prompt templates and quota apply
+	Temperature float64               `json:"temperature,omitempty"` // sampling temperature; 0 uses the model service's default
+	SkipCache   bool                  `json:"-"`                     // always call the model, e.g. for fresh variants
+	Format      string                `json:"-"`                     // output format instructions, appended after the template
+	Priority    GenerationPriority    `json:"-"`                     // place in the generation queue
+	OnQueued    func(position int)    `json:"-"`                     // told the queue position if the call has to wait
+	Ctx         context.Context       `json:"-"`                     // cancels the queued or running call when done; nil never does
 }
 
 type AIResponse struct {
@@ -32,14 +65,68 @@ type AIResponse struct {
 }
 
 func (ais *AIService) GenerateContent(req AIRequest) (string, error) {
-	// Check cache first
-	cacheKey := fmt.Sprintf("ai:%s:%s", req.Action, req.Prompt)
-	if cached, found := ais.cache.Get(cacheKey); found {
+	// Build prompt with brand tone
+	prompt, err := ais.buildPrompt(req)
+	if err != nil {
+		return "", err
+	}
+
+	// Check cache first. The key covers the full prompt so a changed brand
+	// tone is never answered from the cache.
+	cacheKey := fmt.Sprintf("ai:%s:%s", req.Action, prompt)
+	if req.Temperature > 0 {
+		cacheKey = fmt.Sprintf("ai:%s:%g:%s", req.Action, req.Temperature, prompt)
+	}
+	if cached, found := ais.cache.Get(cacheKey); found && !req.SkipCache {
+		ais.usage.Record(&models.UsageRecord{
+			UserID:   req.UserID,
+			TeamID:   req.TeamID,
+			Action:   req.Action,
+			CacheHit: true,
+		})
 		return cached.(string), nil
 	}
 
-	// Build prompt with brand tone
-	prompt := ais.buildPrompt(req)
+	reservation, err := ais.usage.Check(req.UserID, req.TeamID, req.Action, estimateTokens(prompt)+maxCompletionTokens)
+	if err != nil {
+		return "", err
+	}
+	ctx := req.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	release, err := ais.queue.Acquire(ctx, req.UserID, req.Action, req.Priority, req.OnQueued)
+	if err != nil {
+		ais.usage.Cancel(reservation)
+		return "", err
+	}
+	start := time.Now()
+	content, err := ais.callModel(ctx, prompt, req.Temperature)
+	release()
+	record := &models.UsageRecord{
+		UserID:           req.UserID,
+		TeamID:           req.TeamID,
+		Action:           req.Action,
+		PromptTokens:     estimateTokens(prompt),
+		CompletionTokens: estimateTokens(content),
+		LatencyMs:        time.Since(start).Milliseconds(),
+		Failed:           err != nil,
+	}
+	if reservation != nil {
+		record.ID = reservation.ID
+	}
+	ais.usage.Record(record)
+	if err != nil {
+		return "", err
+	}
+
+	// Cache the result for 1 hour
+	ais.cache.Set(cacheKey, content, 1*time.Hour)
+
+	return content, nil
+}
+
+func (ais *AIService) callModel(ctx context.Context, prompt string, temperature float64) (string, error) {
 
 	// Call GPT4All service
 	gpt4allURL := os.Getenv("GPT4ALL_PYTHON_SERVICE_URL")
@@ -48,8 +135,11 @@ func (ais *AIService) GenerateContent(req AIRequest) (string, error) {
 	}
 
 	payload := map[string]interface{}{
-		"prompt": prompt,
-		"max_tokens": 1000,
+		"prompt":     prompt,
+		"max_tokens": maxCompletionTokens,
+	}
+	if temperature > 0 {
+		payload["temperature"] = temperature
 	}
 
 	jsonData, err := json.Marshal(payload)
@@ -57,7 +147,12 @@ func (ais *AIService) GenerateContent(req AIRequest) (string, error) {
 		return "", err
 	}
 
-	resp, err := http.Post(gpt4allURL+"/generate", "application/json", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, gpt4allURL+"/generate", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := ais.client.Do(httpReq)
 	if err != nil {
 		return "", fmt.Errorf("failed to call GPT4All service: %w", err)
 	}
@@ -77,42 +172,94 @@ func (ais *AIService) GenerateContent(req AIRequest) (string, error) {
 		return "", fmt.Errorf("AI service error: %s", aiResp.Error)
 	}
 
-	// Cache the result for 1 hour
-	ais.cache.Set(cacheKey, aiResp.Content, 1*time.Hour)
-
 	return aiResp.Content, nil
 }
 
-func (ais *AIService) buildPrompt(req AIRequest) string {
-	prompt := req.Prompt
+// buildPrompt renders the template for templated actions. Other requests,
+// such as tone ratings, already carry their full prompt. Format follows the
+// template so an edited template cannot drop it.
+func (ais *AIService) buildPrompt(req AIRequest) (string, error) {
+	if !isPromptAction(req.Action) {
+		return req.Prompt, nil
+	}
+	prompt, err := ais.prompts.Render(req.TeamID, promptVariables(req))
+	if err != nil || req.Format == "" {
+		return prompt, err
+	}
+	return prompt + "\n\n" + req.Format, nil
+}
 
+func promptVariables(req AIRequest) PromptVariables {
+	vars := PromptVariables{
+		Action:      req.Action,
+		Input:       req.Prompt,
+		Instruction: req.Instruction,
+		Context:     req.Context,
+		ContentType: req.ContentType,
+	}
 	if req.BrandTone != nil {
-		toneDesc := ""
-		if desc, ok := req.BrandTone["description"].(string); ok {
-			toneDesc = desc
-		}
-		if toneDesc != "" {
-			prompt = fmt.Sprintf("Write in the following brand tone: %s\n\n%s", toneDesc, prompt)
-		}
+		vars.Tone = brandToneInstructions(req.BrandTone)
 	}
-
-	if req.ContentType != "" {
-		prompt = fmt.Sprintf("Content type: %s\n\n%s", req.ContentType, prompt)
+	if len(req.Glossary) > 0 {
+		vars.Glossary = glossaryInstructions(req.Glossary)
 	}
+	return vars
+}
+
+var formalityInstructions = map[string]string{
+	models.FormalityFormal:  "Use a formal, professional register. Avoid contractions and slang.",
+	models.FormalityNeutral: "Use a neutral, businesslike register.",
+	models.FormalityCasual:  "Use a casual, conversational register. Contractions are fine.",
+}
+
+var readingLevelInstructions = map[string]string{
+	models.ReadingLevelSimple:    "Write for a general reader at about a 6th-grade reading level: short sentences, everyday words.",
+	models.ReadingLevelGeneral:   "Write for a general adult audience: clear sentences, explain jargon.",
+	models.ReadingLevelAdvanced:  "Write for an educated audience: varied sentences, precise vocabulary.",
+	models.ReadingLevelTechnical: "Write for specialists: domain terminology is fine without explanation.",
+}
+
+var emojiInstructions = map[string]string{
+	models.EmojiNone:       "Do not use emoji.",
+	models.EmojiSparing:    "Use emoji sparingly, at most one or two where they add meaning.",
+	models.EmojiEncouraged: "Use emoji where they fit naturally.",
+}
 
-	if req.Context != "" {
-		prompt = fmt.Sprintf("Context: %s\n\n%s", req.Context, prompt)
+// brandToneInstructions turns a brand tone's description and settings into
+// prompt lines, one per configured field.
+func brandToneInstructions(tone *models.BrandTone) string {
+	var lines []string
+	add := func(line string) {
+		if line != "" {
+			lines = append(lines, "- "+line)
+		}
 	}
 
-	switch req.Action {
-	case "compose":
-		prompt = fmt.Sprintf("Compose the following content:\n\n%s", prompt)
-	case "enhance":
-		prompt = fmt.Sprintf("Enhance and improve the following content while maintaining its meaning:\n\n%s", prompt)
-	case "rewrite":
-		prompt = fmt.Sprintf("Rewrite the following content:\n\n%s", prompt)
+	settings := tone.Settings
+	add(strings.TrimSpace(tone.Description))
+	if settings.Voice != "" {
+		add("Voice: " + settings.Voice + ".")
+	}
+	if settings.TargetAudience != "" {
+		add("Target audience: " + settings.TargetAudience + ".")
+	}
+	add(formalityInstructions[settings.Formality])
+	add(readingLevelInstructions[settings.ReadingLevel])
+	add(emojiInstructions[settings.EmojiPolicy])
+	if len(settings.PreferredTerms) > 0 {
+		add("Prefer these terms: " + strings.Join(settings.PreferredTerms, ", ") + ".")
+	}
+	if len(settings.BannedTerms) > 0 {
+		add("Never use these terms: " + strings.Join(settings.BannedTerms, ", ") + ".")
 	}
 
-	return prompt
+	instructions := strings.Join(lines, "\n")
+	if len(settings.SamplePassages) > 0 {
+		instructions += "\n\nMatch the style of these sample passages (do not copy them):"
+		for _, sample := range settings.SamplePassages {
+			instructions += "\n---\n" + sample
+		}
+		instructions += "\n---"
+	}
+	return strings.TrimSpace(instructions)
 }
-
@@ -0,0 +1,509 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxBatchItems        = 500
+	maxBatchPromptLength = 10000
+	maxBatchTitleLength  = 80
+	// batchWorkers is how many items of one job wait in the generation
+	// queue at a time; the queue decides how many actually run.
+	batchWorkers = 4
+)
+
+// BatchItemInput is one prompt of a new batch job. Without a title the
+// first line of the prompt is used.
+type BatchItemInput struct {
+	Title  string `json:"title"`
+	Prompt string `json:"prompt"`
+}
+
+// BatchInput describes a batch job. Generation options are passed
+// separately and apply to every item.
+type BatchInput struct {
+	Name        string
+	ContentType string
+	FolderID    *uuid.UUID
+	Items       []BatchItemInput
+}
+
+// BatchProgress counts a job's items by status.
+type BatchProgress struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Running   int `json:"running"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+// BatchJobStatus is a job with its progress and, when requested, its items.
+type BatchJobStatus struct {
+	Job      *models.BatchJob   `json:"job"`
+	Progress BatchProgress      `json:"progress"`
+	Items    []models.BatchItem `json:"items,omitempty"`
+}
+
+// BatchService runs batch jobs: compose generations for a list of prompts,
+// each saved as a draft content item. Items run in the background at batch
+// priority, so interactive requests are served first.
+type BatchService struct {
+	db      *gorm.DB
+	content *ContentService
+
+	mu     sync.Mutex
+	active map[uuid.UUID]bool // jobs with a run in progress
+}
+
+func NewBatchService(db *gorm.DB, content *ContentService) *BatchService {
+	bs := &BatchService{db: db, content: content, active: make(map[uuid.UUID]bool)}
+
+	// Items run in-process, so a restart cuts off running jobs. Their
+	// unfinished items are run again.
+	if err := db.Model(&models.BatchItem{}).Where("status = ?", models.BatchItemRunning).
+		Update("status", models.BatchItemPending).Error; err != nil {
+		log.Printf("failed to reset interrupted batch items: %v", err)
+	}
+	var jobs []models.BatchJob
+	if err := db.Where("status = ?", models.BatchRunning).Find(&jobs).Error; err != nil {
+		log.Printf("failed to find interrupted batch jobs: %v", err)
+	}
+	for _, job := range jobs {
+		bs.claimRun(job.ID)
+		go bs.run(job)
+	}
+	return bs
+}
+
+// ParseBatchCSV reads batch items from CSV with a header row. The prompt
+// column is required and title is optional; other columns are ignored.
+func ParseBatchCSV(data []byte) ([]BatchItemInput, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, invalidInput("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, invalidInput("invalid CSV: " + err.Error())
+	}
+	promptCol, titleCol := -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "prompt":
+			promptCol = i
+		case "title":
+			titleCol = i
+		}
+	}
+	if promptCol < 0 {
+		return nil, invalidInput("the CSV file needs a prompt column")
+	}
+
+	var items []BatchItemInput
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, invalidInput("invalid CSV: " + err.Error())
+		}
+		var item BatchItemInput
+		if promptCol < len(record) {
+			item.Prompt = record[promptCol]
+		}
+		if titleCol >= 0 && titleCol < len(record) {
+			item.Title = record[titleCol]
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// CreateBatch validates the items and options, pins the brand tone and
+// starts the job. Options are those of compose, except n.
+func (bs *BatchService) CreateBatch(userID uuid.UUID, in BatchInput, opts GenerationOptions) (*BatchJobStatus, error) {
+	if opts.Variants > 1 {
+		return nil, invalidInput("n is not supported for batch jobs")
+	}
+	if opts.RetrieveTopK < 0 || opts.RetrieveTopK > maxRetrieveTopK {
+		return nil, invalidInput(fmt.Sprintf("retrieve_top_k must be between 0 and %d", maxRetrieveTopK))
+	}
+	if len(in.Items) == 0 {
+		return nil, invalidInput("at least one item is required")
+	}
+	if len(in.Items) > maxBatchItems {
+		return nil, invalidInput(fmt.Sprintf("at most %d items are allowed", maxBatchItems))
+	}
+	items := make([]models.BatchItem, len(in.Items))
+	for i, input := range in.Items {
+		prompt := strings.TrimSpace(input.Prompt)
+		if prompt == "" {
+			return nil, invalidInput(fmt.Sprintf("item %d: prompt is required", i+1))
+		}
+		if len(prompt) > maxBatchPromptLength {
+			return nil, invalidInput(fmt.Sprintf("item %d: prompt must be at most %d characters", i+1, maxBatchPromptLength))
+		}
+		title := strings.TrimSpace(input.Title)
+		if title == "" {
+			title = excerpt(strings.TrimSpace(strings.SplitN(prompt, "\n", 2)[0]), maxBatchTitleLength)
+		}
+		items[i] = models.BatchItem{Position: i, Title: title, Prompt: prompt, Status: models.BatchItemPending}
+	}
+	if _, err := newOutputFormat(in.ContentType, opts); err != nil {
+		return nil, err
+	}
+	if opts.TeamID != nil {
+		if err := bs.content.policy.AuthorizeTeam(userID, *opts.TeamID, PermContentEdit); err != nil {
+			return nil, err
+		}
+	}
+	if err := bs.content.checkFolder(userID, in.FolderID, opts.TeamID); err != nil {
+		return nil, err
+	}
+
+	// Every item is written with the tone as it is now
+	req, _, err := bs.content.prepareGeneration(userID, AIRequest{ContentType: in.ContentType, Action: "compose"}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.BatchJob{
+		UserID:       userID,
+		TeamID:       opts.TeamID,
+		FolderID:     in.FolderID,
+		Name:         strings.TrimSpace(in.Name),
+		ContentType:  in.ContentType,
+		AutoCorrect:  opts.AutoCorrect,
+		Structured:   opts.Structured,
+		Platforms:    opts.Platforms,
+		RetrieveTopK: opts.RetrieveTopK,
+		Status:       models.BatchRunning,
+		Total:        len(items),
+	}
+	if req.BrandTone != nil {
+		job.BrandToneID = &req.BrandTone.ID
+		if req.BrandTone.Version > 0 {
+			job.BrandToneVersion = &req.BrandTone.Version
+		}
+	}
+	err = bs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].JobID = job.ID
+		}
+		return tx.CreateInBatches(&items, 100).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bs.claimRun(job.ID)
+	go bs.run(*job)
+	return &BatchJobStatus{Job: job, Progress: BatchProgress{Total: len(items), Pending: len(items)}}, nil
+}
+
+// ListBatches lists the user's personal batch jobs, or a team's, with
+// their progress.
+func (bs *BatchService) ListBatches(userID uuid.UUID, teamID *uuid.UUID) ([]BatchJobStatus, error) {
+	query := bs.db.Model(&models.BatchJob{})
+	if teamID != nil {
+		if err := bs.content.policy.AuthorizeTeam(userID, *teamID, PermContentView); err != nil {
+			return nil, err
+		}
+		query = query.Where("team_id = ?", *teamID)
+	} else {
+		query = query.Where("user_id = ? AND team_id IS NULL", userID)
+	}
+
+	var jobs []models.BatchJob
+	if err := query.Order("created_at DESC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	progress, err := bs.progress(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]BatchJobStatus, len(jobs))
+	for i := range jobs {
+		result[i] = BatchJobStatus{Job: &jobs[i], Progress: progress[jobs[i].ID]}
+		result[i].Progress.Total = jobs[i].Total
+	}
+	return result, nil
+}
+
+// GetBatch returns a job with its items, optionally only those with the
+// given status.
+func (bs *BatchService) GetBatch(jobID, userID uuid.UUID, itemStatus string) (*BatchJobStatus, error) {
+	job, err := bs.findBatch(jobID, userID, PermContentView)
+	if err != nil {
+		return nil, err
+	}
+	return bs.status(job, itemStatus)
+}
+
+// CancelBatch stops a running job. Items already being generated finish;
+// the rest are cancelled.
+func (bs *BatchService) CancelBatch(jobID, userID uuid.UUID) (*BatchJobStatus, error) {
+	job, err := bs.findBatch(jobID, userID, PermContentEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = bs.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.BatchJob{}).Where("id = ? AND status = ?", job.ID, models.BatchRunning).
+			Updates(map[string]interface{}{"status": models.BatchCancelled, "finished_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return conflict("job is not running")
+		}
+		// Workers only start pending items, so this stops the run
+		return tx.Model(&models.BatchItem{}).Where("job_id = ? AND status = ?", job.ID, models.BatchItemPending).
+			Update("status", models.BatchItemCancelled).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	job.Status, job.FinishedAt = models.BatchCancelled, &now
+	return bs.status(job, "")
+}
+
+// RetryBatch runs a finished or cancelled job's failed items again.
+func (bs *BatchService) RetryBatch(jobID, userID uuid.UUID) (*BatchJobStatus, error) {
+	job, err := bs.findBatch(jobID, userID, PermContentEdit)
+	if err != nil {
+		return nil, err
+	}
+	if !bs.claimRun(job.ID) {
+		return nil, conflict("job is still running; retry once it has finished")
+	}
+
+	err = bs.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.BatchItem{}).Where("job_id = ? AND status = ?", job.ID, models.BatchItemFailed).
+			Updates(map[string]interface{}{"status": models.BatchItemPending, "error": ""})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return conflict("job has no failed items")
+		}
+		return tx.Model(job).Updates(map[string]interface{}{"status": models.BatchRunning, "finished_at": nil}).Error
+	})
+	if err != nil {
+		bs.endRun(job.ID)
+		return nil, err
+	}
+	job.Status, job.FinishedAt = models.BatchRunning, nil
+
+	go bs.run(*job)
+	return bs.status(job, "")
+}
+
+// claimRun marks a job as having a run in progress, unless it already has.
+func (bs *BatchService) claimRun(jobID uuid.UUID) bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.active[jobID] {
+		return false
+	}
+	bs.active[jobID] = true
+	return true
+}
+
+func (bs *BatchService) endRun(jobID uuid.UUID) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	delete(bs.active, jobID)
+}
+
+// run generates the job's pending items in order, a few at a time, and
+// completes the job unless it was cancelled.
+func (bs *BatchService) run(job models.BatchJob) {
+	defer bs.endRun(job.ID)
+
+	var itemIDs []uuid.UUID
+	if err := bs.db.Model(&models.BatchItem{}).Where("job_id = ? AND status = ?", job.ID, models.BatchItemPending).
+		Order("position").Pluck("id", &itemIDs).Error; err != nil {
+		log.Printf("failed to load items of batch job %s: %v", job.ID, err)
+		return
+	}
+
+	queue := make(chan uuid.UUID)
+	var wg sync.WaitGroup
+	for w := 0; w < batchWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for itemID := range queue {
+				bs.runItem(&job, itemID)
+			}
+		}()
+	}
+	for _, itemID := range itemIDs {
+		queue <- itemID
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := bs.db.Model(&models.BatchJob{}).Where("id = ? AND status = ?", job.ID, models.BatchRunning).
+		Updates(map[string]interface{}{"status": models.BatchCompleted, "finished_at": time.Now()}).Error; err != nil {
+		log.Printf("failed to complete batch job %s: %v", job.ID, err)
+	}
+}
+
+func (bs *BatchService) runItem(job *models.BatchJob, itemID uuid.UUID) {
+	// Claiming fails once the job has been cancelled
+	result := bs.db.Model(&models.BatchItem{}).Where("id = ? AND status = ?", itemID, models.BatchItemPending).
+		Updates(map[string]interface{}{"status": models.BatchItemRunning, "attempts": gorm.Expr("attempts + 1")})
+	if result.Error != nil {
+		log.Printf("failed to start batch item %s: %v", itemID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	var item models.BatchItem
+	if err := bs.db.First(&item, itemID).Error; err != nil {
+		log.Printf("failed to load batch item %s: %v", itemID, err)
+		return
+	}
+
+	updates := map[string]interface{}{"status": models.BatchItemSucceeded, "error": ""}
+	content, err := bs.generateItem(job, &item)
+	if err != nil {
+		updates = map[string]interface{}{"status": models.BatchItemFailed, "error": err.Error()}
+	} else {
+		updates["content_id"] = content.ID
+	}
+	if err := bs.db.Model(&item).Updates(updates).Error; err != nil {
+		log.Printf("failed to save batch item %s: %v", itemID, err)
+	}
+}
+
+func (bs *BatchService) generateItem(job *models.BatchJob, item *models.BatchItem) (*models.Content, error) {
+	result, err := bs.content.generate(job.UserID, AIRequest{
+		Prompt:      item.Prompt,
+		ContentType: job.ContentType,
+		Action:      "compose",
+	}, GenerationOptions{
+		BrandToneID:      job.BrandToneID,
+		BrandToneVersion: job.BrandToneVersion,
+		TeamID:           job.TeamID,
+		AutoCorrect:      job.AutoCorrect,
+		Structured:       job.Structured,
+		Platforms:        job.Platforms,
+		RetrieveTopK:     job.RetrieveTopK,
+		Priority:         PriorityBatch,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var structured json.RawMessage
+	if result.Structured != nil {
+		if structured, err = json.Marshal(result.Structured); err != nil {
+			return nil, err
+		}
+	}
+	return bs.content.createContent(job.UserID, item.Title, result.Content, job.ContentType, structured,
+		result.BrandToneID, result.BrandToneVersion, job.TeamID, job.FolderID)
+}
+
+func (bs *BatchService) status(job *models.BatchJob, itemStatus string) (*BatchJobStatus, error) {
+	query := bs.db.Where("job_id = ?", job.ID)
+	if itemStatus != "" {
+		switch itemStatus {
+		case models.BatchItemPending, models.BatchItemRunning, models.BatchItemSucceeded, models.BatchItemFailed, models.BatchItemCancelled:
+		default:
+			return nil, invalidInput("unknown item status \"" + itemStatus + "\"")
+		}
+		query = query.Where("status = ?", itemStatus)
+	}
+	items := []models.BatchItem{}
+	if err := query.Order("position").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	progress, err := bs.progress([]uuid.UUID{job.ID})
+	if err != nil {
+		return nil, err
+	}
+	status := &BatchJobStatus{Job: job, Progress: progress[job.ID], Items: items}
+	status.Progress.Total = job.Total
+	return status, nil
+}
+
+// progress counts the items of each job by status.
+func (bs *BatchService) progress(jobIDs []uuid.UUID) (map[uuid.UUID]BatchProgress, error) {
+	result := make(map[uuid.UUID]BatchProgress, len(jobIDs))
+	if len(jobIDs) == 0 {
+		return result, nil
+	}
+	var counts []struct {
+		JobID  uuid.UUID
+		Status string
+		Count  int
+	}
+	if err := bs.db.Model(&models.BatchItem{}).Select("job_id, status, COUNT(*) AS count").
+		Where("job_id IN ?", jobIDs).Group("job_id, status").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		p := result[c.JobID]
+		switch c.Status {
+		case models.BatchItemPending:
+			p.Pending = c.Count
+		case models.BatchItemRunning:
+			p.Running = c.Count
+		case models.BatchItemSucceeded:
+			p.Succeeded = c.Count
+		case models.BatchItemFailed:
+			p.Failed = c.Count
+		case models.BatchItemCancelled:
+			p.Cancelled = c.Count
+		}
+		result[c.JobID] = p
+	}
+	return result, nil
+}
+
+func (bs *BatchService) findBatch(jobID, userID uuid.UUID, perm Permission) (*models.BatchJob, error) {
+	var job models.BatchJob
+	if err := bs.db.First(&job, jobID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("batch job not found")
+		}
+		return nil, err
+	}
+	if err := bs.content.policy.Authorize(userID, job.UserID, job.TeamID, perm); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
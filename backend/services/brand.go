@@ -2,6 +2,9 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 
 	"inscribeai/models"
 
@@ -10,14 +13,36 @@ import (
 )
 
 type BrandService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	ai       *AIService
+	policy   *PolicyService
+	activity *ActivityService
 }
 
-func NewBrandService(db *gorm.DB) *BrandService {
-	return &BrandService{db: db}
+func NewBrandService(db *gorm.DB, ai *AIService, policy *PolicyService, activity *ActivityService) *BrandService {
+	return &BrandService{db: db, ai: ai, policy: policy, activity: activity}
 }
 
-func (bs *BrandService) CreateBrandTone(userID uuid.UUID, name, description, settings string, teamID *uuid.UUID) (*models.BrandTone, error) {
+// Limits on brand tone settings, keeping generated prompts a sensible size.
+const (
+	maxBrandToneTerms     = 100
+	maxBrandToneTermLen   = 100
+	maxBrandToneSamples   = 5
+	maxBrandToneSampleLen = 2000
+	maxBrandToneFieldLen  = 500
+)
+
+func (bs *BrandService) CreateBrandTone(userID uuid.UUID, name, description string, settings models.BrandToneSettings, teamID *uuid.UUID) (*models.BrandTone, error) {
+	settings, err := normalizeBrandToneSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+	if teamID != nil {
+		if err := bs.policy.AuthorizeTeam(userID, *teamID, PermBrandCreate); err != nil {
+			return nil, err
+		}
+	}
+
 	brandTone := &models.BrandTone{
 		UserID:      userID,
 		Name:        name,
@@ -26,47 +51,252 @@ func (bs *BrandService) CreateBrandTone(userID uuid.UUID, name, description, set
 		TeamID:      teamID,
 	}
 
-	if err := bs.db.Create(brandTone).Error; err != nil {
+	err = bs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(brandTone).Error; err != nil {
+			return err
+		}
+		if err := createBrandToneVersion(tx, brandTone, userID, ""); err != nil {
+			return err
+		}
+		return tx.Save(brandTone).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 
+	bs.recordActivity(userID, VerbBrandToneCreated, brandTone, "created brand tone \""+name+"\"")
 	return brandTone, nil
 }
 
 func (bs *BrandService) GetBrandToneByID(brandToneID, userID uuid.UUID) (*models.BrandTone, error) {
-	var brandTone models.BrandTone
-	if err := bs.db.Where("id = ? AND (user_id = ? OR team_id IN (SELECT team_id FROM team_members WHERE user_id = ?))", brandToneID, userID, userID).First(&brandTone).Error; err != nil {
-		return nil, err
-	}
-	return &brandTone, nil
+	return findVisibleBrandTone(bs.db, bs.policy, brandToneID, userID)
 }
 
 func (bs *BrandService) ListBrandTones(userID uuid.UUID) ([]models.BrandTone, error) {
+	teamIDs, err := bs.policy.TeamsWithPermission(userID, PermBrandView)
+	if err != nil {
+		return nil, err
+	}
+
 	var brandTones []models.BrandTone
-	if err := bs.db.Where("user_id = ? OR team_id IN (SELECT team_id FROM team_members WHERE user_id = ?)", userID, userID).Find(&brandTones).Error; err != nil {
+	if err := bs.db.Where("(user_id = ? AND team_id IS NULL) OR team_id IN ?", userID, teamIDs).Find(&brandTones).Error; err != nil {
 		return nil, err
 	}
 	return brandTones, nil
 }
 
-func (bs *BrandService) UpdateBrandTone(brandToneID, userID uuid.UUID, name, description, settings string) (*models.BrandTone, error) {
-	var brandTone models.BrandTone
-	if err := bs.db.Where("id = ? AND user_id = ?", brandToneID, userID).First(&brandTone).Error; err != nil {
-		return nil, errors.New("brand tone not found")
+func (bs *BrandService) UpdateBrandTone(brandToneID, userID uuid.UUID, name, description string, settings models.BrandToneSettings) (*models.BrandTone, error) {
+	settings, err := normalizeBrandToneSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+	brandTone, err := bs.findBrandTone(brandToneID)
+	if err != nil {
+		return nil, err
+	}
+	if err := bs.policy.Authorize(userID, brandTone.UserID, brandTone.TeamID, PermBrandEdit); err != nil {
+		return nil, err
 	}
 
-	brandTone.Name = name
-	brandTone.Description = description
-	brandTone.Settings = settings
+	summary := brandToneDiffSummary(brandTone, name, description, settings)
+	if summary == "no changes" {
+		return brandTone, nil
+	}
 
-	if err := bs.db.Save(&brandTone).Error; err != nil {
+	err = bs.db.Transaction(func(tx *gorm.DB) error {
+		// Tones from before versioning get their old state kept as version 1
+		if brandTone.Version == 0 {
+			if err := createBrandToneVersion(tx, brandTone, brandTone.UserID, ""); err != nil {
+				return err
+			}
+		}
+		brandTone.Name = name
+		brandTone.Description = description
+		brandTone.Settings = settings
+		if err := createBrandToneVersion(tx, brandTone, userID, ""); err != nil {
+			return err
+		}
+		return tx.Save(brandTone).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &brandTone, nil
+	bs.recordActivity(userID, VerbBrandToneUpdated, brandTone, summary)
+	return brandTone, nil
 }
 
 func (bs *BrandService) DeleteBrandTone(brandToneID, userID uuid.UUID) error {
-	return bs.db.Where("id = ? AND user_id = ?", brandToneID, userID).Delete(&models.BrandTone{}).Error
+	brandTone, err := bs.findBrandTone(brandToneID)
+	if err != nil {
+		return err
+	}
+	if err := bs.policy.Authorize(userID, brandTone.UserID, brandTone.TeamID, PermBrandDelete); err != nil {
+		return err
+	}
+	err = bs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("brand_tone_id = ?", brandTone.ID).Delete(&models.GlossaryTerm{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("brand_tone_id = ?", brandTone.ID).Delete(&models.BrandToneVersion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("brand_tone_id = ?", brandTone.ID).Delete(&models.BrandToneDefault{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(brandTone).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	bs.recordActivity(userID, VerbBrandToneDeleted, brandTone, "deleted brand tone \""+brandTone.Name+"\"")
+	return nil
+}
+
+func (bs *BrandService) recordActivity(userID uuid.UUID, verb string, brandTone *models.BrandTone, summary string) {
+	bs.activity.Record(&models.ActivityEvent{
+		ActorID:    userID,
+		Verb:       verb,
+		ObjectType: "brand_tone",
+		ObjectID:   &brandTone.ID,
+		TeamID:     brandTone.TeamID,
+		Summary:    summary,
+	})
 }
 
+func brandToneDiffSummary(brandTone *models.BrandTone, name, description string, settings models.BrandToneSettings) string {
+	var changed []string
+	if brandTone.Name != name {
+		changed = append(changed, "name")
+	}
+	if brandTone.Description != description {
+		changed = append(changed, "description")
+	}
+	if !reflect.DeepEqual(brandTone.Settings, settings) {
+		changed = append(changed, "settings")
+	}
+	if len(changed) == 0 {
+		return "no changes"
+	}
+	return "changed " + strings.Join(changed, ", ")
+}
+
+// normalizeBrandToneSettings trims and de-duplicates the settings and checks
+// enumerated fields and size limits.
+func normalizeBrandToneSettings(settings models.BrandToneSettings) (models.BrandToneSettings, error) {
+	settings.Formality = strings.ToLower(strings.TrimSpace(settings.Formality))
+	settings.ReadingLevel = strings.ToLower(strings.TrimSpace(settings.ReadingLevel))
+	settings.EmojiPolicy = strings.ToLower(strings.TrimSpace(settings.EmojiPolicy))
+	settings.Voice = strings.TrimSpace(settings.Voice)
+	settings.TargetAudience = strings.TrimSpace(settings.TargetAudience)
+
+	if err := checkOneOf("formality", settings.Formality, models.FormalityFormal, models.FormalityNeutral, models.FormalityCasual); err != nil {
+		return settings, err
+	}
+	if err := checkOneOf("reading_level", settings.ReadingLevel, models.ReadingLevelSimple, models.ReadingLevelGeneral, models.ReadingLevelAdvanced, models.ReadingLevelTechnical); err != nil {
+		return settings, err
+	}
+	if err := checkOneOf("emoji_policy", settings.EmojiPolicy, models.EmojiNone, models.EmojiSparing, models.EmojiEncouraged); err != nil {
+		return settings, err
+	}
+	if len(settings.Voice) > maxBrandToneFieldLen {
+		return settings, invalidInput(fmt.Sprintf("voice must be at most %d characters", maxBrandToneFieldLen))
+	}
+	if len(settings.TargetAudience) > maxBrandToneFieldLen {
+		return settings, invalidInput(fmt.Sprintf("target_audience must be at most %d characters", maxBrandToneFieldLen))
+	}
+
+	var err error
+	if settings.PreferredTerms, err = normalizeTerms("preferred_terms", settings.PreferredTerms); err != nil {
+		return settings, err
+	}
+	if settings.BannedTerms, err = normalizeTerms("banned_terms", settings.BannedTerms); err != nil {
+		return settings, err
+	}
+	for _, preferred := range settings.PreferredTerms {
+		for _, banned := range settings.BannedTerms {
+			if strings.EqualFold(preferred, banned) {
+				return settings, invalidInput("\"" + preferred + "\" cannot be both preferred and banned")
+			}
+		}
+	}
+
+	samples := settings.SamplePassages[:0]
+	for _, sample := range settings.SamplePassages {
+		if sample = strings.TrimSpace(sample); sample == "" {
+			continue
+		}
+		if len(sample) > maxBrandToneSampleLen {
+			return settings, invalidInput(fmt.Sprintf("sample passages must be at most %d characters", maxBrandToneSampleLen))
+		}
+		samples = append(samples, sample)
+	}
+	if len(samples) > maxBrandToneSamples {
+		return settings, invalidInput(fmt.Sprintf("at most %d sample passages are allowed", maxBrandToneSamples))
+	}
+	settings.SamplePassages = samples
+
+	return settings, nil
+}
+
+func checkOneOf(field, value string, allowed ...string) error {
+	if value == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return invalidInput(field + " must be one of " + strings.Join(allowed, ", "))
+}
+
+// normalizeTerms trims terms and drops blanks and case-insensitive duplicates.
+func normalizeTerms(field string, terms []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		key := strings.ToLower(term)
+		if term == "" || seen[key] {
+			continue
+		}
+		if len(term) > maxBrandToneTermLen {
+			return nil, invalidInput(fmt.Sprintf("%s entries must be at most %d characters", field, maxBrandToneTermLen))
+		}
+		seen[key] = true
+		normalized = append(normalized, term)
+	}
+	if len(normalized) > maxBrandToneTerms {
+		return nil, invalidInput(fmt.Sprintf("at most %d %s are allowed", maxBrandToneTerms, field))
+	}
+	return normalized, nil
+}
+
+func (bs *BrandService) findBrandTone(brandToneID uuid.UUID) (*models.BrandTone, error) {
+	var brandTone models.BrandTone
+	if err := bs.db.First(&brandTone, brandToneID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("brand tone not found")
+		}
+		return nil, err
+	}
+	return &brandTone, nil
+}
+
+// findVisibleBrandTone loads a brand tone the user may view. Services that
+// take a brand tone ID from a request look it up through here.
+func findVisibleBrandTone(db *gorm.DB, policy *PolicyService, brandToneID, userID uuid.UUID) (*models.BrandTone, error) {
+	var brandTone models.BrandTone
+	if err := db.First(&brandTone, brandToneID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("brand tone not found")
+		}
+		return nil, err
+	}
+	if err := policy.Authorize(userID, brandTone.UserID, brandTone.TeamID, PermBrandView); err != nil {
+		return nil, err
+	}
+	return &brandTone, nil
+}
@@ -0,0 +1,494 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+)
+
+// Finding types reported by AnalyzeText.
+const (
+	FindingBannedTerm     = "banned_term"
+	FindingFormality      = "formality"
+	FindingReadingLevel   = "reading_level"
+	FindingSentenceLength = "sentence_length"
+	FindingEmoji          = "emoji"
+)
+
+// Finding severities.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+const maxAnalysisLength = 50000
+
+// BrandAnalysis is the result of scoring text against a brand tone.
+type BrandAnalysis struct {
+	BrandToneID     uuid.UUID          `json:"brand_tone_id"`
+	Score           int                `json:"score"` // 0-100, higher is closer to the brand tone
+	ToneRating      *ToneRating        `json:"tone_rating,omitempty"`
+	ToneRatingError string             `json:"tone_rating_error,omitempty"`
+	ReadingLevel    ReadingLevelResult `json:"reading_level"`
+	Formality       FormalityResult    `json:"formality"`
+	SentenceStats   SentenceStats      `json:"sentence_stats"`
+	Sentences       []Sentence         `json:"sentences"`
+	Findings        []Finding          `json:"findings"`
+}
+
+// ToneRating is the model's 1-10 judgement of how well the text fits the tone.
+type ToneRating struct {
+	Rating      int    `json:"rating"`
+	Explanation string `json:"explanation"`
+}
+
+type ReadingLevelResult struct {
+	Grade    float64 `json:"grade"` // Flesch-Kincaid grade level
+	Level    string  `json:"level"`
+	Target   string  `json:"target,omitempty"`
+	OnTarget bool    `json:"on_target"`
+}
+
+type FormalityResult struct {
+	Score    int    `json:"score"` // 0 is very casual, 100 very formal
+	Level    string `json:"level"`
+	Target   string `json:"target,omitempty"`
+	OnTarget bool   `json:"on_target"`
+}
+
+type SentenceStats struct {
+	Count       int     `json:"count"`
+	Words       int     `json:"words"`
+	MeanWords   float64 `json:"mean_words"`
+	MedianWords float64 `json:"median_words"`
+	MaxWords    int     `json:"max_words"`
+	StdDevWords float64 `json:"stddev_words"`
+}
+
+// Sentence offsets are in characters (runes) into the analyzed text, so an
+// editor can highlight them directly.
+type Sentence struct {
+	Index int    `json:"index"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+	Words int    `json:"words"`
+}
+
+// Finding is one issue. Sentence is -1 for findings about the whole text;
+// Start and End are character offsets of the flagged span.
+type Finding struct {
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Sentence int    `json:"sentence"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Term     string `json:"term,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Grade ranges that count as on target for each reading level.
+var readingLevelGrades = map[string][2]float64{
+	models.ReadingLevelSimple:    {0, 7},
+	models.ReadingLevelGeneral:   {5, 10},
+	models.ReadingLevelAdvanced:  {9, 14},
+	models.ReadingLevelTechnical: {12, 99},
+}
+
+var (
+	sentencePattern    = regexp.MustCompile(`[^.!?\n]+(?:[.!?]+["')\]]*|\n|$)`)
+	wordPattern        = regexp.MustCompile(`[\p{L}\p{N}]+(?:['’][\p{L}]+)*`)
+	contractionPattern = regexp.MustCompile(`(?i)\b(?:[\p{L}]+['’](?:t|re|ve|ll|d|m)|(?:it|that|what|there|here|he|she|let|who|where)['’]s)\b`)
+	slangWords         = map[string]bool{
+		"gonna": true, "wanna": true, "gotta": true, "kinda": true, "sorta": true,
+		"awesome": true, "cool": true, "hey": true, "guys": true, "stuff": true,
+		"yeah": true, "yep": true, "nope": true, "lol": true, "btw": true, "super": true,
+	}
+)
+
+// AnalyzeText scores text against a brand tone: banned terms, emoji policy,
+// formality and reading level against their targets, sentence length and a
+// model-judged tone rating. The rating is best effort; if the model is
+// unavailable the heuristic score is returned alone.
+func (bs *BrandService) AnalyzeText(ctx context.Context, brandToneID, userID uuid.UUID, text string) (*BrandAnalysis, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, invalidInput("text is required")
+	}
+	if len(text) > maxAnalysisLength {
+		return nil, invalidInput(fmt.Sprintf("text must be at most %d characters", maxAnalysisLength))
+	}
+
+	brandTone, err := bs.GetBrandToneByID(brandToneID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := analyzeText(brandTone, text)
+
+	rating, err := bs.rateTone(ctx, userID, brandTone, text)
+	if err != nil {
+		analysis.ToneRatingError = err.Error()
+	} else {
+		analysis.ToneRating = rating
+		analysis.Score = int(math.Round(0.6*float64(analysis.Score) + 0.4*float64(rating.Rating*10)))
+	}
+
+	return analysis, nil
+}
+
+// analyzeText runs the deterministic checks and computes the heuristic score.
+func analyzeText(brandTone *models.BrandTone, text string) *BrandAnalysis {
+	settings := brandTone.Settings
+	runes := []rune(text)
+	sentences := splitSentences(runes)
+
+	analysis := &BrandAnalysis{
+		BrandToneID: brandTone.ID,
+		Sentences:   sentences,
+		Findings:    []Finding{},
+	}
+
+	maxWords := 35
+	if settings.ReadingLevel == models.ReadingLevelSimple {
+		maxWords = 20
+	}
+
+	bannedPatterns := make(map[string]*regexp.Regexp, len(settings.BannedTerms))
+	for _, term := range settings.BannedTerms {
+		bannedPatterns[term] = termPattern(term)
+	}
+
+	var totalWords, totalSyllables, informalMarkers int
+	for _, s := range sentences {
+		sentenceRunes := runes[s.Start:s.End]
+		for _, w := range wordPattern.FindAllString(s.Text, -1) {
+			totalSyllables += countSyllables(w)
+			if slangWords[strings.ToLower(w)] {
+				informalMarkers++
+			}
+		}
+		totalWords += s.Words
+
+		for _, term := range settings.BannedTerms {
+			for _, loc := range findTerm(s.Text, bannedPatterns[term]) {
+				analysis.Findings = append(analysis.Findings, Finding{
+					Type:     FindingBannedTerm,
+					Severity: SeverityError,
+					Sentence: s.Index,
+					Start:    s.Start + loc[0],
+					End:      s.Start + loc[1],
+					Term:     term,
+					Message:  "\"" + term + "\" is a banned term",
+				})
+			}
+		}
+
+		emoji := emojiSpans(sentenceRunes)
+		informalMarkers += len(emoji)
+		if settings.EmojiPolicy == models.EmojiNone {
+			for _, loc := range emoji {
+				analysis.Findings = append(analysis.Findings, Finding{
+					Type:     FindingEmoji,
+					Severity: SeverityError,
+					Sentence: s.Index,
+					Start:    s.Start + loc[0],
+					End:      s.Start + loc[1],
+					Message:  "emoji are not allowed in this brand tone",
+				})
+			}
+		}
+
+		contractions := runeSpans(s.Text, contractionPattern)
+		informalMarkers += len(contractions)
+		if strings.Contains(s.Text, "!") {
+			informalMarkers++
+		}
+		if settings.Formality == models.FormalityFormal {
+			for _, loc := range contractions {
+				analysis.Findings = append(analysis.Findings, Finding{
+					Type:     FindingFormality,
+					Severity: SeverityWarning,
+					Sentence: s.Index,
+					Start:    s.Start + loc[0],
+					End:      s.Start + loc[1],
+					Term:     string(sentenceRunes[loc[0]:loc[1]]),
+					Message:  "contractions read as informal",
+				})
+			}
+		}
+
+		if s.Words > maxWords {
+			analysis.Findings = append(analysis.Findings, Finding{
+				Type:     FindingSentenceLength,
+				Severity: SeverityWarning,
+				Sentence: s.Index,
+				Start:    s.Start,
+				End:      s.End,
+				Message:  fmt.Sprintf("sentence has %d words; aim for %d or fewer", s.Words, maxWords),
+			})
+		}
+	}
+
+	analysis.SentenceStats = sentenceStats(sentences, totalWords)
+	analysis.ReadingLevel = readingLevel(len(sentences), totalWords, totalSyllables, settings.ReadingLevel)
+	analysis.Formality = formality(totalWords, informalMarkers, settings.Formality)
+
+	if !analysis.ReadingLevel.OnTarget {
+		analysis.Findings = append(analysis.Findings, Finding{
+			Type:     FindingReadingLevel,
+			Severity: SeverityWarning,
+			Sentence: -1,
+			Message:  fmt.Sprintf("reads at grade %.1f (%s); target is %s", analysis.ReadingLevel.Grade, analysis.ReadingLevel.Level, settings.ReadingLevel),
+		})
+	}
+	if !analysis.Formality.OnTarget {
+		analysis.Findings = append(analysis.Findings, Finding{
+			Type:     FindingFormality,
+			Severity: SeverityWarning,
+			Sentence: -1,
+			Message:  "reads as " + analysis.Formality.Level + "; target is " + settings.Formality,
+		})
+	}
+
+	analysis.Score = heuristicScore(analysis)
+	return analysis
+}
+
+// heuristicScore starts at 100 and deducts per finding, weighted by how
+// clearly each one breaks the brand tone.
+func heuristicScore(analysis *BrandAnalysis) int {
+	score := 100
+	for _, f := range analysis.Findings {
+		switch {
+		case f.Type == FindingBannedTerm:
+			score -= 10
+		case f.Type == FindingEmoji:
+			score -= 5
+		case f.Sentence == -1:
+			score -= 15
+		default:
+			score -= 3
+		}
+	}
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// rateTone asks the model for a 1-10 rating of how well text fits the tone.
+func (bs *BrandService) rateTone(ctx context.Context, userID uuid.UUID, brandTone *models.BrandTone, text string) (*ToneRating, error) {
+	prompt := fmt.Sprintf(`You are a brand editor. Rate from 1 to 10 how well the text below matches the brand tone.
+Reply with only JSON in the form {"rating": <1-10>, "explanation": "<one or two sentences>"}.
+
+Brand tone:
+%s
+
+Text:
+%s`, brandToneInstructions(brandTone), text)
+
+	output, err := bs.ai.GenerateContent(AIRequest{Prompt: prompt, Action: "analyze", UserID: userID, TeamID: brandTone.TeamID, Ctx: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := strings.Index(output, "{"), strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("tone rating response was not JSON")
+	}
+
+	var rating ToneRating
+	if err := json.Unmarshal([]byte(output[start:end+1]), &rating); err != nil {
+		return nil, fmt.Errorf("tone rating response was not JSON: %w", err)
+	}
+	if rating.Rating < 1 || rating.Rating > 10 {
+		return nil, fmt.Errorf("tone rating %d is out of range", rating.Rating)
+	}
+	return &rating, nil
+}
+
+func splitSentences(runes []rune) []Sentence {
+	text := string(runes)
+	var sentences []Sentence
+	for _, loc := range sentencePattern.FindAllStringIndex(text, -1) {
+		raw := text[loc[0]:loc[1]]
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "" {
+			continue
+		}
+		lead := len(raw) - len(strings.TrimLeftFunc(raw, unicode.IsSpace))
+		start := len([]rune(text[:loc[0]+lead]))
+		sentences = append(sentences, Sentence{
+			Index: len(sentences),
+			Start: start,
+			End:   start + len([]rune(trimmed)),
+			Text:  trimmed,
+			Words: len(wordPattern.FindAllString(trimmed, -1)),
+		})
+	}
+	return sentences
+}
+
+func sentenceStats(sentences []Sentence, totalWords int) SentenceStats {
+	stats := SentenceStats{Count: len(sentences), Words: totalWords}
+	if len(sentences) == 0 {
+		return stats
+	}
+
+	lengths := make([]int, len(sentences))
+	for i, s := range sentences {
+		lengths[i] = s.Words
+		if s.Words > stats.MaxWords {
+			stats.MaxWords = s.Words
+		}
+	}
+	sort.Ints(lengths)
+
+	mean := float64(totalWords) / float64(len(lengths))
+	var variance float64
+	for _, l := range lengths {
+		variance += (float64(l) - mean) * (float64(l) - mean)
+	}
+	mid := len(lengths) / 2
+	median := float64(lengths[mid])
+	if len(lengths)%2 == 0 {
+		median = float64(lengths[mid-1]+lengths[mid]) / 2
+	}
+
+	stats.MeanWords = round1(mean)
+	stats.MedianWords = median
+	stats.StdDevWords = round1(math.Sqrt(variance / float64(len(lengths))))
+	return stats
+}
+
+func readingLevel(sentences, words, syllables int, target string) ReadingLevelResult {
+	result := ReadingLevelResult{Target: target, OnTarget: true}
+	if sentences == 0 || words == 0 {
+		result.Level = models.ReadingLevelSimple
+		return result
+	}
+
+	grade := 0.39*float64(words)/float64(sentences) + 11.8*float64(syllables)/float64(words) - 15.59
+	result.Grade = round1(math.Max(grade, 0))
+	switch {
+	case result.Grade < 6:
+		result.Level = models.ReadingLevelSimple
+	case result.Grade < 10:
+		result.Level = models.ReadingLevelGeneral
+	case result.Grade < 13:
+		result.Level = models.ReadingLevelAdvanced
+	default:
+		result.Level = models.ReadingLevelTechnical
+	}
+	if bounds, ok := readingLevelGrades[target]; ok {
+		result.OnTarget = result.Grade >= bounds[0] && result.Grade <= bounds[1]
+	}
+	return result
+}
+
+// formality scores by the density of informal markers: contractions, slang,
+// exclamations and emoji. Ten markers per hundred words scores zero.
+func formality(words, informalMarkers int, target string) FormalityResult {
+	result := FormalityResult{Score: 100, Target: target, OnTarget: true}
+	if words > 0 {
+		per100 := float64(informalMarkers) * 100 / float64(words)
+		result.Score = int(math.Max(0, math.Round(100-per100*10)))
+	}
+
+	switch {
+	case result.Score >= 75:
+		result.Level = models.FormalityFormal
+	case result.Score >= 45:
+		result.Level = models.FormalityNeutral
+	default:
+		result.Level = models.FormalityCasual
+	}
+
+	switch target {
+	case models.FormalityFormal:
+		result.OnTarget = result.Level == models.FormalityFormal
+	case models.FormalityNeutral:
+		result.OnTarget = result.Level != models.FormalityCasual
+	case models.FormalityCasual:
+		result.OnTarget = result.Level != models.FormalityFormal
+	}
+	return result
+}
+
+// termPattern matches term as a whole word or phrase, ignoring case. The
+// term itself is the second capture group.
+func termPattern(term string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(^|[^\p{L}\p{N}])(` + regexp.QuoteMeta(term) + `)($|[^\p{L}\p{N}])`)
+}
+
+// findTerm returns rune offsets of the matches of a termPattern in text.
+func findTerm(text string, pattern *regexp.Regexp) [][2]int {
+	var spans [][2]int
+	for offset := 0; offset < len(text); {
+		loc := pattern.FindStringSubmatchIndex(text[offset:])
+		if loc == nil {
+			break
+		}
+		start, end := offset+loc[4], offset+loc[5]
+		spans = append(spans, [2]int{len([]rune(text[:start])), len([]rune(text[:end]))})
+		offset = end
+	}
+	return spans
+}
+
+func runeSpans(text string, pattern *regexp.Regexp) [][2]int {
+	var spans [][2]int
+	for _, loc := range pattern.FindAllStringIndex(text, -1) {
+		spans = append(spans, [2]int{len([]rune(text[:loc[0]])), len([]rune(text[:loc[1]]))})
+	}
+	return spans
+}
+
+func emojiSpans(runes []rune) [][2]int {
+	var spans [][2]int
+	for i, r := range runes {
+		if isEmoji(r) {
+			spans = append(spans, [2]int{i, i + 1})
+		}
+	}
+	return spans
+}
+
+func isEmoji(r rune) bool {
+	return (r >= 0x1F300 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF) || (r >= 0x1F000 && r <= 0x1F2FF)
+}
+
+// countSyllables approximates syllables as vowel groups, ignoring a silent
+// trailing e.
+func countSyllables(word string) int {
+	word = strings.ToLower(word)
+	count := 0
+	prevVowel := false
+	for _, r := range word {
+		vowel := strings.ContainsRune("aeiouy", r)
+		if vowel && !prevVowel {
+			count++
+		}
+		prevVowel = vowel
+	}
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && count > 1 {
+		count--
+	}
+	if count == 0 {
+		return 1
+	}
+	return count
+}
+
+func round1(f float64) float64 {
+	return math.Round(f*10) / 10
+}
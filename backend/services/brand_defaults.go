@@ -0,0 +1,224 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Brand tone resolution sources, from most to least specific.
+const (
+	ToneSourceExplicit        = "explicit"
+	ToneSourceTeamContentType = "team_content_type"
+	ToneSourceTeamDefault     = "team_default"
+	ToneSourceUserContentType = "user_content_type"
+	ToneSourceUserDefault     = "user_default"
+	ToneSourceNone            = "none"
+)
+
+// ToneResolution explains which brand tone a generation used. Chain lists
+// every source that was consulted, in order, and what it yielded.
+type ToneResolution struct {
+	Source      string           `json:"source"`
+	BrandToneID *uuid.UUID       `json:"brand_tone_id,omitempty"`
+	Chain       []ResolutionStep `json:"chain"`
+}
+
+type ResolutionStep struct {
+	Source      string     `json:"source"`
+	BrandToneID *uuid.UUID `json:"brand_tone_id,omitempty"`
+	Result      string     `json:"result"` // used, not set, not found, no access
+}
+
+// ListBrandToneDefaults returns the user's own defaults, or a team's.
+func (bs *BrandService) ListBrandToneDefaults(userID uuid.UUID, teamID *uuid.UUID) ([]models.BrandToneDefault, error) {
+	query := bs.db.Preload("BrandTone")
+	if teamID != nil {
+		if err := bs.policy.AuthorizeTeam(userID, *teamID, PermBrandView); err != nil {
+			return nil, err
+		}
+		query = query.Where("team_id = ?", *teamID)
+	} else {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var defaults []models.BrandToneDefault
+	if err := query.Order("content_type").Find(&defaults).Error; err != nil {
+		return nil, err
+	}
+	return defaults, nil
+}
+
+// SetBrandToneDefault sets the default tone for the user, or for a team, for
+// one content type or (with an empty contentType) for all of them. Team
+// defaults must be one of the team's own tones.
+func (bs *BrandService) SetBrandToneDefault(userID uuid.UUID, teamID *uuid.UUID, contentType string, brandToneID uuid.UUID) (*models.BrandToneDefault, error) {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+
+	brandTone, err := bs.GetBrandToneByID(brandToneID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if teamID != nil {
+		if err := bs.policy.AuthorizeTeam(userID, *teamID, PermBrandEdit); err != nil {
+			return nil, err
+		}
+		if brandTone.TeamID == nil || *brandTone.TeamID != *teamID {
+			return nil, invalidInput("team defaults must use one of the team's brand tones")
+		}
+	}
+
+	existing, err := bs.findBrandToneDefault(userID, teamID, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		existing.BrandToneID = brandToneID
+		if err := bs.db.Save(existing).Error; err != nil {
+			return nil, err
+		}
+		existing.BrandTone = *brandTone
+		return existing, nil
+	}
+
+	def := &models.BrandToneDefault{ContentType: contentType, BrandToneID: brandToneID}
+	if teamID != nil {
+		def.TeamID = teamID
+	} else {
+		def.UserID = &userID
+	}
+	if err := bs.db.Create(def).Error; err != nil {
+		return nil, err
+	}
+	def.BrandTone = *brandTone
+	return def, nil
+}
+
+func (bs *BrandService) ClearBrandToneDefault(userID uuid.UUID, teamID *uuid.UUID, contentType string) error {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if teamID != nil {
+		if err := bs.policy.AuthorizeTeam(userID, *teamID, PermBrandEdit); err != nil {
+			return err
+		}
+	}
+
+	existing, err := bs.findBrandToneDefault(userID, teamID, contentType)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return notFound("no default set")
+	}
+	return bs.db.Delete(existing).Error
+}
+
+func (bs *BrandService) findBrandToneDefault(userID uuid.UUID, teamID *uuid.UUID, contentType string) (*models.BrandToneDefault, error) {
+	query := bs.db.Where("content_type = ?", contentType)
+	if teamID != nil {
+		query = query.Where("team_id = ?", *teamID)
+	} else {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var def models.BrandToneDefault
+	if err := query.First(&def).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &def, nil
+}
+
+// resolveBrandTone picks the tone for a generation. An explicit tone always
+// wins, and is an error if it is missing or the user cannot view it.
+// Otherwise, in a team workspace the team's defaults apply before the
+// user's own, and a content-type override before a general default. Defaults
+// pointing at tones the user can no longer see are skipped.
+func resolveBrandTone(db *gorm.DB, policy *PolicyService, userID uuid.UUID, brandToneID *uuid.UUID, contentType string, teamID *uuid.UUID) (*models.BrandTone, *ToneResolution, error) {
+	resolution := &ToneResolution{Source: ToneSourceNone, Chain: []ResolutionStep{}}
+
+	if brandToneID != nil {
+		brandTone, err := findVisibleBrandTone(db, policy, *brandToneID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		resolution.Source = ToneSourceExplicit
+		resolution.BrandToneID = brandToneID
+		resolution.Chain = append(resolution.Chain, ResolutionStep{Source: ToneSourceExplicit, BrandToneID: brandToneID, Result: "used"})
+		return brandTone, resolution, nil
+	}
+
+	if teamID != nil {
+		if err := policy.AuthorizeTeam(userID, *teamID, PermBrandView); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	query := db.Where("user_id = ?", userID)
+	if teamID != nil {
+		query = query.Or("team_id = ?", *teamID)
+	}
+	var defaults []models.BrandToneDefault
+	if err := db.Where(query).Where("content_type IN ?", []string{"", contentType}).Find(&defaults).Error; err != nil {
+		return nil, nil, err
+	}
+
+	find := func(team bool, ct string) *models.BrandToneDefault {
+		for i := range defaults {
+			if (defaults[i].TeamID != nil) == team && defaults[i].ContentType == ct {
+				return &defaults[i]
+			}
+		}
+		return nil
+	}
+
+	type candidate struct {
+		source string
+		def    *models.BrandToneDefault
+	}
+	var candidates []candidate
+	if teamID != nil {
+		if contentType != "" {
+			candidates = append(candidates, candidate{ToneSourceTeamContentType, find(true, contentType)})
+		}
+		candidates = append(candidates, candidate{ToneSourceTeamDefault, find(true, "")})
+	}
+	if contentType != "" {
+		candidates = append(candidates, candidate{ToneSourceUserContentType, find(false, contentType)})
+	}
+	candidates = append(candidates, candidate{ToneSourceUserDefault, find(false, "")})
+
+	for _, c := range candidates {
+		if c.def == nil {
+			resolution.Chain = append(resolution.Chain, ResolutionStep{Source: c.source, Result: "not set"})
+			continue
+		}
+
+		step := ResolutionStep{Source: c.source, BrandToneID: &c.def.BrandToneID}
+		var brandTone models.BrandTone
+		if err := db.First(&brandTone, c.def.BrandToneID).Error; err != nil {
+			step.Result = "not found"
+			resolution.Chain = append(resolution.Chain, step)
+			continue
+		}
+		if err := policy.Authorize(userID, brandTone.UserID, brandTone.TeamID, PermBrandView); err != nil {
+			step.Result = "no access"
+			resolution.Chain = append(resolution.Chain, step)
+			continue
+		}
+
+		step.Result = "used"
+		resolution.Chain = append(resolution.Chain, step)
+		resolution.Source = c.source
+		resolution.BrandToneID = &brandTone.ID
+		return &brandTone, resolution, nil
+	}
+
+	return nil, resolution, nil
+}
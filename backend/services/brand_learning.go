@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxLearnSamples      = 20
+	maxLearnSampleLength = 50000
+	learnedPreferred     = 10
+	learnedExcerpts      = 3
+	learnedExcerptLength = 600
+)
+
+// LearnedBrandTone is an unsaved brand tone drafted from samples, along with
+// the statistics it was derived from.
+type LearnedBrandTone struct {
+	BrandTone  models.BrandTone `json:"brand_tone"`
+	Stats      StyleStats       `json:"stats"`
+	ModelError string           `json:"model_error,omitempty"`
+}
+
+// StyleStats describes the writing style of a set of samples. Rates are per
+// 100 words or per 100 sentences as named.
+type StyleStats struct {
+	Samples             int                `json:"samples"`
+	Words               int                `json:"words"`
+	SentenceStats       SentenceStats      `json:"sentence_stats"`
+	ReadingLevel        ReadingLevelResult `json:"reading_level"`
+	Formality           FormalityResult    `json:"formality"`
+	VocabularyRichness  float64            `json:"vocabulary_richness"` // distinct words / words
+	MeanWordLength      float64            `json:"mean_word_length"`
+	ContractionsPer100W float64            `json:"contractions_per_100_words"`
+	EmojiPer100W        float64            `json:"emoji_per_100_words"`
+	SecondPersonPer100W float64            `json:"second_person_per_100_words"`
+	PunctuationPer100S  map[string]float64 `json:"punctuation_per_100_sentences"`
+	FrequentTerms       []string           `json:"frequent_terms"`
+}
+
+// stopWords are left out of frequent-term detection.
+var stopWords = wordSet(`a about above after again against all am an and any are as at be because been
+before being below between both but by can could did do does doing down during each few for from further
+had has have having he her here hers herself him himself his how i if in into is it its itself just me
+more most my myself no nor not now of off on once only or other our ours ourselves out over own same she
+should so some such than that the their theirs them themselves then there these they this those through
+to too under until up very was we were what when where which while who whom why will with would you your
+yours yourself yourselves also get got one new may us many much make made like well way even`)
+
+var secondPersonWords = wordSet("you your yours yourself yourselves")
+
+var punctuationMarks = map[string]string{
+	"exclamation":  "!",
+	"question":     "?",
+	"semicolon":    ";",
+	"colon":        ":",
+	"dash":         "—",
+	"parenthesis":  "(",
+	"ellipsis":     "...",
+	"double_quote": "\"",
+}
+
+// LearnBrandTone drafts a brand tone from stored content and pasted samples.
+// Statistics set the measurable settings; the model describes the voice and
+// audience. The draft is not saved, so it can be reviewed and edited first.
+func (bs *BrandService) LearnBrandTone(ctx context.Context, userID uuid.UUID, name string, contentIDs []uuid.UUID, samples []string) (*LearnedBrandTone, error) {
+	texts := make([]string, 0, len(contentIDs)+len(samples))
+	for _, contentID := range contentIDs {
+		var content models.Content
+		if err := bs.db.First(&content, contentID).Error; err != nil {
+			return nil, notFound("content " + contentID.String() + " not found")
+		}
+		if err := bs.policy.AuthorizeContent(userID, &content, PermContentView); err != nil {
+			return nil, err
+		}
+		texts = append(texts, content.Content)
+	}
+	texts = append(texts, samples...)
+
+	var nonEmpty []string
+	for _, t := range texts {
+		if t = strings.TrimSpace(t); t != "" {
+			if len(t) > maxLearnSampleLength {
+				return nil, invalidInput(fmt.Sprintf("samples must be at most %d characters", maxLearnSampleLength))
+			}
+			nonEmpty = append(nonEmpty, t)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return nil, invalidInput("at least one non-empty sample or content id is required")
+	}
+	if len(nonEmpty) > maxLearnSamples {
+		return nil, invalidInput(fmt.Sprintf("at most %d samples are allowed", maxLearnSamples))
+	}
+
+	stats := styleStats(nonEmpty)
+	learned := &LearnedBrandTone{Stats: stats}
+
+	settings := models.BrandToneSettings{
+		Formality:      stats.Formality.Level,
+		ReadingLevel:   stats.ReadingLevel.Level,
+		EmojiPolicy:    learnedEmojiPolicy(stats.EmojiPer100W),
+		PreferredTerms: stats.FrequentTerms,
+		SamplePassages: excerpts(nonEmpty),
+	}
+
+	description, err := bs.describeVoice(ctx, userID, stats, settings.SamplePassages)
+	if err != nil {
+		learned.ModelError = err.Error()
+		description = voiceSummary{Description: statsDescription(stats)}
+	}
+	settings.Voice = description.Voice
+	settings.TargetAudience = description.TargetAudience
+
+	settings, err = normalizeBrandToneSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(name) == "" {
+		name = "Learned brand tone"
+	}
+	learned.BrandTone = models.BrandTone{
+		UserID:      userID,
+		Name:        name,
+		Description: description.Description,
+		Settings:    settings,
+	}
+	return learned, nil
+}
+
+type voiceSummary struct {
+	Description    string `json:"description"`
+	Voice          string `json:"voice"`
+	TargetAudience string `json:"target_audience"`
+}
+
+// describeVoice asks the model to summarise the voice from the statistics
+// and representative excerpts.
+func (bs *BrandService) describeVoice(ctx context.Context, userID uuid.UUID, stats StyleStats, passages []string) (voiceSummary, error) {
+	statsJSON, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return voiceSummary{}, err
+	}
+
+	prompt := fmt.Sprintf(`You are a brand strategist. From the writing statistics and excerpts below, describe the brand voice so another writer could imitate it.
+Reply with only JSON in the form {"description": "<2-4 sentences of style guidance>", "voice": "<3-5 comma-separated adjectives>", "target_audience": "<who the writing is for>"}.
+
+Statistics:
+%s
+
+Excerpts:
+---
+%s
+---`, statsJSON, strings.Join(passages, "\n---\n"))
+
+	output, err := bs.ai.GenerateContent(AIRequest{Prompt: prompt, Action: "learn", UserID: userID, Ctx: ctx})
+	if err != nil {
+		return voiceSummary{}, err
+	}
+
+	start, end := strings.Index(output, "{"), strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return voiceSummary{}, fmt.Errorf("voice summary response was not JSON")
+	}
+
+	var summary voiceSummary
+	if err := json.Unmarshal([]byte(output[start:end+1]), &summary); err != nil {
+		return voiceSummary{}, fmt.Errorf("voice summary response was not JSON: %w", err)
+	}
+	if strings.TrimSpace(summary.Description) == "" {
+		return voiceSummary{}, fmt.Errorf("voice summary response had no description")
+	}
+	return summary, nil
+}
+
+func styleStats(texts []string) StyleStats {
+	stats := StyleStats{
+		Samples:            len(texts),
+		PunctuationPer100S: make(map[string]float64),
+	}
+
+	var sentences []Sentence
+	var syllables, letters, contractions, emoji, secondPerson int
+	counts := make(map[string]int)
+	docFreq := make(map[string]int)
+	display := make(map[string]string)
+	punctuation := make(map[string]int)
+
+	for _, text := range texts {
+		runes := []rune(text)
+		seen := make(map[string]bool)
+		for _, s := range splitSentences(runes) {
+			s.Index = len(sentences)
+			sentences = append(sentences, s)
+		}
+		for _, w := range wordPattern.FindAllString(text, -1) {
+			stats.Words++
+			syllables += countSyllables(w)
+			letters += len([]rune(w))
+
+			key := strings.ToLower(w)
+			if base, _, _ := strings.Cut(strings.ReplaceAll(key, "’", "'"), "'"); secondPersonWords[base] {
+				secondPerson++
+			}
+			if stopWords[key] || len([]rune(key)) < 4 || strings.ContainsAny(key, "0123456789'’") {
+				continue
+			}
+			counts[key]++
+			if _, ok := display[key]; !ok {
+				display[key] = w
+			}
+			if !seen[key] {
+				seen[key] = true
+				docFreq[key]++
+			}
+		}
+		contractions += len(contractionPattern.FindAllStringIndex(text, -1))
+		emoji += len(emojiSpans(runes))
+		for name, mark := range punctuationMarks {
+			punctuation[name] += strings.Count(text, mark)
+		}
+	}
+
+	informal := contractions + emoji + punctuation["exclamation"]
+	for _, s := range sentences {
+		for _, w := range wordPattern.FindAllString(s.Text, -1) {
+			if slangWords[strings.ToLower(w)] {
+				informal++
+			}
+		}
+	}
+
+	stats.SentenceStats = sentenceStats(sentences, stats.Words)
+	stats.ReadingLevel = readingLevel(len(sentences), stats.Words, syllables, "")
+	stats.Formality = formality(stats.Words, informal, "")
+	if stats.Words > 0 {
+		per100 := 100 / float64(stats.Words)
+		stats.VocabularyRichness = math.Round(float64(distinctWords(texts))/float64(stats.Words)*100) / 100
+		stats.MeanWordLength = round1(float64(letters) / float64(stats.Words))
+		stats.ContractionsPer100W = round1(float64(contractions) * per100)
+		stats.EmojiPer100W = round1(float64(emoji) * per100)
+		stats.SecondPersonPer100W = round1(float64(secondPerson) * per100)
+	}
+	if len(sentences) > 0 {
+		for name, count := range punctuation {
+			stats.PunctuationPer100S[name] = round1(float64(count) * 100 / float64(len(sentences)))
+		}
+	}
+
+	stats.FrequentTerms = frequentTerms(counts, docFreq, display, len(texts))
+	return stats
+}
+
+// frequentTerms picks the most used content words. With several samples a
+// term must appear in at least two, so one document's topic doesn't dominate.
+func frequentTerms(counts, docFreq map[string]int, display map[string]string, samples int) []string {
+	var terms []string
+	for term, count := range counts {
+		if count < 2 || (samples > 1 && docFreq[term] < 2) {
+			continue
+		}
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if counts[terms[i]] != counts[terms[j]] {
+			return counts[terms[i]] > counts[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	if len(terms) > learnedPreferred {
+		terms = terms[:learnedPreferred]
+	}
+	for i, term := range terms {
+		terms[i] = display[term]
+	}
+	return terms
+}
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+func distinctWords(texts []string) int {
+	distinct := make(map[string]bool)
+	for _, text := range texts {
+		for _, w := range wordPattern.FindAllString(text, -1) {
+			distinct[strings.ToLower(w)] = true
+		}
+	}
+	return len(distinct)
+}
+
+func learnedEmojiPolicy(per100 float64) string {
+	switch {
+	case per100 == 0:
+		return models.EmojiNone
+	case per100 < 1:
+		return models.EmojiSparing
+	default:
+		return models.EmojiEncouraged
+	}
+}
+
+// excerpts takes the opening of the first few samples as sample passages,
+// cut at a sentence boundary where possible.
+func excerpts(texts []string) []string {
+	var passages []string
+	for _, text := range texts {
+		if len(passages) == learnedExcerpts {
+			break
+		}
+		runes := []rune(text)
+		if len(runes) <= learnedExcerptLength {
+			passages = append(passages, text)
+			continue
+		}
+		cut := learnedExcerptLength
+		for _, s := range splitSentences(runes) {
+			if s.End > learnedExcerptLength {
+				break
+			}
+			cut = s.End
+		}
+		passages = append(passages, string(runes[:cut]))
+	}
+	return passages
+}
+
+// statsDescription is the fallback description when the model is unavailable.
+func statsDescription(stats StyleStats) string {
+	return fmt.Sprintf("%s, %s-reading prose with sentences averaging %.0f words.",
+		capitalize(stats.Formality.Level), stats.ReadingLevel.Level, stats.SentenceStats.MeanWords)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
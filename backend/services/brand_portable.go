@@ -0,0 +1,392 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Identifiers written into every export so imports can reject foreign files
+// and future format changes.
+const (
+	BrandToneBundleFormat  = "inscribeai.brand_tones"
+	BrandToneBundleVersion = 1
+)
+
+// Conflict modes for importing a tone whose name is already taken.
+const (
+	ImportSkip      = "skip"
+	ImportOverwrite = "overwrite"
+	ImportRename    = "rename"
+)
+
+// Per-tone outcomes in an ImportReport.
+const (
+	ImportCreated     = "created"
+	ImportOverwritten = "overwritten"
+	ImportRenamed     = "renamed"
+	ImportSkipped     = "skipped"
+	ImportInvalid     = "invalid"
+)
+
+const maxImportBrandTones = 100
+
+// BrandToneBundle is the portable export format. It carries no IDs, so a
+// bundle can be imported into any instance or workspace.
+type BrandToneBundle struct {
+	Format     string              `json:"format" yaml:"format"`
+	Version    int                 `json:"version" yaml:"version"`
+	ExportedAt time.Time           `json:"exported_at" yaml:"exported_at"`
+	BrandTones []PortableBrandTone `json:"brand_tones" yaml:"brand_tones"`
+}
+
+type PortableBrandTone struct {
+	Name        string                   `json:"name" yaml:"name"`
+	Description string                   `json:"description,omitempty" yaml:"description,omitempty"`
+	Settings    models.BrandToneSettings `json:"settings" yaml:"settings"`
+	Glossary    []PortableGlossaryTerm   `json:"glossary,omitempty" yaml:"glossary,omitempty"`
+}
+
+type PortableGlossaryTerm struct {
+	Term              string   `json:"term" yaml:"term"`
+	PreferredForm     string   `json:"preferred_form,omitempty" yaml:"preferred_form,omitempty"`
+	ForbiddenVariants []string `json:"forbidden_variants,omitempty" yaml:"forbidden_variants,omitempty"`
+	Notes             string   `json:"notes,omitempty" yaml:"notes,omitempty"`
+}
+
+// ImportReport says what an import did, or with DryRun what it would do.
+// Nothing is written unless every tone in the bundle is valid.
+type ImportReport struct {
+	DryRun      bool           `json:"dry_run"`
+	Applied     bool           `json:"applied"`
+	Mode        string         `json:"mode"`
+	Created     int            `json:"created"`
+	Overwritten int            `json:"overwritten"`
+	Renamed     int            `json:"renamed"`
+	Skipped     int            `json:"skipped"`
+	Invalid     int            `json:"invalid"`
+	Results     []ImportResult `json:"results"`
+}
+
+type ImportResult struct {
+	Index       int        `json:"index"`
+	Name        string     `json:"name"`
+	Action      string     `json:"action"`
+	ImportedAs  string     `json:"imported_as,omitempty"`
+	BrandToneID *uuid.UUID `json:"brand_tone_id,omitempty"`
+	Errors      []string   `json:"errors,omitempty"`
+}
+
+// DecodeBrandToneBundle parses a JSON or YAML bundle, rejecting unknown
+// fields and bundles from other formats or newer versions.
+func DecodeBrandToneBundle(data []byte, format string) (*BrandToneBundle, error) {
+	var bundle BrandToneBundle
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&bundle); err != nil {
+			return nil, invalidInput("invalid YAML bundle: " + err.Error())
+		}
+	case "", "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&bundle); err != nil {
+			return nil, invalidInput("invalid JSON bundle: " + err.Error())
+		}
+	default:
+		return nil, invalidInput("format must be json or yaml")
+	}
+
+	if bundle.Format != BrandToneBundleFormat {
+		return nil, invalidInput("format must be \"" + BrandToneBundleFormat + "\"")
+	}
+	if bundle.Version < 1 || bundle.Version > BrandToneBundleVersion {
+		return nil, invalidInput(fmt.Sprintf("unsupported bundle version %d", bundle.Version))
+	}
+	if len(bundle.BrandTones) == 0 {
+		return nil, invalidInput("bundle has no brand tones")
+	}
+	if len(bundle.BrandTones) > maxImportBrandTones {
+		return nil, invalidInput(fmt.Sprintf("at most %d brand tones can be imported at once", maxImportBrandTones))
+	}
+	return &bundle, nil
+}
+
+// ExportBrandTones bundles the given tones, or every tone the user can see
+// when brandToneIDs is empty, with their own glossary terms. Team glossary
+// terms belong to the team and are not exported.
+func (bs *BrandService) ExportBrandTones(userID uuid.UUID, brandToneIDs []uuid.UUID) (*BrandToneBundle, error) {
+	var brandTones []models.BrandTone
+	if len(brandToneIDs) == 0 {
+		var err error
+		if brandTones, err = bs.ListBrandTones(userID); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, id := range brandToneIDs {
+			brandTone, err := bs.GetBrandToneByID(id, userID)
+			if err != nil {
+				return nil, err
+			}
+			brandTones = append(brandTones, *brandTone)
+		}
+	}
+
+	ids := make([]uuid.UUID, len(brandTones))
+	for i, t := range brandTones {
+		ids[i] = t.ID
+	}
+	var terms []models.GlossaryTerm
+	if len(ids) > 0 {
+		if err := bs.db.Where("brand_tone_id IN ?", ids).Order("term").Find(&terms).Error; err != nil {
+			return nil, err
+		}
+	}
+	glossaries := make(map[uuid.UUID][]PortableGlossaryTerm)
+	for _, t := range terms {
+		glossaries[*t.BrandToneID] = append(glossaries[*t.BrandToneID], PortableGlossaryTerm{
+			Term:              t.Term,
+			PreferredForm:     t.PreferredForm,
+			ForbiddenVariants: t.ForbiddenVariants,
+			Notes:             t.Notes,
+		})
+	}
+
+	bundle := &BrandToneBundle{
+		Format:     BrandToneBundleFormat,
+		Version:    BrandToneBundleVersion,
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		BrandTones: []PortableBrandTone{},
+	}
+	for _, t := range brandTones {
+		bundle.BrandTones = append(bundle.BrandTones, PortableBrandTone{
+			Name:        t.Name,
+			Description: t.Description,
+			Settings:    t.Settings,
+			Glossary:    glossaries[t.ID],
+		})
+	}
+	return bundle, nil
+}
+
+// importPlan is a validated tone from a bundle and what to do with it.
+type importPlan struct {
+	result   *ImportResult
+	name     string
+	tone     PortableBrandTone
+	terms    []models.GlossaryTerm
+	existing *models.BrandTone
+}
+
+// ImportBrandTones adds a bundle's tones to the user's personal tones or to
+// a team. Names are matched case-insensitively against tones already in that
+// workspace and conflicts are handled according to mode. The import is all
+// or nothing: if any tone is invalid, or with dryRun, the report is returned
+// without writing anything.
+func (bs *BrandService) ImportBrandTones(userID uuid.UUID, teamID *uuid.UUID, bundle *BrandToneBundle, mode string, dryRun bool) (*ImportReport, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		mode = ImportSkip
+	}
+	if err := checkOneOf("mode", mode, ImportSkip, ImportOverwrite, ImportRename); err != nil {
+		return nil, err
+	}
+	if teamID != nil {
+		if err := bs.policy.AuthorizeTeam(userID, *teamID, PermBrandCreate); err != nil {
+			return nil, err
+		}
+	}
+
+	var existing []models.BrandTone
+	query := bs.db.Where("user_id = ? AND team_id IS NULL", userID)
+	if teamID != nil {
+		query = bs.db.Where("team_id = ?", *teamID)
+	}
+	if err := query.Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*models.BrandTone, len(existing))
+	taken := make(map[string]bool, len(existing))
+	for i := range existing {
+		key := strings.ToLower(existing[i].Name)
+		byName[key] = &existing[i]
+		taken[key] = true
+	}
+
+	report := &ImportReport{DryRun: dryRun, Mode: mode, Results: make([]ImportResult, len(bundle.BrandTones))}
+	var plans []importPlan
+	inBundle := make(map[string]bool)
+	for i, tone := range bundle.BrandTones {
+		result := &report.Results[i]
+		*result = ImportResult{Index: i, Name: tone.Name}
+
+		terms, errs := validatePortableBrandTone(&tone)
+		key := strings.ToLower(tone.Name)
+		if tone.Name != "" && inBundle[key] {
+			errs = append(errs, "another brand tone in the bundle has this name")
+		}
+		inBundle[key] = true
+
+		plan := importPlan{result: result, name: tone.Name, tone: tone, terms: terms}
+		if len(errs) == 0 {
+			switch match := byName[key]; {
+			case match == nil:
+				result.Action = ImportCreated
+			case mode == ImportSkip:
+				result.Action = ImportSkipped
+				result.BrandToneID = &match.ID
+			case mode == ImportOverwrite:
+				if err := bs.policy.Authorize(userID, match.UserID, match.TeamID, PermBrandEdit); err != nil {
+					errs = append(errs, err.Error())
+					break
+				}
+				result.Action = ImportOverwritten
+				result.BrandToneID = &match.ID
+				plan.existing = match
+			case mode == ImportRename:
+				plan.name = uniqueBrandToneName(tone.Name, taken)
+				result.Action = ImportRenamed
+				result.ImportedAs = plan.name
+			}
+		}
+		if len(errs) > 0 {
+			result.Action = ImportInvalid
+			result.Errors = errs
+			report.Invalid++
+			continue
+		}
+
+		taken[strings.ToLower(plan.name)] = true
+		switch result.Action {
+		case ImportCreated:
+			report.Created++
+		case ImportOverwritten:
+			report.Overwritten++
+		case ImportRenamed:
+			report.Renamed++
+		case ImportSkipped:
+			report.Skipped++
+			continue
+		}
+		plans = append(plans, plan)
+	}
+
+	if dryRun || report.Invalid > 0 || len(plans) == 0 {
+		return report, nil
+	}
+
+	var imported []*models.BrandTone
+	err := bs.db.Transaction(func(tx *gorm.DB) error {
+		imported = nil
+		for _, p := range plans {
+			brandTone, err := applyImportPlan(tx, userID, teamID, p)
+			if err != nil {
+				return err
+			}
+			p.result.BrandToneID = &brandTone.ID
+			imported = append(imported, brandTone)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Applied = true
+
+	for i, brandTone := range imported {
+		if plans[i].existing != nil {
+			bs.recordActivity(userID, VerbBrandToneUpdated, brandTone, "overwrote brand tone \""+brandTone.Name+"\" from an import")
+		} else {
+			bs.recordActivity(userID, VerbBrandToneCreated, brandTone, "imported brand tone \""+brandTone.Name+"\"")
+		}
+	}
+	return report, nil
+}
+
+// validatePortableBrandTone normalizes a tone in place and returns its
+// glossary as unsaved terms, collecting every problem rather than the first.
+func validatePortableBrandTone(tone *PortableBrandTone) ([]models.GlossaryTerm, []string) {
+	var errs []string
+	tone.Name = strings.TrimSpace(tone.Name)
+	tone.Description = strings.TrimSpace(tone.Description)
+	if tone.Name == "" {
+		errs = append(errs, "name is required")
+	}
+
+	settings, err := normalizeBrandToneSettings(tone.Settings)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	tone.Settings = settings
+
+	terms := make([]models.GlossaryTerm, len(tone.Glossary))
+	for i, g := range tone.Glossary {
+		if err := setGlossaryFields(&terms[i], g.Term, g.PreferredForm, g.ForbiddenVariants, g.Notes); err != nil {
+			errs = append(errs, fmt.Sprintf("glossary[%d]: %s", i, err.Error()))
+		}
+	}
+	return terms, errs
+}
+
+func applyImportPlan(tx *gorm.DB, userID uuid.UUID, teamID *uuid.UUID, p importPlan) (*models.BrandTone, error) {
+	brandTone := p.existing
+	if brandTone == nil {
+		brandTone = &models.BrandTone{UserID: userID, TeamID: teamID}
+	}
+
+	changed := brandTone.ID == uuid.Nil ||
+		brandToneDiffSummary(brandTone, p.name, p.tone.Description, p.tone.Settings) != "no changes"
+	if brandTone.ID != uuid.Nil && brandTone.Version == 0 && changed {
+		if err := createBrandToneVersion(tx, brandTone, brandTone.UserID, ""); err != nil {
+			return nil, err
+		}
+	}
+	brandTone.Name = p.name
+	brandTone.Description = p.tone.Description
+	brandTone.Settings = p.tone.Settings
+
+	if brandTone.ID == uuid.Nil {
+		if err := tx.Create(brandTone).Error; err != nil {
+			return nil, err
+		}
+	}
+	if changed {
+		if err := createBrandToneVersion(tx, brandTone, userID, "imported"); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Save(brandTone).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("brand_tone_id = ?", brandTone.ID).Delete(&models.GlossaryTerm{}).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range p.terms {
+		t.BrandToneID = &brandTone.ID
+		t.CreatedBy = userID
+		if err := tx.Create(&t).Error; err != nil {
+			return nil, err
+		}
+	}
+	return brandTone, nil
+}
+
+// uniqueBrandToneName appends " (2)", " (3)", ... until the name is free.
+func uniqueBrandToneName(name string, taken map[string]bool) string {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		if !taken[strings.ToLower(candidate)] {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BrandToneDiff lists the fields that differ between two versions.
+type BrandToneDiff struct {
+	BrandToneID uuid.UUID     `json:"brand_tone_id"`
+	From        int           `json:"from"`
+	To          int           `json:"to"`
+	Changes     []FieldChange `json:"changes"`
+}
+
+// FieldChange is one changed field. Text fields report From and To; list
+// fields report the entries Added and Removed.
+type FieldChange struct {
+	Field   string   `json:"field"`
+	From    string   `json:"from,omitempty"`
+	To      string   `json:"to,omitempty"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+func (bs *BrandService) ListBrandToneVersions(brandToneID, userID uuid.UUID) ([]models.BrandToneVersion, error) {
+	if _, err := bs.GetBrandToneByID(brandToneID, userID); err != nil {
+		return nil, err
+	}
+
+	var versions []models.BrandToneVersion
+	if err := bs.db.Where("brand_tone_id = ?", brandToneID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (bs *BrandService) GetBrandToneVersion(brandToneID, userID uuid.UUID, version int) (*models.BrandToneVersion, error) {
+	if _, err := bs.GetBrandToneByID(brandToneID, userID); err != nil {
+		return nil, err
+	}
+	return findBrandToneVersion(bs.db, brandToneID, version)
+}
+
+// RollbackBrandTone makes an earlier version current again. History stays
+// immutable: the rollback is written as a new version copying the old one.
+func (bs *BrandService) RollbackBrandTone(brandToneID, userID uuid.UUID, version int) (*models.BrandTone, error) {
+	brandTone, err := bs.findBrandTone(brandToneID)
+	if err != nil {
+		return nil, err
+	}
+	if err := bs.policy.Authorize(userID, brandTone.UserID, brandTone.TeamID, PermBrandEdit); err != nil {
+		return nil, err
+	}
+	if version == brandTone.Version {
+		return nil, conflict("version " + strconv.Itoa(version) + " is already current")
+	}
+
+	target, err := findBrandToneVersion(bs.db, brandToneID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bs.db.Transaction(func(tx *gorm.DB) error {
+		brandTone.Name = target.Name
+		brandTone.Description = target.Description
+		brandTone.Settings = target.Settings
+		note := "rolled back to version " + strconv.Itoa(version)
+		if err := createBrandToneVersion(tx, brandTone, userID, note); err != nil {
+			return err
+		}
+		return tx.Save(brandTone).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bs.recordActivity(userID, VerbBrandToneUpdated, brandTone, "rolled back to version "+strconv.Itoa(version))
+	return brandTone, nil
+}
+
+func (bs *BrandService) DiffBrandToneVersions(brandToneID, userID uuid.UUID, from, to int) (*BrandToneDiff, error) {
+	if _, err := bs.GetBrandToneByID(brandToneID, userID); err != nil {
+		return nil, err
+	}
+
+	fromVersion, err := findBrandToneVersion(bs.db, brandToneID, from)
+	if err != nil {
+		return nil, err
+	}
+	toVersion, err := findBrandToneVersion(bs.db, brandToneID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &BrandToneDiff{BrandToneID: brandToneID, From: from, To: to, Changes: []FieldChange{}}
+	a, b := fromVersion.Settings, toVersion.Settings
+	texts := []struct {
+		field    string
+		from, to string
+	}{
+		{"name", fromVersion.Name, toVersion.Name},
+		{"description", fromVersion.Description, toVersion.Description},
+		{"formality", a.Formality, b.Formality},
+		{"voice", a.Voice, b.Voice},
+		{"reading_level", a.ReadingLevel, b.ReadingLevel},
+		{"emoji_policy", a.EmojiPolicy, b.EmojiPolicy},
+		{"target_audience", a.TargetAudience, b.TargetAudience},
+	}
+	for _, t := range texts {
+		if t.from != t.to {
+			diff.Changes = append(diff.Changes, FieldChange{Field: t.field, From: t.from, To: t.to})
+		}
+	}
+
+	lists := []struct {
+		field    string
+		from, to []string
+	}{
+		{"preferred_terms", a.PreferredTerms, b.PreferredTerms},
+		{"banned_terms", a.BannedTerms, b.BannedTerms},
+		{"sample_passages", a.SamplePassages, b.SamplePassages},
+	}
+	for _, l := range lists {
+		added, removed := listDiff(l.from, l.to)
+		if len(added) > 0 || len(removed) > 0 {
+			diff.Changes = append(diff.Changes, FieldChange{Field: l.field, Added: added, Removed: removed})
+		}
+	}
+
+	return diff, nil
+}
+
+// createBrandToneVersion advances the tone's version number and snapshots
+// its current fields. The caller saves the tone.
+func createBrandToneVersion(tx *gorm.DB, brandTone *models.BrandTone, userID uuid.UUID, note string) error {
+	brandTone.Version++
+	return tx.Create(&models.BrandToneVersion{
+		BrandToneID: brandTone.ID,
+		Version:     brandTone.Version,
+		Name:        brandTone.Name,
+		Description: brandTone.Description,
+		Settings:    brandTone.Settings,
+		CreatedBy:   userID,
+		Note:        note,
+	}).Error
+}
+
+func findBrandToneVersion(db *gorm.DB, brandToneID uuid.UUID, version int) (*models.BrandToneVersion, error) {
+	var v models.BrandToneVersion
+	if err := db.Where("brand_tone_id = ? AND version = ?", brandToneID, version).First(&v).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound(fmt.Sprintf("version %d not found", version))
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+// brandToneAtVersion returns the tone as it was at version, for regenerating
+// content with the voice it was written in.
+func brandToneAtVersion(db *gorm.DB, brandTone *models.BrandTone, version int) (*models.BrandTone, error) {
+	if version == brandTone.Version {
+		return brandTone, nil
+	}
+
+	v, err := findBrandToneVersion(db, brandTone.ID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := *brandTone
+	pinned.Name = v.Name
+	pinned.Description = v.Description
+	pinned.Settings = v.Settings
+	pinned.Version = v.Version
+	return &pinned, nil
+}
+
+func listDiff(from, to []string) (added, removed []string) {
+	inFrom := make(map[string]bool, len(from))
+	for _, s := range from {
+		inFrom[s] = true
+	}
+	inTo := make(map[string]bool, len(to))
+	for _, s := range to {
+		inTo[s] = true
+		if !inFrom[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range from {
+		if !inTo[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+
+	"inscribeai/db"
+	"inscribeai/models"
+)
+
+func TestBrandToneVersionHistory(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	tone := env.createBrandTone(t, alice, "House style", nil)
+	if tone.Version != 1 {
+		t.Fatalf("new tone is at version %d, want 1", tone.Version)
+	}
+
+	formal := models.BrandToneSettings{Formality: models.FormalityFormal}
+	if _, err := env.brand.UpdateBrandTone(tone.ID, alice.ID, "House style", "", formal); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	neutral := models.BrandToneSettings{Formality: models.FormalityNeutral}
+	if _, err := env.brand.UpdateBrandTone(tone.ID, alice.ID, "House style v3", "", neutral); err != nil {
+		t.Fatalf("second update: %v", err)
+	}
+
+	rolledBack, err := env.brand.RollbackBrandTone(tone.ID, alice.ID, 1)
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if rolledBack.Version != 4 || rolledBack.Name != "House style" || rolledBack.Settings.Formality != models.FormalityCasual {
+		t.Fatalf("rollback gave version %d %q %q", rolledBack.Version, rolledBack.Name, rolledBack.Settings.Formality)
+	}
+
+	stored, err := env.brand.GetBrandToneByID(tone.ID, alice.ID)
+	if err != nil {
+		t.Fatalf("load tone: %v", err)
+	}
+	if stored.Version != 4 {
+		t.Errorf("stored tone is at version %d, want 4", stored.Version)
+	}
+
+	versions, err := env.brand.ListBrandToneVersions(tone.ID, alice.ID)
+	if err != nil {
+		t.Fatalf("list versions: %v", err)
+	}
+	want := []string{models.FormalityCasual, models.FormalityNeutral, models.FormalityFormal, models.FormalityCasual}
+	if len(versions) != len(want) {
+		t.Fatalf("got %d versions, want %d", len(versions), len(want))
+	}
+	for i, v := range versions {
+		if v.Version != len(want)-i || v.Settings.Formality != want[i] {
+			t.Errorf("versions[%d] = version %d %q, want version %d %q", i, v.Version, v.Settings.Formality, len(want)-i, want[i])
+		}
+	}
+	if versions[0].Note != "rolled back to version 1" {
+		t.Errorf("rollback note = %q", versions[0].Note)
+	}
+
+	if _, err := env.brand.RollbackBrandTone(tone.ID, alice.ID, 4); err == nil {
+		t.Error("rolling back to the current version succeeded")
+	}
+}
+
+func TestMigrateRepairsUnsavedBrandToneVersion(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	tone := env.createBrandTone(t, alice, "House style", nil)
+
+	// As left by creating a tone without saving its first version number
+	if err := env.db.Model(&models.BrandTone{}).Where("id = ?", tone.ID).Update("version", 0).Error; err != nil {
+		t.Fatalf("reset version: %v", err)
+	}
+	if err := db.Migrate(env.db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	updated, err := env.brand.UpdateBrandTone(tone.ID, alice.ID, "House style", "", models.BrandToneSettings{Formality: models.FormalityFormal})
+	if err != nil {
+		t.Fatalf("update after repair: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("updated tone is at version %d, want 2", updated.Version)
+	}
+}
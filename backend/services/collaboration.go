@@ -1,27 +1,44 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"inscribeai/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+const invitationTTL = 7 * 24 * time.Hour
+
 type CollaborationService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	policy   *PolicyService
+	activity *ActivityService
 }
 
-func NewCollaborationService(db *gorm.DB) *CollaborationService {
-	return &CollaborationService{db: db}
+func NewCollaborationService(db *gorm.DB, policy *PolicyService, activity *ActivityService) *CollaborationService {
+	return &CollaborationService{db: db, policy: policy, activity: activity}
 }
 
 func (cs *CollaborationService) ShareContent(contentID, ownerID, userID uuid.UUID, action string) (*models.Collaboration, error) {
-	// Verify content ownership
-	var content models.Content
-	if err := cs.db.Where("id = ? AND user_id = ?", contentID, ownerID).First(&content).Error; err != nil {
-		return nil, errors.New("content not found or unauthorized")
+	if _, ok := sharePermissions[action]; !ok {
+		return nil, invalidInput("action must be view, comment or edit")
+	}
+
+	content, err := cs.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.policy.AuthorizeContent(ownerID, content, PermContentShare); err != nil {
+		return nil, err
 	}
 
 	collab := &models.Collaboration{
@@ -34,10 +51,19 @@ func (cs *CollaborationService) ShareContent(contentID, ownerID, userID uuid.UUI
 		return nil, err
 	}
 
+	cs.activity.RecordContent(ownerID, VerbContentShared, content, "shared with "+action+" access")
 	return collab, nil
 }
 
 func (cs *CollaborationService) AddComment(contentID, userID uuid.UUID, comment string) (*models.Collaboration, error) {
+	content, err := cs.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.policy.AuthorizeContent(userID, content, PermContentComment); err != nil {
+		return nil, err
+	}
+
 	collab := &models.Collaboration{
 		ContentID: contentID,
 		UserID:    userID,
@@ -49,10 +75,19 @@ func (cs *CollaborationService) AddComment(contentID, userID uuid.UUID, comment
 		return nil, err
 	}
 
+	cs.activity.RecordContent(userID, VerbCommentAdded, content, truncate(comment, 140))
 	return collab, nil
 }
 
-func (cs *CollaborationService) GetCollaborations(contentID uuid.UUID) ([]models.Collaboration, error) {
+func (cs *CollaborationService) GetCollaborations(contentID, userID uuid.UUID) ([]models.Collaboration, error) {
+	content, err := cs.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.policy.AuthorizeContent(userID, content, PermContentView); err != nil {
+		return nil, err
+	}
+
 	var collabs []models.Collaboration
 	if err := cs.db.Preload("User").Where("content_id = ?", contentID).Order("created_at DESC").Find(&collabs).Error; err != nil {
 		return nil, err
@@ -74,30 +109,64 @@ func (cs *CollaborationService) CreateTeam(ownerID uuid.UUID, name string) (*mod
 	member := &models.TeamMember{
 		TeamID: team.ID,
 		UserID: ownerID,
-		Role:   "owner",
+		Role:   models.RoleOwner,
 	}
 
 	if err := cs.db.Create(member).Error; err != nil {
 		return nil, err
 	}
 
+	cs.recordTeamActivity(ownerID, VerbTeamCreated, team.ID, nil, "created team \""+name+"\"")
 	return team, nil
 }
 
-func (cs *CollaborationService) AddTeamMember(teamID, ownerID, userID uuid.UUID, role string) error {
-	// Verify ownership
-	var team models.Team
-	if err := cs.db.Where("id = ? AND owner_id = ?", teamID, ownerID).First(&team).Error; err != nil {
-		return errors.New("team not found or unauthorized")
+func (cs *CollaborationService) AddTeamMember(teamID, actorID, userID uuid.UUID, role string) error {
+	if err := cs.validateMemberRole(teamID, role); err != nil {
+		return err
+	}
+
+	actor, err := cs.requireTeamManager(teamID, actorID)
+	if err != nil {
+		return err
+	}
+	if role == models.RoleAdmin && actor.Role != models.RoleOwner {
+		return forbidden("only the team owner can add admins")
+	}
+	if err := cs.requireGrantableRole(teamID, actor, role); err != nil {
+		return err
+	}
+
+	var user models.User
+	if err := cs.db.First(&user, userID).Error; err != nil {
+		return notFound("user not found")
+	}
+
+	if err := cs.addMember(cs.db, teamID, userID, role); err != nil {
+		return err
 	}
 
+	cs.recordTeamActivity(actorID, VerbTeamMemberAdded, teamID, &userID, "added "+user.Email+" as "+role)
+	return nil
+}
+
+// addMember inserts a membership. The unique index on team and user, not a
+// prior lookup, decides whether the user already belongs, so concurrent
+// adds cannot both succeed.
+func (cs *CollaborationService) addMember(tx *gorm.DB, teamID, userID uuid.UUID, role string) error {
 	member := &models.TeamMember{
 		TeamID: teamID,
 		UserID: userID,
 		Role:   role,
 	}
 
-	return cs.db.Create(member).Error
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(member)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return conflict("user is already a team member")
+	}
+	return nil
 }
 
 func (cs *CollaborationService) GetUserTeams(userID uuid.UUID) ([]models.Team, error) {
@@ -111,3 +180,642 @@ func (cs *CollaborationService) GetUserTeams(userID uuid.UUID) ([]models.Team, e
 	return teams, nil
 }
 
+func (cs *CollaborationService) GetTeam(teamID, userID uuid.UUID) (*models.Team, error) {
+	if _, err := cs.getMembership(teamID, userID); err != nil {
+		return nil, err
+	}
+
+	var team models.Team
+	if err := cs.db.Preload("Members.User").First(&team, teamID).Error; err != nil {
+		return nil, notFound("team not found")
+	}
+	return &team, nil
+}
+
+func (cs *CollaborationService) RenameTeam(teamID, actorID uuid.UUID, name string) (*models.Team, error) {
+	if _, err := cs.requireTeamManager(teamID, actorID); err != nil {
+		return nil, err
+	}
+
+	var team models.Team
+	if err := cs.db.First(&team, teamID).Error; err != nil {
+		return nil, notFound("team not found")
+	}
+
+	oldName := team.Name
+	team.Name = name
+	if err := cs.db.Save(&team).Error; err != nil {
+		return nil, err
+	}
+
+	cs.recordTeamActivity(actorID, VerbTeamUpdated, teamID, nil, fmt.Sprintf("renamed team from %q to %q", oldName, name))
+	return &team, nil
+}
+
+// UpdateWorkflowSettings sets how many approvals the team's content needs
+// before it can be published.
+func (cs *CollaborationService) UpdateWorkflowSettings(teamID, actorID uuid.UUID, requiredApprovals int) (*models.Team, error) {
+	if requiredApprovals < 0 {
+		return nil, invalidInput("required approvals cannot be negative")
+	}
+	if _, err := cs.requireTeamManager(teamID, actorID); err != nil {
+		return nil, err
+	}
+
+	var team models.Team
+	if err := cs.db.First(&team, teamID).Error; err != nil {
+		return nil, notFound("team not found")
+	}
+
+	team.RequiredApprovals = requiredApprovals
+	if err := cs.db.Save(&team).Error; err != nil {
+		return nil, err
+	}
+
+	cs.recordTeamActivity(actorID, VerbTeamUpdated, teamID, nil, fmt.Sprintf("required approvals set to %d", requiredApprovals))
+	return &team, nil
+}
+
+func (cs *CollaborationService) DeleteTeam(teamID, actorID uuid.UUID) error {
+	var team models.Team
+	if err := cs.db.First(&team, teamID).Error; err != nil {
+		return notFound("team not found")
+	}
+	if team.OwnerID != actorID {
+		return forbidden("only the team owner can delete the team")
+	}
+
+	err := cs.db.Transaction(func(tx *gorm.DB) error {
+		// Team brand tones fall back to their creators rather than disappearing
+		if err := tx.Model(&models.BrandTone{}).Where("team_id = ?", teamID).Update("team_id", nil).Error; err != nil {
+			return err
+		}
+		// Likewise for workspace content, which leaves the team's folders
+		if err := tx.Model(&models.Content{}).Where("team_id = ?", teamID).
+			Updates(map[string]interface{}{"team_id": nil, "folder_id": nil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.BatchJob{}).Where("team_id = ?", teamID).
+			Updates(map[string]interface{}{"team_id": nil, "folder_id": nil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.LongFormDocument{}).Where("team_id = ?", teamID).
+			Updates(map[string]interface{}{"team_id": nil, "folder_id": nil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&models.Folder{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&models.TeamInvitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&models.GlossaryTerm{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&models.BrandToneDefault{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&models.PromptTemplate{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&models.UsageQuota{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("webhook_id IN (?)", tx.Model(&models.Webhook{}).Select("id").Where("team_id = ?", teamID)).
+			Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&models.Webhook{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&models.TeamMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&models.TeamRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&team).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	cs.recordTeamActivity(actorID, VerbTeamDeleted, teamID, nil, "deleted team \""+team.Name+"\"")
+	return nil
+}
+
+func (cs *CollaborationService) UpdateTeamMemberRole(teamID, actorID, userID uuid.UUID, role string) (*models.TeamMember, error) {
+	if err := cs.validateMemberRole(teamID, role); err != nil {
+		return nil, err
+	}
+
+	actor, err := cs.requireTeamManager(teamID, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if actorID == userID {
+		return nil, forbidden("you cannot change your own role")
+	}
+
+	member, err := cs.getMembership(teamID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role == models.RoleOwner {
+		return nil, forbidden("the owner's role can only change through an ownership transfer")
+	}
+	if (member.Role == models.RoleAdmin || role == models.RoleAdmin) && actor.Role != models.RoleOwner {
+		return nil, forbidden("only the team owner can promote or demote admins")
+	}
+	// Managers can neither grant nor take away permissions they lack
+	if err := cs.requireGrantableRole(teamID, actor, member.Role); err != nil {
+		return nil, err
+	}
+	if err := cs.requireGrantableRole(teamID, actor, role); err != nil {
+		return nil, err
+	}
+
+	oldRole := member.Role
+	member.Role = role
+	if err := cs.db.Save(member).Error; err != nil {
+		return nil, err
+	}
+
+	cs.recordTeamActivity(actorID, VerbTeamMemberRole, teamID, &userID, "role changed from "+oldRole+" to "+role)
+	return member, nil
+}
+
+func (cs *CollaborationService) RemoveTeamMember(teamID, actorID, userID uuid.UUID) error {
+	if actorID == userID {
+		return cs.LeaveTeam(teamID, userID)
+	}
+
+	actor, err := cs.requireTeamManager(teamID, actorID)
+	if err != nil {
+		return err
+	}
+
+	member, err := cs.getMembership(teamID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role == models.RoleOwner {
+		return forbidden("the team owner cannot be removed")
+	}
+	if member.Role == models.RoleAdmin && actor.Role != models.RoleOwner {
+		return forbidden("only the team owner can remove admins")
+	}
+
+	if err := cs.db.Delete(member).Error; err != nil {
+		return err
+	}
+
+	cs.recordTeamActivity(actorID, VerbTeamMemberRemoved, teamID, &userID, "removed from the team")
+	return nil
+}
+
+func (cs *CollaborationService) LeaveTeam(teamID, userID uuid.UUID) error {
+	member, err := cs.getMembership(teamID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role == models.RoleOwner {
+		return conflict("transfer ownership before leaving the team")
+	}
+
+	if err := cs.db.Delete(member).Error; err != nil {
+		return err
+	}
+
+	cs.recordTeamActivity(userID, VerbTeamMemberRemoved, teamID, &userID, "left the team")
+	return nil
+}
+
+func (cs *CollaborationService) TransferOwnership(teamID, ownerID, newOwnerID uuid.UUID) (*models.Team, error) {
+	var team models.Team
+	if err := cs.db.First(&team, teamID).Error; err != nil {
+		return nil, notFound("team not found")
+	}
+	if team.OwnerID != ownerID {
+		return nil, forbidden("only the team owner can transfer ownership")
+	}
+	if newOwnerID == ownerID {
+		return nil, invalidInput("user already owns the team")
+	}
+
+	newOwner, err := cs.getMembership(teamID, newOwnerID)
+	if err != nil {
+		return nil, invalidInput("new owner must be a team member")
+	}
+
+	err = cs.db.Transaction(func(tx *gorm.DB) error {
+		// The previous owner stays on as an admin
+		if err := tx.Model(&models.TeamMember{}).
+			Where("team_id = ? AND user_id = ?", teamID, ownerID).
+			Update("role", models.RoleAdmin).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(newOwner).Update("role", models.RoleOwner).Error; err != nil {
+			return err
+		}
+		team.OwnerID = newOwnerID
+		return tx.Save(&team).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cs.recordTeamActivity(ownerID, VerbTeamOwnerChanged, teamID, &newOwnerID, "ownership transferred")
+	return &team, nil
+}
+
+// InviteTeamMember creates an invitation and returns it together with the raw
+// accept token, which is not stored and cannot be recovered later.
+func (cs *CollaborationService) InviteTeamMember(teamID, actorID uuid.UUID, email, role string) (*models.TeamInvitation, string, error) {
+	if err := cs.validateMemberRole(teamID, role); err != nil {
+		return nil, "", err
+	}
+
+	actor, err := cs.requireTeamManager(teamID, actorID)
+	if err != nil {
+		return nil, "", err
+	}
+	if role == models.RoleAdmin && actor.Role != models.RoleOwner {
+		return nil, "", forbidden("only the team owner can invite admins")
+	}
+	if err := cs.requireGrantableRole(teamID, actor, role); err != nil {
+		return nil, "", err
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var existing int64
+	if err := cs.db.Model(&models.TeamMember{}).
+		Joins("JOIN users ON users.id = team_members.user_id").
+		Where("team_members.team_id = ? AND LOWER(users.email) = ?", teamID, email).
+		Count(&existing).Error; err != nil {
+		return nil, "", err
+	}
+	if existing > 0 {
+		return nil, "", conflict("user is already a team member")
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	invitation := &models.TeamInvitation{
+		TeamID:    teamID,
+		Email:     email,
+		Role:      role,
+		TokenHash: hashToken(token),
+		InvitedBy: actorID,
+		ExpiresAt: time.Now().Add(invitationTTL),
+	}
+
+	if err := cs.db.Create(invitation).Error; err != nil {
+		return nil, "", err
+	}
+
+	cs.recordTeamActivity(actorID, VerbTeamInvitationSent, teamID, nil, "invited "+email+" as "+role)
+
+	return invitation, token, nil
+}
+
+func (cs *CollaborationService) ListInvitations(teamID, actorID uuid.UUID) ([]models.TeamInvitation, error) {
+	if _, err := cs.requireTeamManager(teamID, actorID); err != nil {
+		return nil, err
+	}
+
+	var invitations []models.TeamInvitation
+	if err := cs.db.Where("team_id = ? AND accepted_at IS NULL AND expires_at > ?", teamID, time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (cs *CollaborationService) RevokeInvitation(teamID, invitationID, actorID uuid.UUID) error {
+	if _, err := cs.requireTeamManager(teamID, actorID); err != nil {
+		return err
+	}
+
+	result := cs.db.Where("id = ? AND team_id = ? AND accepted_at IS NULL", invitationID, teamID).Delete(&models.TeamInvitation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return notFound("invitation not found")
+	}
+	return nil
+}
+
+// AcceptInvitation joins the invited team. The invitation must belong to the
+// email address of the accepting user.
+func (cs *CollaborationService) AcceptInvitation(token string, userID uuid.UUID) (*models.Team, error) {
+	var invitation models.TeamInvitation
+	if err := cs.db.Where("token_hash = ?", hashToken(token)).First(&invitation).Error; err != nil {
+		return nil, notFound("invitation not found")
+	}
+	if invitation.AcceptedAt != nil {
+		return nil, conflict("invitation has already been accepted")
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, invalidInput("invitation has expired")
+	}
+
+	var user models.User
+	if err := cs.db.First(&user, userID).Error; err != nil {
+		return nil, notFound("user not found")
+	}
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return nil, forbidden("invitation was sent to a different email address")
+	}
+
+	err := cs.db.Transaction(func(tx *gorm.DB) error {
+		if err := cs.addMember(tx, invitation.TeamID, userID, invitation.Role); err != nil {
+			return err
+		}
+		now := time.Now()
+		invitation.AcceptedAt = &now
+		return tx.Save(&invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cs.recordTeamActivity(userID, VerbTeamMemberAdded, invitation.TeamID, &userID, user.Email+" accepted an invitation as "+invitation.Role)
+
+	var team models.Team
+	if err := cs.db.First(&team, invitation.TeamID).Error; err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+func (cs *CollaborationService) ListTeamRoles(teamID, userID uuid.UUID) ([]models.TeamRole, error) {
+	if _, err := cs.getMembership(teamID, userID); err != nil {
+		return nil, err
+	}
+
+	var roles []models.TeamRole
+	if err := cs.db.Where("team_id = ?", teamID).Order("name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (cs *CollaborationService) CreateTeamRole(teamID, actorID uuid.UUID, name string, permissions []string) (*models.TeamRole, error) {
+	if err := cs.policy.AuthorizeTeam(actorID, teamID, PermTeamRoles); err != nil {
+		return nil, err
+	}
+	if err := validateCustomRole(name, permissions); err != nil {
+		return nil, err
+	}
+	if err := cs.requireGrantable(teamID, actorID, permissions); err != nil {
+		return nil, err
+	}
+	if err := cs.checkRoleName(teamID, name); err != nil {
+		return nil, err
+	}
+
+	role := &models.TeamRole{
+		TeamID:      teamID,
+		Name:        name,
+		Permissions: permissions,
+	}
+
+	if err := cs.db.Create(role).Error; err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (cs *CollaborationService) UpdateTeamRole(teamID, roleID, actorID uuid.UUID, name string, permissions []string) (*models.TeamRole, error) {
+	if err := cs.policy.AuthorizeTeam(actorID, teamID, PermTeamRoles); err != nil {
+		return nil, err
+	}
+	if err := validateCustomRole(name, permissions); err != nil {
+		return nil, err
+	}
+
+	if err := cs.requireGrantable(teamID, actorID, permissions); err != nil {
+		return nil, err
+	}
+
+	var role models.TeamRole
+	if err := cs.db.Where("id = ? AND team_id = ?", roleID, teamID).First(&role).Error; err != nil {
+		return nil, notFound("role not found")
+	}
+	if err := cs.requireGrantable(teamID, actorID, role.Permissions); err != nil {
+		return nil, err
+	}
+
+	oldName := role.Name
+	if name != oldName {
+		if err := cs.checkRoleName(teamID, name); err != nil {
+			return nil, err
+		}
+	}
+	err := cs.db.Transaction(func(tx *gorm.DB) error {
+		if name != oldName {
+			// Members keep their role across a rename
+			if err := tx.Model(&models.TeamMember{}).
+				Where("team_id = ? AND role = ?", teamID, oldName).
+				Update("role", name).Error; err != nil {
+				return err
+			}
+		}
+		role.Name = name
+		role.Permissions = permissions
+		return tx.Save(&role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (cs *CollaborationService) DeleteTeamRole(teamID, roleID, actorID uuid.UUID) error {
+	if err := cs.policy.AuthorizeTeam(actorID, teamID, PermTeamRoles); err != nil {
+		return err
+	}
+
+	var role models.TeamRole
+	if err := cs.db.Where("id = ? AND team_id = ?", roleID, teamID).First(&role).Error; err != nil {
+		return notFound("role not found")
+	}
+
+	var inUse int64
+	if err := cs.db.Model(&models.TeamMember{}).Where("team_id = ? AND role = ?", teamID, role.Name).Count(&inUse).Error; err != nil {
+		return err
+	}
+	if inUse > 0 {
+		return conflict("role is still assigned to team members")
+	}
+
+	return cs.db.Delete(&role).Error
+}
+
+func (cs *CollaborationService) getMembership(teamID, userID uuid.UUID) (*models.TeamMember, error) {
+	var member models.TeamMember
+	if err := cs.db.Where("team_id = ? AND user_id = ?", teamID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("team member not found")
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+// requireTeamManager returns the actor's membership if their role grants
+// team:manage.
+func (cs *CollaborationService) requireTeamManager(teamID, actorID uuid.UUID) (*models.TeamMember, error) {
+	member, err := cs.getMembership(teamID, actorID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, notFound("team not found or unauthorized")
+		}
+		return nil, err
+	}
+	if err := cs.policy.AuthorizeTeam(actorID, teamID, PermTeamManage); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// requireGrantableRole fails unless the actor holds every permission role
+// grants. Owners may grant any role.
+func (cs *CollaborationService) requireGrantableRole(teamID uuid.UUID, actor *models.TeamMember, role string) error {
+	if actor.Role == models.RoleOwner {
+		return nil
+	}
+	granted, err := cs.policy.RolePermissions(teamID, role)
+	if err != nil {
+		return err
+	}
+	return cs.requireHeld(teamID, actor, granted)
+}
+
+// requireGrantable fails unless the actor holds every one of permissions,
+// so that editing a role cannot raise anyone above the editor.
+func (cs *CollaborationService) requireGrantable(teamID, actorID uuid.UUID, permissions []string) error {
+	actor, err := cs.getMembership(teamID, actorID)
+	if err != nil {
+		return err
+	}
+	if actor.Role == models.RoleOwner {
+		return nil
+	}
+	granted := make(map[Permission]bool, len(permissions))
+	for _, p := range permissions {
+		granted[Permission(p)] = true
+	}
+	return cs.requireHeld(teamID, actor, granted)
+}
+
+func (cs *CollaborationService) requireHeld(teamID uuid.UUID, actor *models.TeamMember, granted map[Permission]bool) error {
+	held, err := cs.policy.RolePermissions(teamID, actor.Role)
+	if err != nil {
+		return err
+	}
+	for _, p := range AllPermissions {
+		if granted[p] && !held[p] {
+			return forbidden("cannot grant permission " + string(p) + " you do not hold")
+		}
+	}
+	return nil
+}
+
+// checkRoleName fails if the team already has a custom role called name.
+func (cs *CollaborationService) checkRoleName(teamID uuid.UUID, name string) error {
+	var count int64
+	if err := cs.db.Model(&models.TeamRole{}).Where("team_id = ? AND name = ?", teamID, name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return conflict("a role with this name already exists")
+	}
+	return nil
+}
+
+// validateMemberRole accepts the roles that can be granted directly: admin,
+// member and the team's custom roles. Ownership only changes hands through
+// TransferOwnership.
+func (cs *CollaborationService) validateMemberRole(teamID uuid.UUID, role string) error {
+	switch role {
+	case models.RoleAdmin, models.RoleMember:
+		return nil
+	case models.RoleOwner:
+		return invalidInput("use an ownership transfer to make someone the owner")
+	}
+
+	var count int64
+	if err := cs.db.Model(&models.TeamRole{}).Where("team_id = ? AND name = ?", teamID, role).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return invalidInput("role must be admin, member or one of the team's custom roles")
+	}
+	return nil
+}
+
+// recordTeamActivity logs a team event. subjectID is the member affected, if any.
+func (cs *CollaborationService) recordTeamActivity(actorID uuid.UUID, verb string, teamID uuid.UUID, subjectID *uuid.UUID, summary string) {
+	objectType, objectID := "team", &teamID
+	if subjectID != nil {
+		objectType, objectID = "user", subjectID
+	}
+	cs.activity.Record(&models.ActivityEvent{
+		ActorID:    actorID,
+		Verb:       verb,
+		ObjectType: objectType,
+		ObjectID:   objectID,
+		TeamID:     &teamID,
+		Summary:    summary,
+	})
+}
+
+func validateCustomRole(name string, permissions []string) error {
+	if strings.TrimSpace(name) == "" {
+		return invalidInput("role name is required")
+	}
+	if IsBuiltinRole(name) {
+		return invalidInput("role name is reserved")
+	}
+	for _, p := range permissions {
+		if !IsValidPermission(Permission(p)) {
+			return invalidInput("unknown permission " + p)
+		}
+	}
+	return nil
+}
+
+func (cs *CollaborationService) findContent(contentID uuid.UUID) (*models.Content, error) {
+	var content models.Content
+	if err := cs.db.First(&content, contentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("content not found")
+		}
+		return nil, err
+	}
+	return &content, nil
+}
+
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
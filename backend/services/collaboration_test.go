@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"inscribeai/models"
+)
+
+func TestTeamRoleChangesCannotEscalate(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	team := env.createTeam(t, alice, "Alice Co")
+
+	if _, err := env.collab.CreateTeamRole(team.ID, alice.ID, "manager", []string{string(PermTeamManage)}); err != nil {
+		t.Fatalf("create manager role: %v", err)
+	}
+	all := make([]string, len(AllPermissions))
+	for i, p := range AllPermissions {
+		all[i] = string(p)
+	}
+	if _, err := env.collab.CreateTeamRole(team.ID, alice.ID, "super", all); err != nil {
+		t.Fatalf("create super role: %v", err)
+	}
+	if err := env.collab.AddTeamMember(team.ID, alice.ID, bob.ID, "manager"); err != nil {
+		t.Fatalf("add bob: %v", err)
+	}
+	if err := env.collab.AddTeamMember(team.ID, alice.ID, carol.ID, models.RoleMember); err != nil {
+		t.Fatalf("add carol: %v", err)
+	}
+
+	if _, err := env.collab.UpdateTeamMemberRole(team.ID, bob.ID, bob.ID, "super"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("changing own role: got %v, want forbidden", err)
+	}
+	if _, err := env.collab.UpdateTeamMemberRole(team.ID, bob.ID, carol.ID, "super"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("granting a broader role: got %v, want forbidden", err)
+	}
+	if err := env.collab.AddTeamMember(team.ID, bob.ID, env.createUser(t, "dave").ID, "super"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("adding with a broader role: got %v, want forbidden", err)
+	}
+	if _, _, err := env.collab.InviteTeamMember(team.ID, bob.ID, "erin@example.com", "super"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("inviting with a broader role: got %v, want forbidden", err)
+	}
+
+	perms, err := env.policy.TeamPermissions(team.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("bob's permissions: %v", err)
+	}
+	if len(perms) != 1 || !perms[PermTeamManage] {
+		t.Errorf("bob holds %v, want only %s", perms, PermTeamManage)
+	}
+
+	// Carol's member role grants content permissions Bob lacks, so he cannot
+	// take them away either
+	if _, err := env.collab.UpdateTeamMemberRole(team.ID, bob.ID, carol.ID, "manager"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("changing a broader member's role: got %v, want forbidden", err)
+	}
+	if _, err := env.collab.UpdateTeamMemberRole(team.ID, alice.ID, carol.ID, "manager"); err != nil {
+		t.Fatalf("owner assigning manager: %v", err)
+	}
+	if _, err := env.collab.UpdateTeamMemberRole(team.ID, alice.ID, carol.ID, "super"); err != nil {
+		t.Fatalf("owner assigning super: %v", err)
+	}
+}
+
+func TestTeamRoleEditsCannotEscalate(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	team := env.createTeam(t, alice, "Alice Co")
+
+	role, err := env.collab.CreateTeamRole(team.ID, alice.ID, "role editor", []string{string(PermTeamRoles)})
+	if err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	if err := env.collab.AddTeamMember(team.ID, alice.ID, bob.ID, "role editor"); err != nil {
+		t.Fatalf("add bob: %v", err)
+	}
+
+	broader := []string{string(PermTeamRoles), string(PermBrandDelete)}
+	if _, err := env.collab.UpdateTeamRole(team.ID, role.ID, bob.ID, "role editor", broader); !errors.Is(err, ErrForbidden) {
+		t.Errorf("widening own role: got %v, want forbidden", err)
+	}
+	if _, err := env.collab.CreateTeamRole(team.ID, bob.ID, "deleter", []string{string(PermBrandDelete)}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("creating a broader role: got %v, want forbidden", err)
+	}
+}
+
+func TestRenameTeamRoleToExistingName(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	team := env.createTeam(t, alice, "Alice Co")
+
+	if _, err := env.collab.CreateTeamRole(team.ID, alice.ID, "writer", []string{string(PermContentEdit)}); err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	editor, err := env.collab.CreateTeamRole(team.ID, alice.ID, "editor", []string{string(PermContentEdit)})
+	if err != nil {
+		t.Fatalf("create editor: %v", err)
+	}
+
+	if _, err := env.collab.UpdateTeamRole(team.ID, editor.ID, alice.ID, "writer", []string{string(PermContentEdit)}); !errors.Is(err, ErrConflict) {
+		t.Errorf("rename to an existing name: got %v, want conflict", err)
+	}
+	if _, err := env.collab.UpdateTeamRole(team.ID, editor.ID, alice.ID, "editor", []string{string(PermContentView)}); err != nil {
+		t.Errorf("update keeping the name: %v", err)
+	}
+}
+
+func TestRemovedCreatorLosesTeamBrandTone(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	team := env.createTeam(t, alice, "Alice Co")
+	if err := env.collab.AddTeamMember(team.ID, alice.ID, bob.ID, models.RoleAdmin); err != nil {
+		t.Fatalf("add bob: %v", err)
+	}
+	tone := env.createBrandTone(t, bob, "Team voice", &team.ID)
+
+	if err := env.collab.RemoveTeamMember(team.ID, alice.ID, bob.ID); err != nil {
+		t.Fatalf("remove bob: %v", err)
+	}
+
+	_, err := env.brand.GetBrandToneByID(tone.ID, bob.ID)
+	assertDenied(t, err)
+	_, err = env.brand.UpdateBrandTone(tone.ID, bob.ID, "Bob's voice", "", tone.Settings)
+	assertDenied(t, err)
+	_, err = env.brand.RollbackBrandTone(tone.ID, bob.ID, 1)
+	assertDenied(t, err)
+	assertDenied(t, env.brand.DeleteBrandTone(tone.ID, bob.ID))
+
+	tones, err := env.brand.ListBrandTones(bob.ID)
+	if err != nil {
+		t.Fatalf("list tones: %v", err)
+	}
+	if len(tones) != 0 {
+		t.Errorf("bob still lists %d team tones", len(tones))
+	}
+
+	if _, err := env.brand.GetBrandToneByID(tone.ID, alice.ID); err != nil {
+		t.Errorf("owner lost the team tone: %v", err)
+	}
+}
@@ -1,8 +1,11 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"time"
+	"fmt"
+	"strings"
 
 	"inscribeai/models"
 
@@ -11,119 +14,687 @@ import (
 )
 
 type ContentService struct {
-	db      *gorm.DB
-	ai      *AIService
-	cache   *CacheService
+	db        *gorm.DB
+	ai        *AIService
+	cache     *CacheService
+	policy    *PolicyService
+	activity  *ActivityService
+	retrieval *RetrievalService
 }
 
-func NewContentService(db *gorm.DB, ai *AIService, cache *CacheService) *ContentService {
+func NewContentService(db *gorm.DB, ai *AIService, cache *CacheService, policy *PolicyService, activity *ActivityService, retrieval *RetrievalService) *ContentService {
 	return &ContentService{
-		db:    db,
-		ai:    ai,
-		cache: cache,
+		db:        db,
+		ai:        ai,
+		cache:     cache,
+		policy:    policy,
+		activity:  activity,
+		retrieval: retrieval,
 	}
 }
 
-func (cs *ContentService) CreateContent(userID uuid.UUID, title, contentType string, brandToneID *uuid.UUID) (*models.Content, error) {
+// CreateContent creates a draft, empty unless structured fields are given
+// for its content type. A brand tone is pinned to brandToneVersion, or to
+// its current version when that is nil.
+func (cs *ContentService) CreateContent(userID uuid.UUID, title, contentType string, structured json.RawMessage, brandToneID *uuid.UUID, brandToneVersion *int, teamID, folderID *uuid.UUID) (*models.Content, error) {
+	return cs.createContent(userID, title, "", contentType, structured, brandToneID, brandToneVersion, teamID, folderID)
+}
+
+// createContent saves a draft. An empty body is filled in from the
+// structured fields.
+func (cs *ContentService) createContent(userID uuid.UUID, title, body, contentType string, structured json.RawMessage, brandToneID *uuid.UUID, brandToneVersion *int, teamID, folderID *uuid.UUID) (*models.Content, error) {
+	if structured != nil {
+		value, encoded, err := normalizeStructured(contentType, structured)
+		if err != nil {
+			return nil, err
+		}
+		if body == "" {
+			body = value.render()
+		}
+		structured = encoded
+	}
+	if teamID != nil {
+		if err := cs.policy.AuthorizeTeam(userID, *teamID, PermContentEdit); err != nil {
+			return nil, err
+		}
+	}
+	if err := cs.checkFolder(userID, folderID, teamID); err != nil {
+		return nil, err
+	}
+	brandToneVersion, err := cs.checkBrandToneVersion(userID, brandToneID, brandToneVersion)
+	if err != nil {
+		return nil, err
+	}
+
 	content := &models.Content{
-		UserID:      userID,
-		Title:       title,
-		Content:     "",
-		ContentType: contentType,
-		BrandToneID: brandToneID,
+		UserID:           userID,
+		Title:            title,
+		Content:          body,
+		ContentType:      contentType,
+		Structured:       structured,
+		Status:           models.StatusDraft,
+		BrandToneID:      brandToneID,
+		BrandToneVersion: brandToneVersion,
+		TeamID:           teamID,
+		FolderID:         folderID,
 	}
 
 	if err := cs.db.Create(content).Error; err != nil {
 		return nil, err
 	}
 
+	cs.activity.RecordContent(userID, VerbContentCreated, content, "created \""+title+"\"")
 	return content, nil
 }
 
 func (cs *ContentService) GetContentByID(contentID, userID uuid.UUID) (*models.Content, error) {
 	var content models.Content
-	if err := cs.db.Preload("BrandTone").Where("id = ? AND user_id = ?", contentID, userID).First(&content).Error; err != nil {
+	if err := cs.db.Preload("BrandTone").First(&content, contentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("content not found")
+		}
+		return nil, err
+	}
+	if err := cs.policy.AuthorizeContent(userID, &content, PermContentView); err != nil {
 		return nil, err
 	}
 	return &content, nil
 }
 
-func (cs *ContentService) ListContent(userID uuid.UUID, limit, offset int) ([]models.Content, int64, error) {
+// ContentFilter narrows ListContent. Without a TeamID only the user's
+// personal content is listed.
+type ContentFilter struct {
+	TeamID   *uuid.UUID
+	FolderID *uuid.UUID
+	Status   string
+	Query    string
+	Limit    int
+	Offset   int
+}
+
+func (cs *ContentService) ListContent(userID uuid.UUID, filter ContentFilter) ([]models.Content, int64, error) {
 	var contents []models.Content
 	var total int64
 
-	query := cs.db.Model(&models.Content{}).Where("user_id = ?", userID)
+	query := cs.db.Model(&models.Content{})
+	if filter.TeamID != nil {
+		if err := cs.policy.AuthorizeTeam(userID, *filter.TeamID, PermContentView); err != nil {
+			return nil, 0, err
+		}
+		query = query.Where("team_id = ?", *filter.TeamID)
+	} else {
+		query = query.Where("user_id = ? AND team_id IS NULL", userID)
+	}
+	if filter.FolderID != nil {
+		query = query.Where("folder_id = ?", *filter.FolderID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Query != "" {
+		like := "%" + filter.Query + "%"
+		query = query.Where("title ILIKE ? OR content ILIKE ?", like, like)
+	}
 	query.Count(&total)
 
-	if err := query.Preload("BrandTone").Order("created_at DESC").Limit(limit).Offset(offset).Find(&contents).Error; err != nil {
+	if err := query.Preload("BrandTone").Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&contents).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return contents, total, nil
 }
 
-func (cs *ContentService) UpdateContent(contentID, userID uuid.UUID, title, content string) (*models.Content, error) {
-	var existingContent models.Content
-	if err := cs.db.Where("id = ? AND user_id = ?", contentID, userID).First(&existingContent).Error; err != nil {
-		return nil, errors.New("content not found")
+// UpdateContent replaces the title and body. Structured fields are replaced
+// only when given, and cleared by a JSON null; an empty body is then filled
+// in from them. Content in review cannot be edited, and editing approved
+// content sends it back to draft.
+func (cs *ContentService) UpdateContent(contentID, userID uuid.UUID, title, content string, structured json.RawMessage) (*models.Content, error) {
+	existingContent, err := cs.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.policy.AuthorizeContent(userID, existingContent, PermContentEdit); err != nil {
+		return nil, err
+	}
+	switch existingContent.Status {
+	case models.StatusInReview:
+		return nil, conflict("content is in review; move it back to draft before editing")
+	case models.StatusPublished:
+		return nil, conflict("content is published; move it back to draft before editing")
+	}
+	oldStructured := string(existingContent.Structured)
+	if string(structured) == "null" {
+		existingContent.Structured = nil
+	} else if structured != nil {
+		value, encoded, err := normalizeStructured(existingContent.ContentType, structured)
+		if err != nil {
+			return nil, err
+		}
+		if content == "" {
+			content = value.render()
+		}
+		existingContent.Structured = encoded
 	}
 
+	changed := existingContent.Title != title || existingContent.Content != content || string(existingContent.Structured) != oldStructured
+	summary := diffSummary(existingContent.Title, title, existingContent.Content, content)
 	existingContent.Title = title
 	existingContent.Content = content
 
-	if err := cs.db.Save(&existingContent).Error; err != nil {
+	var transition *models.WorkflowTransition
+	err = cs.db.Transaction(func(tx *gorm.DB) error {
+		if changed && existingContent.Status == models.StatusApproved {
+			transition = &models.WorkflowTransition{
+				ContentID:  existingContent.ID,
+				ActorID:    userID,
+				FromStatus: existingContent.Status,
+				ToStatus:   models.StatusDraft,
+				Comment:    "edited after approval",
+			}
+			if err := tx.Create(transition).Error; err != nil {
+				return err
+			}
+			existingContent.Status = models.StatusDraft
+		}
+		return tx.Save(existingContent).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cs.activity.RecordContent(userID, VerbContentUpdated, existingContent, summary)
+	if transition != nil {
+		cs.activity.RecordContent(userID, VerbContentStatusChanged, existingContent, transition.FromStatus+" → "+transition.ToStatus+reviewComment(transition.Comment))
+	}
+	return existingContent, nil
+}
+
+// SetBrandTone records which brand tone and version the content is written
+// in, for example after regenerating it with a newer version.
+func (cs *ContentService) SetBrandTone(contentID, userID uuid.UUID, brandToneID *uuid.UUID, brandToneVersion *int) (*models.Content, error) {
+	content, err := cs.findContent(contentID)
+	if err != nil {
 		return nil, err
 	}
+	if err := cs.policy.AuthorizeContent(userID, content, PermContentEdit); err != nil {
+		return nil, err
+	}
+	brandToneVersion, err = cs.checkBrandToneVersion(userID, brandToneID, brandToneVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	content.BrandToneID = brandToneID
+	content.BrandToneVersion = brandToneVersion
+	if err := cs.db.Model(content).Select("brand_tone_id", "brand_tone_version").Updates(content).Error; err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// checkBrandToneVersion verifies the user can view the tone and that a pinned
+// version exists, defaulting to the tone's current version. Tones from
+// before versioning pin nothing.
+func (cs *ContentService) checkBrandToneVersion(userID uuid.UUID, brandToneID *uuid.UUID, version *int) (*int, error) {
+	if brandToneID == nil {
+		if version != nil {
+			return nil, invalidInput("brand_tone_version requires brand_tone_id")
+		}
+		return nil, nil
+	}
 
-	return &existingContent, nil
+	brandTone, err := findVisibleBrandTone(cs.db, cs.policy, *brandToneID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if version == nil {
+		if brandTone.Version == 0 {
+			return nil, nil
+		}
+		return &brandTone.Version, nil
+	}
+	if _, err := findBrandToneVersion(cs.db, brandTone.ID, *version); err != nil {
+		return nil, err
+	}
+	return version, nil
 }
 
 func (cs *ContentService) DeleteContent(contentID, userID uuid.UUID) error {
-	return cs.db.Where("id = ? AND user_id = ?", contentID, userID).Delete(&models.Content{}).Error
+	content, err := cs.findContent(contentID)
+	if err != nil {
+		return err
+	}
+	if err := cs.policy.AuthorizeContent(userID, content, PermContentDelete); err != nil {
+		return err
+	}
+
+	err = cs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("content_id = ?", contentID).Delete(&models.ShareComment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("content_id = ?", contentID).Delete(&models.ShareLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("content_id = ?", contentID).Delete(&models.ReviewAssignment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("content_id = ?", contentID).Delete(&models.WorkflowTransition{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("content_id = ?", contentID).Delete(&models.ContentChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(content).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	cs.activity.RecordContent(userID, VerbContentDeleted, content, "deleted \""+content.Title+"\"")
+	return nil
+}
+
+// TransferToTeam moves personal content into a team workspace. Only the
+// author can give their content away, and they need content:edit in the team.
+func (cs *ContentService) TransferToTeam(contentID, userID, teamID uuid.UUID, folderID *uuid.UUID) (*models.Content, error) {
+	content, err := cs.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+	if content.TeamID != nil {
+		return nil, conflict("content already belongs to a team")
+	}
+	if content.UserID != userID {
+		return nil, forbidden("only the author can transfer content")
+	}
+	if err := cs.policy.AuthorizeTeam(userID, teamID, PermContentEdit); err != nil {
+		return nil, err
+	}
+	if err := cs.checkFolder(userID, folderID, &teamID); err != nil {
+		return nil, err
+	}
+
+	content.TeamID = &teamID
+	content.FolderID = folderID
+	if err := cs.db.Save(content).Error; err != nil {
+		return nil, err
+	}
+
+	cs.activity.RecordContent(userID, VerbContentTransferred, content, "moved into the team workspace")
+	return content, nil
+}
+
+// MoveContent places content in a folder of the same workspace, or at the
+// workspace root when folderID is nil.
+func (cs *ContentService) MoveContent(contentID, userID uuid.UUID, folderID *uuid.UUID) (*models.Content, error) {
+	content, err := cs.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.policy.AuthorizeContent(userID, content, PermContentEdit); err != nil {
+		return nil, err
+	}
+	if err := cs.checkFolder(userID, folderID, content.TeamID); err != nil {
+		return nil, err
+	}
+
+	content.FolderID = folderID
+	if err := cs.db.Save(content).Error; err != nil {
+		return nil, err
+	}
+
+	cs.activity.RecordContent(userID, VerbContentMoved, content, "moved to another folder")
+	return content, nil
+}
+
+func (cs *ContentService) CreateFolder(userID uuid.UUID, name string, teamID, parentID *uuid.UUID) (*models.Folder, error) {
+	if teamID != nil {
+		if err := cs.policy.AuthorizeTeam(userID, *teamID, PermContentEdit); err != nil {
+			return nil, err
+		}
+	}
+	if err := cs.checkFolder(userID, parentID, teamID); err != nil {
+		return nil, err
+	}
+
+	folder := &models.Folder{
+		UserID:   userID,
+		TeamID:   teamID,
+		ParentID: parentID,
+		Name:     name,
+	}
+
+	if err := cs.db.Create(folder).Error; err != nil {
+		return nil, err
+	}
+
+	return folder, nil
 }
 
-func (cs *ContentService) ComposeContent(userID uuid.UUID, prompt, contentType string, brandToneID *uuid.UUID) (string, error) {
-	var brandTone *models.BrandTone
-	if brandToneID != nil {
-		if err := cs.db.First(&brandTone, brandToneID).Error; err != nil {
-			brandTone = nil
+func (cs *ContentService) ListFolders(userID uuid.UUID, teamID *uuid.UUID) ([]models.Folder, error) {
+	query := cs.db.Model(&models.Folder{})
+	if teamID != nil {
+		if err := cs.policy.AuthorizeTeam(userID, *teamID, PermContentView); err != nil {
+			return nil, err
 		}
+		query = query.Where("team_id = ?", *teamID)
+	} else {
+		query = query.Where("user_id = ? AND team_id IS NULL", userID)
 	}
 
-	brandToneMap := make(map[string]interface{})
-	if brandTone != nil {
-		brandToneMap["description"] = brandTone.Description
+	var folders []models.Folder
+	if err := query.Order("name").Find(&folders).Error; err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+func (cs *ContentService) RenameFolder(folderID, userID uuid.UUID, name string) (*models.Folder, error) {
+	folder, err := cs.findFolder(folderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.policy.AuthorizeFolder(userID, folder, PermContentEdit); err != nil {
+		return nil, err
+	}
+
+	folder.Name = name
+	if err := cs.db.Save(folder).Error; err != nil {
+		return nil, err
+	}
+
+	return folder, nil
+}
+
+func (cs *ContentService) DeleteFolder(folderID, userID uuid.UUID) error {
+	folder, err := cs.findFolder(folderID)
+	if err != nil {
+		return err
+	}
+	if err := cs.policy.AuthorizeFolder(userID, folder, PermContentDelete); err != nil {
+		return err
+	}
+
+	var children int64
+	if err := cs.db.Model(&models.Folder{}).Where("parent_id = ?", folderID).Count(&children).Error; err != nil {
+		return err
+	}
+	var contents int64
+	if err := cs.db.Model(&models.Content{}).Where("folder_id = ?", folderID).Count(&contents).Error; err != nil {
+		return err
 	}
+	if children > 0 || contents > 0 {
+		return conflict("folder is not empty")
+	}
+
+	return cs.db.Delete(folder).Error
+}
+
+// checkFolder verifies that folderID, if set, is a folder of the given
+// workspace that the user may add content to.
+func (cs *ContentService) checkFolder(userID uuid.UUID, folderID, teamID *uuid.UUID) error {
+	if folderID == nil {
+		return nil
+	}
+
+	folder, err := cs.findFolder(*folderID)
+	if err != nil {
+		return err
+	}
+	sameWorkspace := (folder.TeamID == nil && teamID == nil) ||
+		(folder.TeamID != nil && teamID != nil && *folder.TeamID == *teamID)
+	if !sameWorkspace {
+		return invalidInput("folder belongs to a different workspace")
+	}
+	return cs.policy.AuthorizeFolder(userID, folder, PermContentEdit)
+}
+
+func (cs *ContentService) findFolder(folderID uuid.UUID) (*models.Folder, error) {
+	var folder models.Folder
+	if err := cs.db.First(&folder, folderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("folder not found")
+		}
+		return nil, err
+	}
+	return &folder, nil
+}
+
+func (cs *ContentService) findContent(contentID uuid.UUID) (*models.Content, error) {
+	var content models.Content
+	if err := cs.db.First(&content, contentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("content not found")
+		}
+		return nil, err
+	}
+	return &content, nil
+}
+
+// GenerationOptions are the optional settings shared by compose, enhance and
+// transform.
+type GenerationOptions struct {
+	BrandToneID      *uuid.UUID         // explicit tone; when nil the user's or team's default applies
+	BrandToneVersion *int               // regenerate with an earlier version of the tone
+	TeamID           *uuid.UUID         // workspace whose default tones apply
+	AutoCorrect      bool               // rewrite glossary violations instead of only flagging them
+	Variants         int                // number of candidates to generate; 0 or 1 for a single result
+	Structured       bool               // return JSON fields for the content type's schema
+	Platforms        []string           // social platforms to write posts for; all when empty
+	RetrieveTopK     int                // passages of related workspace content to add as context; compose only
+	Priority         GenerationPriority // place in the generation queue; interactive unless set
+	Ctx              context.Context    // the request waiting for the result; queued and running calls are dropped when it ends
+}
+
+// GenerationResult is generated text with any glossary violations found in
+// it, and the brand tone version it was written with so it can be pinned.
+// With variants, Content and GlossaryViolations are the best-scoring one.
+// Structured output is in Structured, with Content its plain-text rendering.
+type GenerationResult struct {
+	Content             string              `json:"content"`
+	Structured          StructuredContent   `json:"structured,omitempty"`
+	GlossaryViolations  []GlossaryViolation `json:"glossary_violations"`
+	BrandToneID         *uuid.UUID          `json:"brand_tone_id,omitempty"`
+	BrandToneVersion    *int                `json:"brand_tone_version,omitempty"`
+	BrandToneResolution *ToneResolution     `json:"brand_tone_resolution"`
+	GenerationID        *uuid.UUID          `json:"generation_id,omitempty"` // set with variants, for saving one
+	Variants            []GenerationVariant `json:"variants,omitempty"`
+	Citations           []Citation          `json:"citations,omitempty"` // retrieved passages given as context
+}
 
+func (cs *ContentService) ComposeContent(userID uuid.UUID, prompt, contentType string, opts GenerationOptions) (*GenerationResult, error) {
 	aiReq := AIRequest{
 		Prompt:      prompt,
 		ContentType: contentType,
-		BrandTone:   brandToneMap,
 		Action:      "compose",
 	}
 
-	return cs.ai.GenerateContent(aiReq)
+	return cs.generate(userID, aiReq, opts)
+}
+
+// EnhanceContent improves existing text. contentType is optional; it also
+// selects content-type default tones.
+func (cs *ContentService) EnhanceContent(userID uuid.UUID, content, contentType string, opts GenerationOptions) (*GenerationResult, error) {
+	aiReq := AIRequest{
+		Prompt:      content,
+		ContentType: contentType,
+		Action:      "enhance",
+	}
+
+	return cs.generate(userID, aiReq, opts)
 }
 
-func (cs *ContentService) EnhanceContent(userID uuid.UUID, content string, brandToneID *uuid.UUID) (string, error) {
-	var brandTone *models.BrandTone
-	if brandToneID != nil {
-		if err := cs.db.First(&brandTone, brandToneID).Error; err != nil {
-			brandTone = nil
+// generate resolves the brand tone, runs an AI request with the tone's
+// glossary, checks the output against it and logs the generation. With
+// opts.Variants it produces several candidates instead.
+func (cs *ContentService) generate(userID uuid.UUID, req AIRequest, opts GenerationOptions) (*GenerationResult, error) {
+	if opts.Variants < 0 || opts.Variants > maxVariants {
+		return nil, invalidInput(fmt.Sprintf("n must be between 1 and %d", maxVariants))
+	}
+	if opts.RetrieveTopK < 0 || opts.RetrieveTopK > maxRetrieveTopK {
+		return nil, invalidInput(fmt.Sprintf("retrieve_top_k must be between 0 and %d", maxRetrieveTopK))
+	}
+	if opts.RetrieveTopK > 0 && req.Action != "compose" {
+		return nil, invalidInput("retrieve_top_k is only supported by compose")
+	}
+	format, err := newOutputFormat(req.ContentType, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	req, resolution, err := cs.prepareGeneration(userID, req, opts)
+	if err != nil {
+		return nil, err
+	}
+	if format != nil {
+		req.Format = format.instructions()
+	}
+	var citations []Citation
+	if opts.RetrieveTopK > 0 {
+		passages, err := cs.retrieval.retrieve(userID, req.Prompt, opts.TeamID, opts.RetrieveTopK)
+		if err != nil {
+			return nil, err
+		}
+		if len(passages) > 0 {
+			req.Context, citations = retrievalContext(passages)
+		}
+	}
+	if opts.Variants > 1 {
+		result, err := cs.generateVariants(userID, req, format, opts, resolution)
+		if err != nil {
+			return nil, err
 		}
+		result.Citations = citations
+		return result, nil
 	}
 
-	brandToneMap := make(map[string]interface{})
-	if brandTone != nil {
-		brandToneMap["description"] = brandTone.Description
+	output, err := cs.runGeneration(req, format, opts.AutoCorrect)
+	if err != nil {
+		return nil, err
 	}
 
-	aiReq := AIRequest{
-		Prompt:    content,
-		BrandTone: brandToneMap,
-		Action:    "enhance",
+	cs.activity.Record(&models.ActivityEvent{
+		ActorID:    userID,
+		Verb:       VerbContentGenerated,
+		ObjectType: "generation",
+		Summary:    fmt.Sprintf("%s generated %d words", req.Action, len(strings.Fields(output.content))),
+	})
+	result := newGenerationResult(req, resolution)
+	result.Content = output.content
+	result.Structured = output.structured
+	result.GlossaryViolations = output.violations
+	result.Citations = citations
+	return result, nil
+}
+
+// generationOutput is one model reply after schema and glossary checks.
+type generationOutput struct {
+	content    string
+	structured StructuredContent
+	violations []GlossaryViolation
+}
+
+// runGeneration calls the model. Structured replies that do not match the
+// schema are sent back to the model with the problems found, up to
+// maxRepairAttempts times; glossary checks then run field by field.
+func (cs *ContentService) runGeneration(req AIRequest, format *outputFormat, autoCorrect bool) (*generationOutput, error) {
+	output, err := cs.ai.GenerateContent(req)
+	if err != nil {
+		return nil, err
+	}
+	if format == nil {
+		content, violations := applyGlossary(output, req.Glossary, autoCorrect)
+		return &generationOutput{content: content, violations: violations}, nil
+	}
+
+	value, problems := format.parse(output)
+	for attempt := 0; len(problems) > 0 && attempt < maxRepairAttempts; attempt++ {
+		output, err = cs.ai.GenerateContent(AIRequest{
+			Prompt:      repairPrompt(req.Format, output, problems),
+			Action:      "repair",
+			UserID:      req.UserID,
+			TeamID:      req.TeamID,
+			Temperature: req.Temperature,
+			Priority:    req.Priority,
+			OnQueued:    req.OnQueued,
+			Ctx:         req.Ctx,
+			SkipCache:   req.SkipCache,
+		})
+		if err != nil {
+			return nil, err
+		}
+		value, problems = format.parse(output)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("model output does not match the %s schema: %s", format.schema.ContentType, strings.Join(problems, "; "))
+	}
+
+	result := &generationOutput{structured: value, violations: []GlossaryViolation{}}
+	for _, field := range value.textFields() {
+		text, violations := applyGlossary(*field.text, req.Glossary, autoCorrect)
+		*field.text = text
+		for _, v := range violations {
+			v.Field = field.name
+			result.violations = append(result.violations, v)
+		}
+	}
+	result.content = value.render()
+	return result, nil
+}
+
+// prepareGeneration resolves the brand tone, its version and glossary and
+// the workspace whose prompt templates apply.
+func (cs *ContentService) prepareGeneration(userID uuid.UUID, req AIRequest, opts GenerationOptions) (AIRequest, *ToneResolution, error) {
+	// The team is billed for the call and its templates are used, so the
+	// user must belong to it whichever way the tone is chosen
+	if opts.TeamID != nil {
+		if err := cs.policy.AuthorizeTeam(userID, *opts.TeamID, PermContentView); err != nil {
+			return req, nil, err
+		}
+	}
+	brandTone, resolution, err := resolveBrandTone(cs.db, cs.policy, userID, opts.BrandToneID, req.ContentType, opts.TeamID)
+	if err != nil {
+		return req, nil, err
+	}
+	if brandTone != nil && brandTone.TeamID != nil {
+		if opts.TeamID == nil {
+			if err := cs.policy.AuthorizeTeam(userID, *brandTone.TeamID, PermContentView); err != nil {
+				return req, nil, err
+			}
+		} else if *brandTone.TeamID != *opts.TeamID {
+			return req, nil, invalidInput("brand tone belongs to another team")
+		}
+	}
+	if opts.BrandToneVersion != nil {
+		if brandTone == nil {
+			return req, nil, invalidInput("brand_tone_version requires a brand tone")
+		}
+		if brandTone, err = brandToneAtVersion(cs.db, brandTone, *opts.BrandToneVersion); err != nil {
+			return req, nil, err
+		}
+	}
+	req.BrandTone = brandTone
+	req.UserID = userID
+	req.Priority = opts.Priority
+	req.Ctx = opts.Ctx
+	req.TeamID = opts.TeamID
+	if req.TeamID == nil && brandTone != nil {
+		req.TeamID = brandTone.TeamID
 	}
 
-	return cs.ai.GenerateContent(aiReq)
+	if req.Glossary, err = loadGlossary(cs.db, req.BrandTone, req.TeamID); err != nil {
+		return req, nil, err
+	}
+	return req, resolution, nil
 }
 
+func newGenerationResult(req AIRequest, resolution *ToneResolution) *GenerationResult {
+	result := &GenerationResult{GlossaryViolations: []GlossaryViolation{}, BrandToneResolution: resolution}
+	if req.BrandTone != nil {
+		result.BrandToneID = &req.BrandTone.ID
+		if req.BrandTone.Version > 0 {
+			result.BrandToneVersion = &req.BrandTone.Version
+		}
+	}
+	return result
+}
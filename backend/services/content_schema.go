@@ -0,0 +1,372 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRepairAttempts is how many times the model is asked to fix structured
+// output that does not match its schema.
+const maxRepairAttempts = 2
+
+// StructuredContent is generated content broken into the fields of its
+// content type's schema.
+type StructuredContent interface {
+	// validate returns every problem found; platforms, when set, are the
+	// social platforms that must each have one post.
+	validate(platforms []string) []string
+	// textFields returns the editable text, for glossary checks.
+	textFields() []structuredText
+	// render flattens the fields into plain text for Content.Content.
+	render() string
+}
+
+type structuredText struct {
+	name string
+	text *string
+}
+
+// SchemaField documents one field of a content schema.
+type SchemaField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	MaxLength   int    `json:"max_length,omitempty"`
+}
+
+// ContentSchema is the structure generated for a content type.
+type ContentSchema struct {
+	ContentType    string         `json:"content_type"`
+	Description    string         `json:"description"`
+	Fields         []SchemaField  `json:"fields"`
+	PlatformLimits map[string]int `json:"platform_limits,omitempty"` // characters per post, social only
+	newValue       func() StructuredContent
+}
+
+type EmailContent struct {
+	Subject   string `json:"subject"`
+	Preheader string `json:"preheader"`
+	Body      string `json:"body"`
+	CTA       string `json:"cta"`
+}
+
+type BlogContent struct {
+	Title           string   `json:"title"`
+	MetaDescription string   `json:"meta_description"`
+	Headings        []string `json:"headings"`
+	Body            string   `json:"body"`
+}
+
+type SocialContent struct {
+	Posts []SocialPost `json:"posts"`
+}
+
+type SocialPost struct {
+	Platform string `json:"platform"`
+	Text     string `json:"text"`
+}
+
+// socialPlatformLimits is the character limit of a post on each platform.
+var socialPlatformLimits = map[string]int{
+	"x":         280,
+	"threads":   500,
+	"facebook":  2000,
+	"instagram": 2200,
+	"linkedin":  3000,
+}
+
+var contentSchemas = map[string]*ContentSchema{
+	"email": {
+		ContentType: "email",
+		Description: "A marketing or outreach email",
+		Fields: []SchemaField{
+			{Name: "subject", Type: "string", Description: "Subject line", Required: true, MaxLength: 100},
+			{Name: "preheader", Type: "string", Description: "Preview text shown after the subject", Required: true, MaxLength: 150},
+			{Name: "body", Type: "string", Description: "Email body in plain text", Required: true},
+			{Name: "cta", Type: "string", Description: "Call-to-action button text", Required: true, MaxLength: 40},
+		},
+		newValue: func() StructuredContent { return &EmailContent{} },
+	},
+	"blog": {
+		ContentType: "blog",
+		Description: "A blog post in Markdown",
+		Fields: []SchemaField{
+			{Name: "title", Type: "string", Description: "Post title", Required: true, MaxLength: 100},
+			{Name: "meta_description", Type: "string", Description: "Search result description", Required: true, MaxLength: 160},
+			{Name: "headings", Type: "string list", Description: "Section headings, each used as a \"## \" heading in the body", Required: true},
+			{Name: "body", Type: "string", Description: "Post body in Markdown", Required: true},
+		},
+		newValue: func() StructuredContent { return &BlogContent{} },
+	},
+	"social": {
+		ContentType: "social",
+		Description: "Posts for one or more social platforms",
+		Fields: []SchemaField{
+			{Name: "posts", Type: "list of {platform, text}", Description: "One post per platform, within the platform's character limit", Required: true},
+		},
+		PlatformLimits: socialPlatformLimits,
+		newValue:       func() StructuredContent { return &SocialContent{} },
+	},
+}
+
+// ContentSchemas lists the content types that support structured output.
+func ContentSchemas() []ContentSchema {
+	schemas := make([]ContentSchema, 0, len(contentSchemas))
+	for _, s := range contentSchemas {
+		schemas = append(schemas, *s)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].ContentType < schemas[j].ContentType })
+	return schemas
+}
+
+func findContentSchema(contentType string) (*ContentSchema, error) {
+	schema, ok := contentSchemas[strings.ToLower(strings.TrimSpace(contentType))]
+	if !ok {
+		types := make([]string, 0, len(contentSchemas))
+		for t := range contentSchemas {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		return nil, invalidInput("structured output needs content_type " + strings.Join(types, ", "))
+	}
+	return schema, nil
+}
+
+// normalizePlatforms lower-cases platform names, accepts "twitter" for "x",
+// drops repeats and rejects unknown platforms.
+func normalizePlatforms(platforms []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, p := range platforms {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "twitter" {
+			p = "x"
+		}
+		if _, ok := socialPlatformLimits[p]; !ok {
+			return nil, invalidInput("unknown platform \"" + p + "\"")
+		}
+		if !seen[p] {
+			seen[p] = true
+			normalized = append(normalized, p)
+		}
+	}
+	return normalized, nil
+}
+
+// outputFormat is the schema a structured generation must match.
+type outputFormat struct {
+	schema    *ContentSchema
+	platforms []string
+}
+
+// newOutputFormat checks the structured output options, returning nil when
+// plain text was asked for. Social posts default to every platform.
+func newOutputFormat(contentType string, opts GenerationOptions) (*outputFormat, error) {
+	if !opts.Structured {
+		if len(opts.Platforms) > 0 {
+			return nil, invalidInput("platforms requires structured output")
+		}
+		return nil, nil
+	}
+	schema, err := findContentSchema(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if schema.PlatformLimits == nil {
+		if len(opts.Platforms) > 0 {
+			return nil, invalidInput("platforms only applies to social content")
+		}
+		return &outputFormat{schema: schema}, nil
+	}
+	platforms, err := normalizePlatforms(opts.Platforms)
+	if err != nil {
+		return nil, err
+	}
+	if len(platforms) == 0 {
+		for p := range schema.PlatformLimits {
+			platforms = append(platforms, p)
+		}
+		sort.Strings(platforms)
+	}
+	return &outputFormat{schema: schema, platforms: platforms}, nil
+}
+
+// instructions tells the model to answer with JSON for the schema.
+func (f *outputFormat) instructions() string {
+	schema, platforms := f.schema, f.platforms
+	var b strings.Builder
+	b.WriteString("Respond with only a JSON object, with no other text, containing these fields:")
+	for _, f := range schema.Fields {
+		fmt.Fprintf(&b, "\n- %s (%s", f.Name, f.Type)
+		if f.MaxLength > 0 {
+			fmt.Fprintf(&b, ", at most %d characters", f.MaxLength)
+		}
+		fmt.Fprintf(&b, "): %s", f.Description)
+	}
+	if schema.PlatformLimits != nil {
+		b.WriteString("\nWrite one post for each of these platforms:")
+		for _, p := range platforms {
+			fmt.Fprintf(&b, "\n- %s: at most %d characters", p, schema.PlatformLimits[p])
+		}
+	}
+	return b.String()
+}
+
+// parse decodes model output against the schema. The JSON object
+// may be wrapped in prose or a code fence; unknown fields are rejected.
+func (f *outputFormat) parse(output string) (StructuredContent, []string) {
+	start, end := strings.Index(output, "{"), strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, []string{"the reply does not contain a JSON object"}
+	}
+	return decodeStructured(f.schema, []byte(output[start:end+1]), f.platforms)
+}
+
+func decodeStructured(schema *ContentSchema, data []byte, platforms []string) (StructuredContent, []string) {
+	value := schema.newValue()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(value); err != nil {
+		return nil, []string{"invalid JSON: " + err.Error()}
+	}
+	if errs := value.validate(platforms); len(errs) > 0 {
+		return nil, errs
+	}
+	return value, nil
+}
+
+// normalizeStructured validates client-supplied structured fields for a
+// content type and returns them re-encoded.
+func normalizeStructured(contentType string, raw json.RawMessage) (StructuredContent, json.RawMessage, error) {
+	schema, err := findContentSchema(contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, errs := decodeStructured(schema, raw, nil)
+	if len(errs) > 0 {
+		return nil, nil, invalidInput("structured: " + strings.Join(errs, "; "))
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, encoded, nil
+}
+
+func repairPrompt(format, output string, errs []string) string {
+	return "Your previous reply did not match the required format:\n- " + strings.Join(errs, "\n- ") +
+		"\n\n" + format + "\n\nPrevious reply:\n" + output
+}
+
+func checkText(errs []string, field, value string, required bool, maxLength int) []string {
+	value = strings.TrimSpace(value)
+	if required && value == "" {
+		return append(errs, field+" is required")
+	}
+	if maxLength > 0 && utf8.RuneCountInString(value) > maxLength {
+		return append(errs, fmt.Sprintf("%s must be at most %d characters", field, maxLength))
+	}
+	return errs
+}
+
+func (e *EmailContent) validate(platforms []string) []string {
+	var errs []string
+	errs = checkText(errs, "subject", e.Subject, true, 100)
+	errs = checkText(errs, "preheader", e.Preheader, true, 150)
+	errs = checkText(errs, "body", e.Body, true, 0)
+	errs = checkText(errs, "cta", e.CTA, true, 40)
+	return errs
+}
+
+func (e *EmailContent) textFields() []structuredText {
+	return []structuredText{{"subject", &e.Subject}, {"preheader", &e.Preheader}, {"body", &e.Body}, {"cta", &e.CTA}}
+}
+
+func (e *EmailContent) render() string {
+	return "Subject: " + e.Subject + "\nPreheader: " + e.Preheader + "\n\n" + e.Body + "\n\n" + e.CTA
+}
+
+func (b *BlogContent) validate(platforms []string) []string {
+	var errs []string
+	errs = checkText(errs, "title", b.Title, true, 100)
+	errs = checkText(errs, "meta_description", b.MetaDescription, true, 160)
+	errs = checkText(errs, "body", b.Body, true, 0)
+	if len(b.Headings) == 0 {
+		errs = append(errs, "headings is required")
+	}
+	body := strings.ToLower(b.Body)
+	for i, h := range b.Headings {
+		errs = checkText(errs, fmt.Sprintf("headings[%d]", i), h, true, 100)
+		if h = strings.TrimSpace(h); h != "" && !strings.Contains(body, strings.ToLower(h)) {
+			errs = append(errs, "heading \""+h+"\" does not appear in the body")
+		}
+	}
+	return errs
+}
+
+func (b *BlogContent) textFields() []structuredText {
+	fields := []structuredText{{"title", &b.Title}, {"meta_description", &b.MetaDescription}}
+	for i := range b.Headings {
+		fields = append(fields, structuredText{fmt.Sprintf("headings[%d]", i), &b.Headings[i]})
+	}
+	return append(fields, structuredText{"body", &b.Body})
+}
+
+func (b *BlogContent) render() string {
+	return "# " + b.Title + "\n\n" + b.Body
+}
+
+func (s *SocialContent) validate(platforms []string) []string {
+	var errs []string
+	if len(s.Posts) == 0 {
+		errs = append(errs, "posts is required")
+	}
+	seen := make(map[string]bool)
+	for i := range s.Posts {
+		post := &s.Posts[i]
+		post.Platform = strings.ToLower(strings.TrimSpace(post.Platform))
+		if post.Platform == "twitter" {
+			post.Platform = "x"
+		}
+		limit, ok := socialPlatformLimits[post.Platform]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("posts[%d] has unknown platform \"%s\"", i, post.Platform))
+			continue
+		}
+		if seen[post.Platform] {
+			errs = append(errs, "more than one post for "+post.Platform)
+		}
+		seen[post.Platform] = true
+		errs = checkText(errs, fmt.Sprintf("posts[%d].text (%s)", i, post.Platform), post.Text, true, limit)
+	}
+	for _, p := range platforms {
+		if !seen[p] {
+			errs = append(errs, "no post for "+p)
+		}
+	}
+	if len(platforms) > 0 && len(seen) > len(platforms) {
+		errs = append(errs, "posts must only cover "+strings.Join(platforms, ", "))
+	}
+	return errs
+}
+
+func (s *SocialContent) textFields() []structuredText {
+	fields := make([]structuredText, len(s.Posts))
+	for i := range s.Posts {
+		fields[i] = structuredText{fmt.Sprintf("posts[%d].text", i), &s.Posts[i].Text}
+	}
+	return fields
+}
+
+func (s *SocialContent) render() string {
+	parts := make([]string, len(s.Posts))
+	for i, p := range s.Posts {
+		parts[i] = p.Platform + ":\n" + p.Text
+	}
+	return strings.Join(parts, "\n\n")
+}
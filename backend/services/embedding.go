@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Embedder turns text into vectors whose cosine similarity reflects how
+// related the texts are. Vectors from different embedders are not
+// comparable, so each is stored with the embedder's Name.
+type Embedder interface {
+	Name() string
+	Embed(texts []string) ([][]float32, error)
+}
+
+// NewEmbedderFromEnv returns the embedder selected by EMBEDDER: "local"
+// (the default) calls the model service, "hash" uses the deterministic
+// hashing embedder, which needs no model and suits tests and development.
+func NewEmbedderFromEnv() Embedder {
+	if strings.EqualFold(os.Getenv("EMBEDDER"), "hash") {
+		return hashEmbedder{dims: hashEmbeddingDims}
+	}
+	url := os.Getenv("GPT4ALL_PYTHON_SERVICE_URL")
+	if url == "" {
+		url = "http://localhost:8000"
+	}
+	model := os.Getenv("EMBEDDING_MODEL")
+	if model == "" {
+		model = "all-MiniLM-L6-v2"
+	}
+	return &localEmbedder{url: url, model: model, client: &http.Client{Timeout: 60 * time.Second}}
+}
+
+// localEmbedder calls the /embed endpoint of the model service.
+type localEmbedder struct {
+	url    string
+	model  string
+	client *http.Client
+}
+
+func (e *localEmbedder) Name() string {
+	return "local/" + e.model
+}
+
+func (e *localEmbedder) Embed(texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{"texts": texts, "model": e.model})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.client.Post(e.url+"/embed", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call embedding service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Embeddings [][]float32 `json:"embeddings"`
+		Error      string      `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("embedding service returned %d: %w", resp.StatusCode, err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("embedding service error: %s", result.Error)
+	}
+	if len(result.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding service returned %d vectors for %d texts", len(result.Embeddings), len(texts))
+	}
+	for _, v := range result.Embeddings {
+		normalizeVector(v)
+	}
+	return result.Embeddings, nil
+}
+
+const hashEmbeddingDims = 512
+
+// hashEmbedder hashes words and word pairs into a fixed number of
+// dimensions. It only captures shared vocabulary, not meaning, but is
+// deterministic and free.
+type hashEmbedder struct {
+	dims int
+}
+
+func (e hashEmbedder) Name() string {
+	return fmt.Sprintf("hash-%d", e.dims)
+}
+
+func (e hashEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, e.dims)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for j, w := range words {
+			e.add(v, w, 1)
+			if j > 0 {
+				e.add(v, words[j-1]+" "+w, 0.5)
+			}
+		}
+		normalizeVector(v)
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+// add hashes a feature to a dimension and a sign, so unrelated features
+// cancel out rather than pile up.
+func (e hashEmbedder) add(v []float32, feature string, weight float32) {
+	h := fnv.New32a()
+	h.Write([]byte(feature))
+	sum := h.Sum32()
+	if sum&1 == 1 {
+		weight = -weight
+	}
+	v[(sum>>1)%uint32(e.dims)] += weight
+}
+
+func normalizeVector(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+// cosineSimilarity of two normalized vectors; 0 when their sizes differ.
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
@@ -0,0 +1,63 @@
+package services
+
+import "errors"
+
+// Error kinds let handlers map service failures to HTTP status codes.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrForbidden    = errors.New("forbidden")
+	ErrConflict     = errors.New("conflict")
+	ErrInvalidInput = errors.New("invalid input")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrGone         = errors.New("gone")
+	ErrUnavailable  = errors.New("unavailable")
+	ErrRateLimited  = errors.New("rate limited")
+	// ErrQuotaExceeded is wrapped by QuotaError.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// ServiceError carries a user-facing message together with its kind.
+type ServiceError struct {
+	Kind    error
+	Message string
+}
+
+func (e *ServiceError) Error() string {
+	return e.Message
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Kind
+}
+
+func notFound(message string) error {
+	return &ServiceError{Kind: ErrNotFound, Message: message}
+}
+
+func forbidden(message string) error {
+	return &ServiceError{Kind: ErrForbidden, Message: message}
+}
+
+func conflict(message string) error {
+	return &ServiceError{Kind: ErrConflict, Message: message}
+}
+
+func invalidInput(message string) error {
+	return &ServiceError{Kind: ErrInvalidInput, Message: message}
+}
+
+func unauthorized(message string) error {
+	return &ServiceError{Kind: ErrUnauthorized, Message: message}
+}
+
+func gone(message string) error {
+	return &ServiceError{Kind: ErrGone, Message: message}
+}
+
+func unavailable(message string) error {
+	return &ServiceError{Kind: ErrUnavailable, Message: message}
+}
+
+func rateLimited(message string) error {
+	return &ServiceError{Kind: ErrRateLimited, Message: message}
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GlossaryViolation is a glossary rule broken by generated text. Start and
+// End are character offsets into the returned text; for corrected
+// violations they cover the replacement.
+type GlossaryViolation struct {
+	TermID     uuid.UUID `json:"term_id"`
+	Term       string    `json:"term"`
+	Found      string    `json:"found"`
+	Suggestion string    `json:"suggestion,omitempty"`
+	Start      int       `json:"start"`
+	End        int       `json:"end"`
+	Corrected  bool      `json:"corrected"`
+	Notes      string    `json:"notes,omitempty"`
+	Field      string    `json:"field,omitempty"` // structured field the offsets refer to
+}
+
+func (bs *BrandService) CreateGlossaryTerm(userID uuid.UUID, brandToneID, teamID *uuid.UUID, term, preferredForm string, forbiddenVariants []string, notes string) (*models.GlossaryTerm, error) {
+	if (brandToneID == nil) == (teamID == nil) {
+		return nil, invalidInput("exactly one of brand_tone_id and team_id is required")
+	}
+	if err := bs.authorizeGlossary(userID, brandToneID, teamID, PermBrandEdit); err != nil {
+		return nil, err
+	}
+
+	glossaryTerm := &models.GlossaryTerm{
+		BrandToneID: brandToneID,
+		TeamID:      teamID,
+		CreatedBy:   userID,
+	}
+	if err := setGlossaryFields(glossaryTerm, term, preferredForm, forbiddenVariants, notes); err != nil {
+		return nil, err
+	}
+
+	if err := bs.db.Create(glossaryTerm).Error; err != nil {
+		return nil, err
+	}
+	return glossaryTerm, nil
+}
+
+// ListGlossary returns the terms attached to a brand tone or a team.
+func (bs *BrandService) ListGlossary(userID uuid.UUID, brandToneID, teamID *uuid.UUID) ([]models.GlossaryTerm, error) {
+	if (brandToneID == nil) == (teamID == nil) {
+		return nil, invalidInput("exactly one of brand_tone_id and team_id is required")
+	}
+	if err := bs.authorizeGlossary(userID, brandToneID, teamID, PermBrandView); err != nil {
+		return nil, err
+	}
+
+	query := bs.db.Model(&models.GlossaryTerm{})
+	if brandToneID != nil {
+		query = query.Where("brand_tone_id = ?", *brandToneID)
+	} else {
+		query = query.Where("team_id = ?", *teamID)
+	}
+
+	var terms []models.GlossaryTerm
+	if err := query.Order("term").Find(&terms).Error; err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+func (bs *BrandService) UpdateGlossaryTerm(termID, userID uuid.UUID, term, preferredForm string, forbiddenVariants []string, notes string) (*models.GlossaryTerm, error) {
+	glossaryTerm, err := bs.findGlossaryTerm(termID)
+	if err != nil {
+		return nil, err
+	}
+	if err := bs.authorizeGlossary(userID, glossaryTerm.BrandToneID, glossaryTerm.TeamID, PermBrandEdit); err != nil {
+		return nil, err
+	}
+	if err := setGlossaryFields(glossaryTerm, term, preferredForm, forbiddenVariants, notes); err != nil {
+		return nil, err
+	}
+
+	if err := bs.db.Save(glossaryTerm).Error; err != nil {
+		return nil, err
+	}
+	return glossaryTerm, nil
+}
+
+func (bs *BrandService) DeleteGlossaryTerm(termID, userID uuid.UUID) error {
+	glossaryTerm, err := bs.findGlossaryTerm(termID)
+	if err != nil {
+		return err
+	}
+	if err := bs.authorizeGlossary(userID, glossaryTerm.BrandToneID, glossaryTerm.TeamID, PermBrandEdit); err != nil {
+		return err
+	}
+	return bs.db.Delete(glossaryTerm).Error
+}
+
+func (bs *BrandService) authorizeGlossary(userID uuid.UUID, brandToneID, teamID *uuid.UUID, perm Permission) error {
+	if brandToneID != nil {
+		brandTone, err := bs.findBrandTone(*brandToneID)
+		if err != nil {
+			return err
+		}
+		return bs.policy.Authorize(userID, brandTone.UserID, brandTone.TeamID, perm)
+	}
+	return bs.policy.AuthorizeTeam(userID, *teamID, perm)
+}
+
+func (bs *BrandService) findGlossaryTerm(termID uuid.UUID) (*models.GlossaryTerm, error) {
+	var glossaryTerm models.GlossaryTerm
+	if err := bs.db.First(&glossaryTerm, termID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("glossary term not found")
+		}
+		return nil, err
+	}
+	return &glossaryTerm, nil
+}
+
+func setGlossaryFields(glossaryTerm *models.GlossaryTerm, term, preferredForm string, forbiddenVariants []string, notes string) error {
+	term = strings.TrimSpace(term)
+	preferredForm = strings.TrimSpace(preferredForm)
+	if term == "" {
+		return invalidInput("term is required")
+	}
+
+	variants, err := normalizeTerms("forbidden_variants", forbiddenVariants)
+	if err != nil {
+		return err
+	}
+	if preferredForm == "" && len(variants) == 0 {
+		return invalidInput("a preferred form or at least one forbidden variant is required")
+	}
+	for _, v := range variants {
+		if v == preferredForm {
+			return invalidInput("\"" + v + "\" cannot be both preferred and forbidden")
+		}
+	}
+
+	glossaryTerm.Term = term
+	glossaryTerm.PreferredForm = preferredForm
+	glossaryTerm.ForbiddenVariants = variants
+	glossaryTerm.Notes = strings.TrimSpace(notes)
+	return nil
+}
+
+// loadGlossary returns the terms that apply to a generation: those of its
+// brand tone, if any, and those of its team workspace and the tone's team.
+func loadGlossary(db *gorm.DB, brandTone *models.BrandTone, teamID *uuid.UUID) ([]models.GlossaryTerm, error) {
+	var teamIDs []uuid.UUID
+	if teamID != nil {
+		teamIDs = append(teamIDs, *teamID)
+	}
+	if brandTone != nil && brandTone.TeamID != nil && (teamID == nil || *brandTone.TeamID != *teamID) {
+		teamIDs = append(teamIDs, *brandTone.TeamID)
+	}
+
+	var query *gorm.DB
+	switch {
+	case brandTone != nil && len(teamIDs) > 0:
+		query = db.Where("brand_tone_id = ? OR team_id IN ?", brandTone.ID, teamIDs)
+	case brandTone != nil:
+		query = db.Where("brand_tone_id = ?", brandTone.ID)
+	case len(teamIDs) > 0:
+		query = db.Where("team_id IN ?", teamIDs)
+	default:
+		return nil, nil
+	}
+
+	var terms []models.GlossaryTerm
+	if err := query.Order("term").Find(&terms).Error; err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+// glossaryInstructions renders glossary terms as prompt rules.
+func glossaryInstructions(terms []models.GlossaryTerm) string {
+	var lines []string
+	for _, t := range terms {
+		var line string
+		if t.PreferredForm != "" {
+			line = "- Write \"" + t.PreferredForm + "\" exactly as shown"
+			if len(t.ForbiddenVariants) > 0 {
+				line += ", never " + quoteList(t.ForbiddenVariants)
+			}
+		} else {
+			line = "- Never use " + quoteList(t.ForbiddenVariants)
+		}
+		line += "."
+		if t.Notes != "" {
+			line += " " + t.Notes
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = "\"" + item + "\""
+	}
+	return strings.Join(quoted, ", ")
+}
+
+type glossaryMatch struct {
+	term       *models.GlossaryTerm
+	start, end int
+	suggestion string
+}
+
+// applyGlossary finds forbidden variants and miscapitalised preferred forms
+// in text. With autoCorrect, violations that have a preferred form are
+// rewritten; forbidden claims are only ever flagged.
+func applyGlossary(text string, terms []models.GlossaryTerm, autoCorrect bool) (string, []GlossaryViolation) {
+	runes := []rune(text)
+
+	var matches []glossaryMatch
+	for i := range terms {
+		t := &terms[i]
+		for _, variant := range t.ForbiddenVariants {
+			for _, loc := range findTerm(text, termPattern(variant)) {
+				if string(runes[loc[0]:loc[1]]) == t.PreferredForm {
+					continue
+				}
+				matches = append(matches, glossaryMatch{term: t, start: loc[0], end: loc[1], suggestion: t.PreferredForm})
+			}
+		}
+		if t.PreferredForm != "" {
+			for _, loc := range findTerm(text, termPattern(t.PreferredForm)) {
+				if string(runes[loc[0]:loc[1]]) != t.PreferredForm {
+					matches = append(matches, glossaryMatch{term: t, start: loc[0], end: loc[1], suggestion: t.PreferredForm})
+				}
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return text, []GlossaryViolation{}
+	}
+
+	// Earliest first, and the longest of matches starting together
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+
+	var out []rune
+	violations := []GlossaryViolation{}
+	last := 0
+	for _, m := range matches {
+		if m.start < last {
+			continue
+		}
+		out = append(out, runes[last:m.start]...)
+
+		found := string(runes[m.start:m.end])
+		replacement := found
+		corrected := autoCorrect && m.suggestion != ""
+		if corrected {
+			replacement = m.suggestion
+		}
+
+		start := len(out)
+		out = append(out, []rune(replacement)...)
+		violations = append(violations, GlossaryViolation{
+			TermID:     m.term.ID,
+			Term:       m.term.Term,
+			Found:      found,
+			Suggestion: m.suggestion,
+			Start:      start,
+			End:        len(out),
+			Corrected:  corrected,
+			Notes:      m.term.Notes,
+		})
+		last = m.end
+	}
+	out = append(out, runes[last:]...)
+
+	return string(out), violations
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"testing"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+)
+
+func TestGenerationUsesTeamGlossary(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	team := env.createTeam(t, alice, "Alice Co")
+	personal := env.createBrandTone(t, alice, "Alice personal", nil)
+
+	teamTerm, err := env.brand.CreateGlossaryTerm(alice.ID, nil, &team.ID, "InscribeAI", "InscribeAI", []string{"Inscribe AI"}, "")
+	if err != nil {
+		t.Fatalf("create team term: %v", err)
+	}
+	toneTerm, err := env.brand.CreateGlossaryTerm(alice.ID, &personal.ID, nil, "email", "email", []string{"e-mail"}, "")
+	if err != nil {
+		t.Fatalf("create tone term: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  GenerationOptions
+		terms []uuid.UUID
+	}{
+		{"team without a tone", GenerationOptions{TeamID: &team.ID}, []uuid.UUID{teamTerm.ID}},
+		{"team with a personal tone", GenerationOptions{TeamID: &team.ID, BrandToneID: &personal.ID}, []uuid.UUID{toneTerm.ID, teamTerm.ID}},
+		{"personal tone alone", GenerationOptions{BrandToneID: &personal.ID}, []uuid.UUID{toneTerm.ID}},
+		{"neither", GenerationOptions{}, nil},
+	}
+	for _, tt := range tests {
+		req, _, err := env.content.prepareGeneration(alice.ID, AIRequest{Prompt: "a launch post", ContentType: "blog"}, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !sameTerms(req.Glossary, tt.terms) {
+			t.Errorf("%s: got %d terms, want %d", tt.name, len(req.Glossary), len(tt.terms))
+		}
+	}
+}
+
+func sameTerms(terms []models.GlossaryTerm, ids []uuid.UUID) bool {
+	if len(terms) != len(ids) {
+		return false
+	}
+	want := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	for _, term := range terms {
+		if !want[term.ID] {
+			return false
+		}
+	}
+	return true
+}
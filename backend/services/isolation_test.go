@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+)
+
+// tenants is two users, each owning a team, a personal and a team brand
+// tone, and personal and team content. Neither belongs to the other's team.
+type tenants struct {
+	env *testEnv
+
+	alice, bob                 *models.User
+	aliceTeam, bobTeam         *models.Team
+	aliceTone, aliceTeamTone   *models.BrandTone
+	bobTone, bobTeamTone       *models.BrandTone
+	aliceContent, aliceTeamDoc *models.Content
+	bobContent                 *models.Content
+}
+
+func newTenants(t *testing.T) *tenants {
+	env := newTestEnv(t)
+	tt := &tenants{env: env}
+	tt.alice = env.createUser(t, "alice")
+	tt.bob = env.createUser(t, "bob")
+	tt.aliceTeam = env.createTeam(t, tt.alice, "Alice Co")
+	tt.bobTeam = env.createTeam(t, tt.bob, "Bob Co")
+	tt.aliceTone = env.createBrandTone(t, tt.alice, "Alice personal", nil)
+	tt.aliceTeamTone = env.createBrandTone(t, tt.alice, "Alice Co house style", &tt.aliceTeam.ID)
+	tt.bobTone = env.createBrandTone(t, tt.bob, "Bob personal", nil)
+	tt.bobTeamTone = env.createBrandTone(t, tt.bob, "Bob Co house style", &tt.bobTeam.ID)
+	tt.aliceContent = env.createContent(t, tt.alice, "Alice draft", nil)
+	tt.aliceTeamDoc = env.createContent(t, tt.alice, "Alice Co launch", &tt.aliceTeam.ID)
+	tt.bobContent = env.createContent(t, tt.bob, "Bob draft", nil)
+	return tt
+}
+
+func TestComposeWithOwnBrandTones(t *testing.T) {
+	tt := newTenants(t)
+
+	for _, tone := range []*models.BrandTone{tt.aliceTone, tt.aliceTeamTone} {
+		result, err := tt.env.content.ComposeContent(tt.alice.ID, "a product launch", "blog", GenerationOptions{BrandToneID: &tone.ID})
+		if err != nil {
+			t.Fatalf("compose with %q: %v", tone.Name, err)
+		}
+		if result.BrandToneID == nil || *result.BrandToneID != tone.ID {
+			t.Errorf("compose with %q used tone %v", tone.Name, result.BrandToneID)
+		}
+	}
+}
+
+func TestComposeRejectsOtherTenantsBrandTones(t *testing.T) {
+	tt := newTenants(t)
+
+	for _, tone := range []*models.BrandTone{tt.aliceTone, tt.aliceTeamTone} {
+		_, err := tt.env.content.ComposeContent(tt.bob.ID, "a product launch", "blog", GenerationOptions{BrandToneID: &tone.ID})
+		assertDenied(t, err)
+	}
+}
+
+func TestEnhanceRejectsOtherTenantsBrandTones(t *testing.T) {
+	tt := newTenants(t)
+
+	for _, tone := range []*models.BrandTone{tt.aliceTone, tt.aliceTeamTone} {
+		_, err := tt.env.content.EnhanceContent(tt.bob.ID, "Our new product is here.", "blog", GenerationOptions{BrandToneID: &tone.ID})
+		assertDenied(t, err)
+	}
+}
+
+func TestComposeRejectsMissingBrandTone(t *testing.T) {
+	tt := newTenants(t)
+
+	missing := uuid.New()
+	_, err := tt.env.content.ComposeContent(tt.alice.ID, "a product launch", "blog", GenerationOptions{BrandToneID: &missing})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found for a missing tone, got %v", err)
+	}
+}
+
+func TestComposeRejectsOtherTenantsTeam(t *testing.T) {
+	tt := newTenants(t)
+
+	// Without a tone, with Bob's own tone and with the team's own tone
+	for _, toneID := range []*uuid.UUID{nil, &tt.bobTone.ID, &tt.aliceTeamTone.ID} {
+		_, err := tt.env.content.ComposeContent(tt.bob.ID, "a product launch", "blog", GenerationOptions{
+			BrandToneID: toneID,
+			TeamID:      &tt.aliceTeam.ID,
+		})
+		assertDenied(t, err)
+	}
+}
+
+func TestComposeRejectsBrandToneOfAnotherTeam(t *testing.T) {
+	tt := newTenants(t)
+
+	// Bob may use his team's tone, but not to bill a team it does not
+	// belong to, even one he is a member of
+	if err := tt.env.collab.AddTeamMember(tt.aliceTeam.ID, tt.alice.ID, tt.bob.ID, models.RoleMember); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+	_, err := tt.env.content.ComposeContent(tt.bob.ID, "a product launch", "blog", GenerationOptions{
+		BrandToneID: &tt.bobTeamTone.ID,
+		TeamID:      &tt.aliceTeam.ID,
+	})
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected invalid input for a tone of another team, got %v", err)
+	}
+}
+
+func TestCreateContentRejectsOtherTenants(t *testing.T) {
+	tt := newTenants(t)
+
+	_, err := tt.env.content.CreateContent(tt.bob.ID, "Intrusion", "blog", nil, nil, nil, &tt.aliceTeam.ID, nil)
+	assertDenied(t, err)
+
+	for _, tone := range []*models.BrandTone{tt.aliceTone, tt.aliceTeamTone} {
+		_, err := tt.env.content.CreateContent(tt.bob.ID, "Borrowed tone", "blog", nil, &tone.ID, nil, nil, nil)
+		assertDenied(t, err)
+	}
+}
+
+func TestSetBrandToneRejectsOtherTenants(t *testing.T) {
+	tt := newTenants(t)
+
+	// Bob cannot retag Alice's content, even with his own tone
+	for _, content := range []*models.Content{tt.aliceContent, tt.aliceTeamDoc} {
+		_, err := tt.env.content.SetBrandTone(content.ID, tt.bob.ID, &tt.bobTone.ID, nil)
+		assertDenied(t, err)
+	}
+
+	// Nor tag his own content with Alice's tones
+	for _, tone := range []*models.BrandTone{tt.aliceTone, tt.aliceTeamTone} {
+		_, err := tt.env.content.SetBrandTone(tt.bobContent.ID, tt.bob.ID, &tone.ID, nil)
+		assertDenied(t, err)
+	}
+
+	var content models.Content
+	if err := tt.env.db.First(&content, tt.bobContent.ID).Error; err != nil {
+		t.Fatalf("load content: %v", err)
+	}
+	if content.BrandToneID != nil {
+		t.Errorf("content was tagged with tone %v", *content.BrandToneID)
+	}
+}
+
+func TestListContentIsolatesTenants(t *testing.T) {
+	tt := newTenants(t)
+
+	_, _, err := tt.env.content.ListContent(tt.bob.ID, ContentFilter{TeamID: &tt.aliceTeam.ID, Limit: 50})
+	assertDenied(t, err)
+
+	contents, total, err := tt.env.content.ListContent(tt.bob.ID, ContentFilter{Limit: 50})
+	if err != nil {
+		t.Fatalf("list personal content: %v", err)
+	}
+	if total != 1 || len(contents) != 1 || contents[0].ID != tt.bobContent.ID {
+		t.Fatalf("expected only Bob's draft, got %d items (total %d)", len(contents), total)
+	}
+
+	contents, _, err = tt.env.content.ListContent(tt.alice.ID, ContentFilter{TeamID: &tt.aliceTeam.ID, Limit: 50})
+	if err != nil {
+		t.Fatalf("list team content: %v", err)
+	}
+	if len(contents) != 1 || contents[0].ID != tt.aliceTeamDoc.ID {
+		t.Fatalf("expected only the team's document, got %d items", len(contents))
+	}
+}
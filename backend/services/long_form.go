@@ -0,0 +1,497 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultOutlineSections = 6
+	maxOutlineSections     = 12
+	maxHeadingLen          = 120
+	maxSectionNotesLen     = 1000
+	// maxSectionContext caps how much of the sections already written is
+	// sent with each new one; the most recent text is kept.
+	maxSectionContext = 6000
+)
+
+// Long-form progress event types.
+const (
+	LongFormSectionStarted   = "section_started"
+	LongFormSectionQueued    = "section_queued"
+	LongFormSectionCompleted = "section_completed"
+	LongFormEventCompleted   = "completed"
+	LongFormEventFailed      = "failed"
+)
+
+// LongFormEvent reports generation progress to subscribers.
+type LongFormEvent struct {
+	Type      string     `json:"type"`
+	Section   *int       `json:"section,omitempty"` // index into the outline
+	Heading   string     `json:"heading,omitempty"`
+	Words     int        `json:"words,omitempty"`
+	Position  int        `json:"position,omitempty"` // in the generation queue
+	ContentID *uuid.UUID `json:"content_id,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// LongFormInput describes a document to outline.
+type LongFormInput struct {
+	Title       string
+	Brief       string
+	ContentType string
+	Sections    int // approximate number of sections; 0 for the default
+	FolderID    *uuid.UUID
+}
+
+// LongFormService generates documents too long for a single model call: an
+// outline first, which the user may edit, then one section at a time with
+// the outline and the sections so far as context. Sections run in a
+// background goroutine; progress is published to subscribers.
+type LongFormService struct {
+	db      *gorm.DB
+	content *ContentService
+
+	mu          sync.Mutex
+	subscribers map[uuid.UUID][]chan LongFormEvent
+}
+
+func NewLongFormService(db *gorm.DB, content *ContentService) *LongFormService {
+	// Sections are written in-process, so anything still generating was
+	// cut off by a restart. Generating again resumes it.
+	if err := db.Model(&models.LongFormDocument{}).Where("status = ?", models.LongFormGenerating).
+		Updates(map[string]interface{}{"status": models.LongFormFailed, "error": "interrupted by a server restart"}).Error; err != nil {
+		log.Printf("failed to reset interrupted long-form documents: %v", err)
+	}
+	return &LongFormService{
+		db:          db,
+		content:     content,
+		subscribers: make(map[uuid.UUID][]chan LongFormEvent),
+	}
+}
+
+// outlineContent is the structured reply expected for an outline.
+type outlineContent struct {
+	Sections []outlineItem `json:"sections"`
+}
+
+type outlineItem struct {
+	Heading string `json:"heading"`
+	Notes   string `json:"notes"`
+}
+
+var outlineSchema = &ContentSchema{
+	ContentType: "outline",
+	Description: "An outline of a long-form document",
+	Fields: []SchemaField{
+		{Name: "sections", Type: "list of {heading, notes}", Description: "The sections in order, each with a short note on what it covers", Required: true},
+	},
+	newValue: func() StructuredContent { return &outlineContent{} },
+}
+
+func (o *outlineContent) validate(platforms []string) []string {
+	return validateOutline(o.sections())
+}
+
+func (o *outlineContent) textFields() []structuredText {
+	var fields []structuredText
+	for i := range o.Sections {
+		fields = append(fields,
+			structuredText{fmt.Sprintf("sections[%d].heading", i), &o.Sections[i].Heading},
+			structuredText{fmt.Sprintf("sections[%d].notes", i), &o.Sections[i].Notes})
+	}
+	return fields
+}
+
+func (o *outlineContent) render() string {
+	return outlineText(o.sections())
+}
+
+func (o *outlineContent) sections() []models.OutlineSection {
+	sections := make([]models.OutlineSection, len(o.Sections))
+	for i, s := range o.Sections {
+		sections[i] = models.OutlineSection{Heading: strings.TrimSpace(s.Heading), Notes: strings.TrimSpace(s.Notes)}
+	}
+	return sections
+}
+
+func validateOutline(sections []models.OutlineSection) []string {
+	var errs []string
+	if len(sections) == 0 || len(sections) > maxOutlineSections {
+		errs = append(errs, fmt.Sprintf("an outline needs 1 to %d sections", maxOutlineSections))
+	}
+	for i, s := range sections {
+		errs = checkText(errs, fmt.Sprintf("sections[%d].heading", i), s.Heading, true, maxHeadingLen)
+		errs = checkText(errs, fmt.Sprintf("sections[%d].notes", i), s.Notes, false, maxSectionNotesLen)
+	}
+	return errs
+}
+
+// CreateLongForm generates an outline for review. The brand tone resolved
+// now is pinned and used for every section.
+func (ls *LongFormService) CreateLongForm(userID uuid.UUID, in LongFormInput, opts GenerationOptions) (*models.LongFormDocument, error) {
+	if opts.Variants > 1 || opts.Structured || opts.RetrieveTopK > 0 {
+		return nil, invalidInput("n, structured and retrieve_top_k are not supported for long-form documents")
+	}
+	if in.Sections == 0 {
+		in.Sections = defaultOutlineSections
+	}
+	if in.Sections < 2 || in.Sections > maxOutlineSections {
+		return nil, invalidInput(fmt.Sprintf("sections must be between 2 and %d", maxOutlineSections))
+	}
+	if opts.TeamID != nil {
+		if err := ls.content.policy.AuthorizeTeam(userID, *opts.TeamID, PermContentEdit); err != nil {
+			return nil, err
+		}
+	}
+	if err := ls.content.checkFolder(userID, in.FolderID, opts.TeamID); err != nil {
+		return nil, err
+	}
+
+	brief := strings.TrimSpace(in.Brief)
+	if brief == "" {
+		brief = in.Title
+	}
+	req, _, err := ls.content.prepareGeneration(userID, AIRequest{
+		Prompt:      brief,
+		ContentType: in.ContentType,
+		Action:      "outline",
+		Instruction: fmt.Sprintf("Plan an outline of about %d sections for the %s titled \"%s\"", in.Sections, documentKind(in.ContentType), in.Title),
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	format := &outputFormat{schema: outlineSchema}
+	req.Format = format.instructions()
+	output, err := ls.content.runGeneration(req, format, opts.AutoCorrect)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &models.LongFormDocument{
+		UserID:      userID,
+		TeamID:      opts.TeamID,
+		FolderID:    in.FolderID,
+		Title:       in.Title,
+		Brief:       in.Brief,
+		ContentType: in.ContentType,
+		AutoCorrect: opts.AutoCorrect,
+		Outline:     output.structured.(*outlineContent).sections(),
+		Status:      models.LongFormOutlined,
+	}
+	if req.BrandTone != nil {
+		doc.BrandToneID = &req.BrandTone.ID
+		if req.BrandTone.Version > 0 {
+			doc.BrandToneVersion = &req.BrandTone.Version
+		}
+	}
+	if err := ls.db.Create(doc).Error; err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ListLongForms lists the user's personal documents, or a team's.
+func (ls *LongFormService) ListLongForms(userID uuid.UUID, teamID *uuid.UUID) ([]models.LongFormDocument, error) {
+	query := ls.db.Model(&models.LongFormDocument{})
+	if teamID != nil {
+		if err := ls.content.policy.AuthorizeTeam(userID, *teamID, PermContentView); err != nil {
+			return nil, err
+		}
+		query = query.Where("team_id = ?", *teamID)
+	} else {
+		query = query.Where("user_id = ? AND team_id IS NULL", userID)
+	}
+
+	var docs []models.LongFormDocument
+	if err := query.Order("created_at DESC").Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (ls *LongFormService) GetLongForm(docID, userID uuid.UUID) (*models.LongFormDocument, error) {
+	return ls.findLongForm(docID, userID, PermContentView)
+}
+
+// UpdateOutline replaces the outline. It can be edited until the first
+// section has been written.
+func (ls *LongFormService) UpdateOutline(docID, userID uuid.UUID, outline []models.OutlineSection) (*models.LongFormDocument, error) {
+	doc, err := ls.findLongForm(docID, userID, PermContentEdit)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Status == models.LongFormGenerating || doc.Status == models.LongFormCompleted || writtenSections(doc) > 0 {
+		return nil, conflict("the outline can no longer be edited once sections are written")
+	}
+
+	for i := range outline {
+		outline[i].Heading = strings.TrimSpace(outline[i].Heading)
+		outline[i].Notes = strings.TrimSpace(outline[i].Notes)
+		outline[i].Text = ""
+	}
+	if errs := validateOutline(outline); len(errs) > 0 {
+		return nil, invalidInput(strings.Join(errs, "; "))
+	}
+
+	doc.Outline = outline
+	if err := ls.db.Model(doc).Select("outline").Updates(doc).Error; err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// GenerateLongForm starts writing the sections in the background. A failed
+// document resumes at the first section not yet written.
+func (ls *LongFormService) GenerateLongForm(docID, userID uuid.UUID) (*models.LongFormDocument, error) {
+	doc, err := ls.findLongForm(docID, userID, PermContentEdit)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Status == models.LongFormCompleted {
+		return nil, conflict("document is already completed")
+	}
+
+	// The conditional update keeps two requests from both starting a run
+	result := ls.db.Model(&models.LongFormDocument{}).
+		Where("id = ? AND status IN ?", doc.ID, []string{models.LongFormOutlined, models.LongFormFailed}).
+		Updates(map[string]interface{}{"status": models.LongFormGenerating, "error": ""})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, conflict("document is already generating")
+	}
+	doc.Status = models.LongFormGenerating
+	doc.Error = ""
+
+	go ls.run(*doc)
+	return doc, nil
+}
+
+// DeleteLongForm removes a document that is not generating. Content it was
+// assembled into is kept.
+func (ls *LongFormService) DeleteLongForm(docID, userID uuid.UUID) error {
+	doc, err := ls.findLongForm(docID, userID, PermContentDelete)
+	if err != nil {
+		return err
+	}
+	if doc.Status == models.LongFormGenerating {
+		return conflict("document is generating")
+	}
+	return ls.db.Delete(doc).Error
+}
+
+// Subscribe returns the document and, while it is generating, a channel of
+// progress events that is closed after the final completed or failed event.
+// Call the returned function to stop listening early.
+func (ls *LongFormService) Subscribe(docID, userID uuid.UUID) (*models.LongFormDocument, <-chan LongFormEvent, func(), error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	// Reading the status under the lock means a run cannot finish between
+	// the check and the registration
+	doc, err := ls.findLongForm(docID, userID, PermContentView)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if doc.Status != models.LongFormGenerating {
+		return doc, nil, func() {}, nil
+	}
+
+	ch := make(chan LongFormEvent, 3*len(doc.Outline)+2)
+	ls.subscribers[docID] = append(ls.subscribers[docID], ch)
+	unsubscribe := func() {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		subs := ls.subscribers[docID]
+		for i, sub := range subs {
+			if sub == ch {
+				ls.subscribers[docID] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+	}
+	return doc, ch, unsubscribe, nil
+}
+
+// run writes the missing sections in order and assembles the document,
+// saving after each section so a failure loses no finished work.
+func (ls *LongFormService) run(doc models.LongFormDocument) {
+	for i := range doc.Outline {
+		section := &doc.Outline[i]
+		if section.Text != "" {
+			continue
+		}
+		index := i
+		ls.publish(doc.ID, LongFormEvent{Type: LongFormSectionStarted, Section: &index, Heading: section.Heading})
+
+		text, err := ls.writeSection(&doc, i)
+		if err == nil {
+			section.Text = text
+			err = ls.db.Model(&doc).Select("outline").Updates(&doc).Error
+		}
+		if err != nil {
+			ls.finish(&doc, LongFormEvent{
+				Type:    LongFormEventFailed,
+				Section: &index,
+				Heading: section.Heading,
+				Error:   fmt.Sprintf("section %d (%s): %v", i+1, section.Heading, err),
+			})
+			return
+		}
+		ls.publish(doc.ID, LongFormEvent{Type: LongFormSectionCompleted, Section: &index, Heading: section.Heading, Words: len(strings.Fields(text))})
+	}
+
+	content, err := ls.content.createContent(doc.UserID, doc.Title, assembleLongForm(&doc), doc.ContentType, nil, doc.BrandToneID, doc.BrandToneVersion, doc.TeamID, doc.FolderID)
+	if err != nil {
+		ls.finish(&doc, LongFormEvent{Type: LongFormEventFailed, Error: "saving the document: " + err.Error()})
+		return
+	}
+	doc.ContentID = &content.ID
+	ls.finish(&doc, LongFormEvent{Type: LongFormEventCompleted, ContentID: &content.ID})
+}
+
+func (ls *LongFormService) writeSection(doc *models.LongFormDocument, i int) (string, error) {
+	section := doc.Outline[i]
+	input := section.Notes
+	if input == "" {
+		input = section.Heading
+	}
+	req, _, err := ls.content.prepareGeneration(doc.UserID, AIRequest{
+		Prompt:      input,
+		Context:     sectionContext(doc, i),
+		ContentType: doc.ContentType,
+		Action:      "section",
+		Instruction: fmt.Sprintf("Write section %d of %d, \"%s\", of the %s titled \"%s\". Continue from the sections already written without repeating them, and leave out the heading",
+			i+1, len(doc.Outline), section.Heading, documentKind(doc.ContentType), doc.Title),
+	}, GenerationOptions{BrandToneID: doc.BrandToneID, BrandToneVersion: doc.BrandToneVersion, TeamID: doc.TeamID})
+	if err != nil {
+		return "", err
+	}
+	req.OnQueued = func(position int) {
+		ls.publish(doc.ID, LongFormEvent{Type: LongFormSectionQueued, Section: &i, Heading: section.Heading, Position: position})
+	}
+	output, err := ls.content.runGeneration(req, nil, doc.AutoCorrect)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(output.content)
+	if text == "" {
+		return "", errors.New("the model returned no text")
+	}
+	return text, nil
+}
+
+// finish records the final status and ends every subscription with event.
+func (ls *LongFormService) finish(doc *models.LongFormDocument, event LongFormEvent) {
+	doc.Status = models.LongFormCompleted
+	doc.Error = ""
+	if event.Type == LongFormEventFailed {
+		doc.Status = models.LongFormFailed
+		doc.Error = event.Error
+	}
+	if err := ls.db.Model(doc).Select("status", "error", "content_id").Updates(doc).Error; err != nil {
+		log.Printf("failed to save long-form document %s: %v", doc.ID, err)
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for _, ch := range ls.subscribers[doc.ID] {
+		select {
+		case ch <- event:
+		default:
+		}
+		close(ch)
+	}
+	delete(ls.subscribers, doc.ID)
+}
+
+func (ls *LongFormService) publish(docID uuid.UUID, event LongFormEvent) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for _, ch := range ls.subscribers[docID] {
+		// Channels are sized for a whole run; never block the writer
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (ls *LongFormService) findLongForm(docID, userID uuid.UUID, perm Permission) (*models.LongFormDocument, error) {
+	var doc models.LongFormDocument
+	if err := ls.db.First(&doc, docID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("document not found")
+		}
+		return nil, err
+	}
+	if err := ls.content.policy.Authorize(userID, doc.UserID, doc.TeamID, perm); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func writtenSections(doc *models.LongFormDocument) int {
+	n := 0
+	for _, s := range doc.Outline {
+		if s.Text != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// sectionContext gives the model the whole outline and the most recent
+// text written before section i.
+func sectionContext(doc *models.LongFormDocument, i int) string {
+	context := "Outline:\n" + outlineText(doc.Outline)
+	if i == 0 {
+		return context
+	}
+	written := make([]string, i)
+	for j, s := range doc.Outline[:i] {
+		written[j] = "## " + s.Heading + "\n\n" + s.Text
+	}
+	previous := []rune(strings.Join(written, "\n\n"))
+	if len(previous) > maxSectionContext {
+		previous = append([]rune("..."), previous[len(previous)-maxSectionContext:]...)
+	}
+	return context + "\n\nWritten so far:\n\n" + string(previous)
+}
+
+func outlineText(sections []models.OutlineSection) string {
+	lines := make([]string, len(sections))
+	for i, s := range sections {
+		lines[i] = fmt.Sprintf("%d. %s", i+1, s.Heading)
+		if s.Notes != "" {
+			lines[i] += ": " + s.Notes
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func assembleLongForm(doc *models.LongFormDocument) string {
+	var b strings.Builder
+	b.WriteString("# " + doc.Title)
+	for _, s := range doc.Outline {
+		b.WriteString("\n\n## " + s.Heading + "\n\n" + s.Text)
+	}
+	return b.String()
+}
+
+func documentKind(contentType string) string {
+	if contentType == "" {
+		return "document"
+	}
+	return contentType
+}
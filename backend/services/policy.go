@@ -0,0 +1,251 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type Permission string
+
+const (
+	PermBrandView      Permission = "brand:view"
+	PermBrandCreate    Permission = "brand:create"
+	PermBrandEdit      Permission = "brand:edit"
+	PermBrandDelete    Permission = "brand:delete"
+	PermContentView    Permission = "content:view"
+	PermContentEdit    Permission = "content:edit"
+	PermContentComment Permission = "content:comment"
+	PermContentDelete  Permission = "content:delete"
+	PermContentShare   Permission = "content:share"
+	PermContentPublish Permission = "content:publish"
+	PermTeamManage     Permission = "team:manage"
+	PermTeamRoles      Permission = "team:roles"
+	PermPromptEdit     Permission = "prompt:edit"
+)
+
+// AllPermissions lists every permission that can be granted to a role.
+var AllPermissions = []Permission{
+	PermBrandView,
+	PermBrandCreate,
+	PermBrandEdit,
+	PermBrandDelete,
+	PermContentView,
+	PermContentEdit,
+	PermContentComment,
+	PermContentDelete,
+	PermContentShare,
+	PermContentPublish,
+	PermTeamManage,
+	PermTeamRoles,
+	PermPromptEdit,
+}
+
+// builtinRoles maps the built-in team roles to their permissions. Deleting or
+// transferring a team is reserved for its owner and checked separately.
+var builtinRoles = map[string][]Permission{
+	models.RoleOwner: AllPermissions,
+	models.RoleAdmin: AllPermissions,
+	models.RoleMember: {
+		PermBrandView,
+		PermContentView,
+		PermContentEdit,
+		PermContentComment,
+	},
+}
+
+// sharePermissions maps collaboration share actions to what they grant on a
+// single content item.
+var sharePermissions = map[string][]Permission{
+	"view":    {PermContentView},
+	"comment": {PermContentView, PermContentComment},
+	"edit":    {PermContentView, PermContentComment, PermContentEdit},
+}
+
+// PolicyService is the single place where access decisions are made.
+type PolicyService struct {
+	db *gorm.DB
+}
+
+func NewPolicyService(db *gorm.DB) *PolicyService {
+	return &PolicyService{db: db}
+}
+
+func IsBuiltinRole(role string) bool {
+	_, ok := builtinRoles[role]
+	return ok
+}
+
+func IsValidPermission(perm Permission) bool {
+	for _, p := range AllPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// TeamPermissions returns the permissions the user holds in the team, or an
+// empty set when they are not a member.
+func (ps *PolicyService) TeamPermissions(teamID, userID uuid.UUID) (map[Permission]bool, error) {
+	var member models.TeamMember
+	if err := ps.db.Where("team_id = ? AND user_id = ?", teamID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return make(map[Permission]bool), nil
+		}
+		return nil, err
+	}
+	return ps.RolePermissions(teamID, member.Role)
+}
+
+// RolePermissions returns the permissions a built-in or custom role grants
+// in the team, or an empty set for a role the team does not define.
+func (ps *PolicyService) RolePermissions(teamID uuid.UUID, role string) (map[Permission]bool, error) {
+	perms := make(map[Permission]bool)
+
+	if granted, ok := builtinRoles[role]; ok {
+		for _, p := range granted {
+			perms[p] = true
+		}
+		return perms, nil
+	}
+
+	var teamRole models.TeamRole
+	if err := ps.db.Where("team_id = ? AND name = ?", teamID, role).First(&teamRole).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return perms, nil
+		}
+		return nil, err
+	}
+	for _, p := range teamRole.Permissions {
+		perms[Permission(p)] = true
+	}
+	return perms, nil
+}
+
+// Can reports whether the user holds perm in the team.
+func (ps *PolicyService) Can(userID, teamID uuid.UUID, perm Permission) (bool, error) {
+	perms, err := ps.TeamPermissions(teamID, userID)
+	if err != nil {
+		return false, err
+	}
+	return perms[perm], nil
+}
+
+// AuthorizeTeam fails unless the user holds perm in the team.
+func (ps *PolicyService) AuthorizeTeam(userID, teamID uuid.UUID, perm Permission) error {
+	ok, err := ps.Can(userID, teamID, perm)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return forbidden("missing permission " + string(perm))
+	}
+	return nil
+}
+
+// AuthorizeAdmin fails unless the user is a platform admin, listed by email
+// in the comma-separated ADMIN_EMAILS environment variable.
+func (ps *PolicyService) AuthorizeAdmin(userID uuid.UUID) error {
+	var user models.User
+	if err := ps.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return forbidden("admin access required")
+		}
+		return err
+	}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" && strings.EqualFold(email, user.Email) {
+			return nil
+		}
+	}
+	return forbidden("admin access required")
+}
+
+// Authorize checks perm on a resource created by ownerID and optionally
+// shared with a team. Creators keep full control of their personal
+// resources; a team's resources belong to the team, so access follows the
+// team role rather than authorship, as for content.
+func (ps *PolicyService) Authorize(userID uuid.UUID, ownerID uuid.UUID, teamID *uuid.UUID, perm Permission) error {
+	if teamID != nil {
+		return ps.AuthorizeTeam(userID, *teamID, perm)
+	}
+	if userID != ownerID {
+		return forbidden("missing permission " + string(perm))
+	}
+	return nil
+}
+
+// AuthorizeContent checks perm on a content item, additionally honouring
+// per-item shares recorded as collaborations. Content in a team workspace
+// belongs to the team, so access follows the team role rather than
+// authorship.
+func (ps *PolicyService) AuthorizeContent(userID uuid.UUID, content *models.Content, perm Permission) error {
+	if content.TeamID != nil {
+		ok, err := ps.Can(userID, *content.TeamID, perm)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	} else if content.UserID == userID {
+		return nil
+	}
+
+	// Comments are stored as collaborations too; only rows without comment
+	// text are shares.
+	var actions []string
+	if err := ps.db.Model(&models.Collaboration{}).
+		Where("content_id = ? AND user_id = ? AND action IN ? AND comment = ''", content.ID, userID, []string{"view", "comment", "edit"}).
+		Distinct().
+		Pluck("action", &actions).Error; err != nil {
+		return err
+	}
+	for _, action := range actions {
+		for _, p := range sharePermissions[action] {
+			if p == perm {
+				return nil
+			}
+		}
+	}
+
+	return forbidden("missing permission " + string(perm))
+}
+
+// TeamsWithPermission returns the IDs of the teams in which the user holds perm.
+func (ps *PolicyService) TeamsWithPermission(userID uuid.UUID, perm Permission) ([]uuid.UUID, error) {
+	var memberships []models.TeamMember
+	if err := ps.db.Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+
+	teamIDs := []uuid.UUID{}
+	for _, m := range memberships {
+		ok, err := ps.Can(userID, m.TeamID, perm)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			teamIDs = append(teamIDs, m.TeamID)
+		}
+	}
+	return teamIDs, nil
+}
+
+// AuthorizeFolder checks perm on a folder. Team folders inherit the team's
+// content permissions; personal folders belong to their creator.
+func (ps *PolicyService) AuthorizeFolder(userID uuid.UUID, folder *models.Folder, perm Permission) error {
+	if folder.TeamID != nil {
+		return ps.AuthorizeTeam(userID, *folder.TeamID, perm)
+	}
+	if folder.UserID != userID {
+		return forbidden("missing permission " + string(perm))
+	}
+	return nil
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Sources of the template an action uses, from most to least specific.
+const (
+	PromptSourceTeam    = "team"
+	PromptSourceGlobal  = "global"
+	PromptSourceBuiltin = "builtin"
+)
+
+const (
+	maxPromptTemplateLen = 10000
+	maxRenderedPromptLen = 100000
+)
+
+// promptDetails renders everything except the instruction line. The built-in
+// templates reproduce the prompts used before templates were editable.
+const promptDetails = `{{if .Context}}Context: {{.Context}}
+
+{{end}}{{if .ContentType}}Content type: {{.ContentType}}
+
+{{end}}{{if .Tone}}Write in the following brand tone:
+{{.Tone}}
+
+{{end}}{{if .Glossary}}Follow these terminology rules:
+{{.Glossary}}
+
+{{end}}{{.Input}}`
+
+var builtinPrompts = map[string]string{
+	"compose": "Compose the following content:\n\n" + promptDetails,
+	"enhance": "Enhance and improve the following content while maintaining its meaning:\n\n" + promptDetails,
+	// Long-form documents: the instruction names the document and section
+	"outline": "{{.Instruction}}:\n\n" + promptDetails,
+	"section": "{{.Instruction}}:\n\n" + promptDetails,
+}
+
+// builtinTransformPrompt is the default for every transform action; the
+// action supplies the instruction.
+const builtinTransformPrompt = "{{.Instruction}}:\n\n" + promptDetails
+
+// PromptVariables are the values a template can use.
+type PromptVariables struct {
+	Action      string // compose, enhance, outline, section or a transform action
+	Input       string // the user's prompt or the text being worked on
+	Instruction string // what a transform action should do, or which document and section to write
+	Context     string
+	ContentType string
+	Tone        string // brand tone instructions, one per line
+	Glossary    string // glossary rules, one per line
+}
+
+// PromptTemplateInfo is the template an action currently uses in a scope.
+type PromptTemplateInfo struct {
+	Action    string     `json:"action"`
+	Source    string     `json:"source"`
+	TeamID    *uuid.UUID `json:"team_id,omitempty"`
+	Version   int        `json:"version"` // 0 for built-in templates
+	Body      string     `json:"body"`
+	Variables []string   `json:"variables"`
+}
+
+var promptVariableNames = []string{"Action", "Input", "Instruction", "Context", "ContentType", "Tone", "Glossary"}
+
+type PromptService struct {
+	db     *gorm.DB
+	policy *PolicyService
+}
+
+func NewPromptService(db *gorm.DB, policy *PolicyService) *PromptService {
+	return &PromptService{db: db, policy: policy}
+}
+
+// PromptActions lists the actions whose prompts are templated.
+func PromptActions() []string {
+	actions := []string{"compose", "enhance", "outline", "section"}
+	for _, a := range TransformActions() {
+		actions = append(actions, a.Name)
+	}
+	return actions
+}
+
+func isPromptAction(action string) bool {
+	if _, ok := builtinPrompts[action]; ok {
+		return true
+	}
+	_, ok := transformActions[action]
+	return ok
+}
+
+// ListPromptTemplates returns the template each action uses in a scope:
+// globally, or in a team with its overrides applied.
+func (ps *PromptService) ListPromptTemplates(userID uuid.UUID, teamID *uuid.UUID) ([]PromptTemplateInfo, error) {
+	if err := ps.authorize(userID, teamID); err != nil {
+		return nil, err
+	}
+
+	var templates []PromptTemplateInfo
+	for _, action := range PromptActions() {
+		info, err := ps.effectiveTemplate(action, teamID)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *info)
+	}
+	return templates, nil
+}
+
+func (ps *PromptService) ListPromptTemplateVersions(userID uuid.UUID, action string, teamID *uuid.UUID) ([]models.PromptTemplate, error) {
+	if err := ps.checkAction(action); err != nil {
+		return nil, err
+	}
+	if err := ps.authorize(userID, teamID); err != nil {
+		return nil, err
+	}
+
+	var versions []models.PromptTemplate
+	if err := ps.scope(action, teamID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// UpdatePromptTemplate saves body as the next version of the action's
+// template in the scope. The template must parse, render and use .Input.
+func (ps *PromptService) UpdatePromptTemplate(userID uuid.UUID, action string, teamID *uuid.UUID, body, note string) (*models.PromptTemplate, error) {
+	if err := ps.checkAction(action); err != nil {
+		return nil, err
+	}
+	if err := ps.authorize(userID, teamID); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(body) == "" {
+		return nil, invalidInput("body is required")
+	}
+	if err := validatePromptTemplate(body); err != nil {
+		return nil, err
+	}
+	return ps.createVersion(userID, action, teamID, body, strings.TrimSpace(note))
+}
+
+// RestorePromptTemplate makes an earlier version current by saving a copy of
+// it as a new version.
+func (ps *PromptService) RestorePromptTemplate(userID uuid.UUID, action string, teamID *uuid.UUID, version int) (*models.PromptTemplate, error) {
+	if err := ps.checkAction(action); err != nil {
+		return nil, err
+	}
+	if err := ps.authorize(userID, teamID); err != nil {
+		return nil, err
+	}
+
+	var target models.PromptTemplate
+	if err := ps.scope(action, teamID).Where("version = ?", version).First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound(fmt.Sprintf("version %d not found", version))
+		}
+		return nil, err
+	}
+	if target.Body != "" {
+		if err := validatePromptTemplate(target.Body); err != nil {
+			return nil, err
+		}
+	}
+	return ps.createVersion(userID, action, teamID, target.Body, fmt.Sprintf("restored version %d", version))
+}
+
+// ResetPromptTemplate makes the scope inherit again: a team falls back to the
+// global template and the global template to the built-in one. It is saved
+// as an empty version so history is kept.
+func (ps *PromptService) ResetPromptTemplate(userID uuid.UUID, action string, teamID *uuid.UUID) (*models.PromptTemplate, error) {
+	if err := ps.checkAction(action); err != nil {
+		return nil, err
+	}
+	if err := ps.authorize(userID, teamID); err != nil {
+		return nil, err
+	}
+
+	latest, err := ps.latest(action, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil || latest.Body == "" {
+		return nil, conflict("no template to reset")
+	}
+	return ps.createVersion(userID, action, teamID, "", "reset")
+}
+
+// PromptPreview is a rendered prompt and the template it came from.
+type PromptPreview struct {
+	Prompt    string              `json:"prompt"`
+	Template  *PromptTemplateInfo `json:"template"`
+	BrandTone *ToneResolution     `json:"brand_tone_resolution"`
+}
+
+// PromptPreviewInput is what a generation would be called with, plus an
+// optional Draft template body to render instead of the current one.
+type PromptPreviewInput struct {
+	Action           string
+	TeamID           *uuid.UUID
+	Draft            *string
+	Input            string
+	Context          string
+	ContentType      string
+	BrandToneID      *uuid.UUID
+	BrandToneVersion *int
+	Params           map[string]string // transform action parameters
+}
+
+// previewInput stands in for the user's text when a preview has none.
+const previewInput = "(your text here)"
+
+// previewInstructions stand in for the instructions long-form documents
+// generate per document and section.
+var previewInstructions = map[string]string{
+	"outline": "Plan an outline of about 6 sections for the document titled \"(your title)\"",
+	"section": "Write section 1 of 6, \"(section heading)\", of the document titled \"(your title)\". Continue from the sections already written without repeating them, and leave out the heading",
+}
+
+// PreviewPrompt renders the prompt an action would send to the model,
+// resolving the brand tone and glossary as generation does, without calling
+// the model. A draft is rendered instead of the current template so edits
+// can be checked before saving.
+func (ps *PromptService) PreviewPrompt(userID uuid.UUID, in PromptPreviewInput) (*PromptPreview, error) {
+	if err := ps.checkAction(in.Action); err != nil {
+		return nil, err
+	}
+	if err := ps.authorize(userID, in.TeamID); err != nil {
+		return nil, err
+	}
+
+	info, err := ps.effectiveTemplate(in.Action, in.TeamID)
+	if err != nil {
+		return nil, err
+	}
+	if in.Draft != nil {
+		if err := validatePromptTemplate(*in.Draft); err != nil {
+			return nil, err
+		}
+		info = &PromptTemplateInfo{Action: in.Action, Source: "draft", TeamID: in.TeamID, Body: *in.Draft, Variables: promptVariableNames}
+	}
+
+	req := AIRequest{Prompt: in.Input, Context: in.Context, ContentType: in.ContentType, Action: in.Action}
+	if strings.TrimSpace(req.Prompt) == "" {
+		req.Prompt = previewInput
+	}
+	if action, ok := transformActions[in.Action]; ok {
+		if req.Instruction, err = action.instruction(req.Prompt, in.Params); err != nil {
+			return nil, err
+		}
+	} else {
+		req.Instruction = previewInstructions[in.Action]
+	}
+
+	brandTone, resolution, err := resolveBrandTone(ps.db, ps.policy, userID, in.BrandToneID, in.ContentType, in.TeamID)
+	if err != nil {
+		return nil, err
+	}
+	if brandTone != nil && in.BrandToneVersion != nil {
+		if brandTone, err = brandToneAtVersion(ps.db, brandTone, *in.BrandToneVersion); err != nil {
+			return nil, err
+		}
+	}
+	req.BrandTone = brandTone
+	if req.Glossary, err = loadGlossary(ps.db, brandTone, in.TeamID); err != nil {
+		return nil, err
+	}
+
+	prompt, err := renderPromptTemplate(info.Body, promptVariables(req))
+	if err != nil {
+		return nil, invalidInput(err.Error())
+	}
+	return &PromptPreview{Prompt: prompt, Template: info, BrandTone: resolution}, nil
+}
+
+// Render builds the prompt for an action from the template in effect for
+// the team, or globally when teamID is nil.
+func (ps *PromptService) Render(teamID *uuid.UUID, vars PromptVariables) (string, error) {
+	info, err := ps.effectiveTemplate(vars.Action, teamID)
+	if err != nil {
+		return "", err
+	}
+	return renderPromptTemplate(info.Body, vars)
+}
+
+// effectiveTemplate finds the template an action uses: the team's override,
+// then the global template, then the built-in default.
+func (ps *PromptService) effectiveTemplate(action string, teamID *uuid.UUID) (*PromptTemplateInfo, error) {
+	scopes := []*uuid.UUID{nil}
+	if teamID != nil {
+		scopes = []*uuid.UUID{teamID, nil}
+	}
+	for _, scope := range scopes {
+		latest, err := ps.latest(action, scope)
+		if err != nil {
+			return nil, err
+		}
+		if latest != nil && latest.Body != "" {
+			source := PromptSourceGlobal
+			if scope != nil {
+				source = PromptSourceTeam
+			}
+			return &PromptTemplateInfo{
+				Action:    action,
+				Source:    source,
+				TeamID:    scope,
+				Version:   latest.Version,
+				Body:      latest.Body,
+				Variables: promptVariableNames,
+			}, nil
+		}
+	}
+
+	body, ok := builtinPrompts[action]
+	if !ok {
+		body = builtinTransformPrompt
+	}
+	return &PromptTemplateInfo{Action: action, Source: PromptSourceBuiltin, Body: body, Variables: promptVariableNames}, nil
+}
+
+func (ps *PromptService) latest(action string, teamID *uuid.UUID) (*models.PromptTemplate, error) {
+	var t models.PromptTemplate
+	if err := ps.scope(action, teamID).Order("version DESC").First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (ps *PromptService) createVersion(userID uuid.UUID, action string, teamID *uuid.UUID, body, note string) (*models.PromptTemplate, error) {
+	t := &models.PromptTemplate{Action: action, TeamID: teamID, Body: body, Note: note, CreatedBy: userID}
+	err := ps.db.Transaction(func(tx *gorm.DB) error {
+		var current int
+		if err := ps.scopeIn(tx, action, teamID).Model(&models.PromptTemplate{}).Select("COALESCE(MAX(version), 0)").Scan(&current).Error; err != nil {
+			return err
+		}
+		t.Version = current + 1
+		return tx.Create(t).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (ps *PromptService) scope(action string, teamID *uuid.UUID) *gorm.DB {
+	return ps.scopeIn(ps.db, action, teamID)
+}
+
+func (ps *PromptService) scopeIn(db *gorm.DB, action string, teamID *uuid.UUID) *gorm.DB {
+	if teamID == nil {
+		return db.Where("action = ? AND team_id IS NULL", action)
+	}
+	return db.Where("action = ? AND team_id = ?", action, *teamID)
+}
+
+// authorize checks the user may manage templates in the scope: platform
+// admins for global templates, prompt:edit for a team's overrides.
+func (ps *PromptService) authorize(userID uuid.UUID, teamID *uuid.UUID) error {
+	if teamID == nil {
+		return ps.policy.AuthorizeAdmin(userID)
+	}
+	return ps.policy.AuthorizeTeam(userID, *teamID, PermPromptEdit)
+}
+
+func (ps *PromptService) checkAction(action string) error {
+	if !isPromptAction(action) {
+		actions := PromptActions()
+		sort.Strings(actions)
+		return notFound("no prompt template for \"" + action + "\"; templated actions are " + strings.Join(actions, ", "))
+	}
+	return nil
+}
+
+// validatePromptTemplate parses body and renders it with sample values,
+// rejecting templates that fail or that drop the user's input.
+func validatePromptTemplate(body string) error {
+	if len(body) > maxPromptTemplateLen {
+		return invalidInput(fmt.Sprintf("templates must be at most %d characters", maxPromptTemplateLen))
+	}
+
+	const marker = "\x00input\x00"
+	rendered, err := renderPromptTemplate(body, PromptVariables{
+		Action:      "compose",
+		Input:       marker,
+		Instruction: "Rewrite the following content",
+		Context:     "context",
+		ContentType: "blog",
+		Tone:        "- tone",
+		Glossary:    "- glossary",
+	})
+	if err != nil {
+		return invalidInput(err.Error())
+	}
+	if !strings.Contains(rendered, marker) {
+		return invalidInput("template must include {{.Input}}")
+	}
+	return nil
+}
+
+func renderPromptTemplate(body string, vars PromptVariables) (string, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+
+	out := &promptWriter{}
+	if err := tmpl.Execute(out, vars); err != nil {
+		if errors.Is(err, errPromptTooLong) {
+			return "", errPromptTooLong
+		}
+		return "", fmt.Errorf("template failed to render: %w", err)
+	}
+	return out.String(), nil
+}
+
+var errPromptTooLong = fmt.Errorf("rendered prompt is longer than %d characters", maxRenderedPromptLen)
+
+// promptWriter stops a template as soon as its output passes the limit,
+// so a runaway template cannot exhaust memory.
+type promptWriter struct {
+	strings.Builder
+}
+
+func (w *promptWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > maxRenderedPromptLen {
+		return 0, errPromptTooLong
+	}
+	return w.Builder.Write(p)
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultGenerationConcurrency  = 2
+	defaultGenerationQueueTimeout = 2 * time.Minute
+)
+
+// GenerationPriority orders waiting model calls: every interactive call is
+// started before any batch call.
+type GenerationPriority int
+
+const (
+	PriorityInteractive GenerationPriority = iota
+	PriorityBatch
+)
+
+func (p GenerationPriority) String() string {
+	if p == PriorityBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+// QueuedGeneration is a model call waiting for a free slot. Position 1 is
+// the next call to start.
+type QueuedGeneration struct {
+	ID        uuid.UUID `json:"id"`
+	Action    string    `json:"action"`
+	Priority  string    `json:"priority"`
+	Position  int       `json:"position"`
+	WaitingMs int64     `json:"waiting_ms"`
+}
+
+// QueueStatus describes the generation queue, with the calling user's
+// waiting calls.
+type QueueStatus struct {
+	Concurrency int                `json:"concurrency"`
+	Running     int                `json:"running"`
+	Waiting     int                `json:"waiting"`
+	Queued      []QueuedGeneration `json:"queued"`
+}
+
+type queueTicket struct {
+	id       uuid.UUID
+	userID   uuid.UUID
+	action   string
+	priority GenerationPriority
+	enqueued time.Time
+	ready    chan struct{} // closed when the call may start
+}
+
+// fairQueue serves users round-robin, one call each in turn, so a user
+// with many waiting calls cannot hold up everyone else.
+type fairQueue struct {
+	users   []uuid.UUID // users with waiting calls, in turn order
+	tickets map[uuid.UUID][]*queueTicket
+}
+
+func (fq *fairQueue) push(t *queueTicket) {
+	if len(fq.tickets[t.userID]) == 0 {
+		fq.users = append(fq.users, t.userID)
+	}
+	fq.tickets[t.userID] = append(fq.tickets[t.userID], t)
+}
+
+func (fq *fairQueue) pop() *queueTicket {
+	if len(fq.users) == 0 {
+		return nil
+	}
+	userID := fq.users[0]
+	tickets := fq.tickets[userID]
+	t := tickets[0]
+	fq.users = fq.users[1:]
+	if len(tickets) > 1 {
+		fq.tickets[userID] = tickets[1:]
+		fq.users = append(fq.users, userID)
+	} else {
+		delete(fq.tickets, userID)
+	}
+	return t
+}
+
+func (fq *fairQueue) remove(t *queueTicket) bool {
+	tickets := fq.tickets[t.userID]
+	for i, other := range tickets {
+		if other != t {
+			continue
+		}
+		if len(tickets) > 1 {
+			fq.tickets[t.userID] = append(tickets[:i:i], tickets[i+1:]...)
+			return true
+		}
+		delete(fq.tickets, t.userID)
+		for j, userID := range fq.users {
+			if userID == t.userID {
+				fq.users = append(fq.users[:j:j], fq.users[j+1:]...)
+				break
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// order lists the waiting calls in the order pop would return them.
+func (fq *fairQueue) order() []*queueTicket {
+	var order []*queueTicket
+	for round := 0; ; round++ {
+		added := false
+		for _, userID := range fq.users {
+			if tickets := fq.tickets[userID]; round < len(tickets) {
+				order = append(order, tickets[round])
+				added = true
+			}
+		}
+		if !added {
+			return order
+		}
+	}
+}
+
+// GenerationQueue bounds how many model calls run at once. The model
+// service handles only a few generations concurrently; the rest wait here
+// instead of all timing out together. Interactive calls give up after a
+// timeout; batch calls wait as long as it takes.
+type GenerationQueue struct {
+	concurrency int
+	timeout     time.Duration
+
+	mu      sync.Mutex
+	running int
+	classes [2]*fairQueue // indexed by priority
+}
+
+func NewGenerationQueue(concurrency int, timeout time.Duration) *GenerationQueue {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	q := &GenerationQueue{concurrency: concurrency, timeout: timeout}
+	for i := range q.classes {
+		q.classes[i] = &fairQueue{tickets: make(map[uuid.UUID][]*queueTicket)}
+	}
+	return q
+}
+
+// NewGenerationQueueFromEnv sizes the queue from GENERATION_CONCURRENCY
+// (default 2) and GENERATION_QUEUE_TIMEOUT, how long an interactive call may
+// wait, in seconds (default 120).
+func NewGenerationQueueFromEnv() *GenerationQueue {
+	concurrency := defaultGenerationConcurrency
+	if n, err := strconv.Atoi(os.Getenv("GENERATION_CONCURRENCY")); err == nil && n > 0 {
+		concurrency = n
+	}
+	timeout := defaultGenerationQueueTimeout
+	if n, err := strconv.Atoi(os.Getenv("GENERATION_QUEUE_TIMEOUT")); err == nil && n > 0 {
+		timeout = time.Duration(n) * time.Second
+	}
+	return NewGenerationQueue(concurrency, timeout)
+}
+
+// Acquire waits for a slot and returns the function that frees it. When
+// the call has to wait, onQueued, if set, is told its position first. A
+// call whose ctx ends while it waits leaves the queue with ctx's error.
+func (q *GenerationQueue) Acquire(ctx context.Context, userID uuid.UUID, action string, priority GenerationPriority, onQueued func(position int)) (func(), error) {
+	q.mu.Lock()
+	if q.running < q.concurrency && q.waiting() == 0 {
+		q.running++
+		q.mu.Unlock()
+		return q.releaser(), nil
+	}
+	t := &queueTicket{
+		id:       uuid.New(),
+		userID:   userID,
+		action:   action,
+		priority: priority,
+		enqueued: time.Now(),
+		ready:    make(chan struct{}),
+	}
+	q.classes[priority].push(t)
+	position := q.position(t)
+	q.mu.Unlock()
+
+	if onQueued != nil {
+		onQueued(position)
+	}
+
+	var timeout <-chan time.Time
+	if priority == PriorityInteractive && q.timeout > 0 {
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var waitErr error
+	select {
+	case <-t.ready:
+		return q.releaser(), nil
+	case <-timeout:
+		waitErr = unavailable("the model is busy; try again shortly")
+	case <-ctx.Done():
+		waitErr = ctx.Err()
+	}
+
+	q.mu.Lock()
+	removed := q.classes[priority].remove(t)
+	q.mu.Unlock()
+	if !removed {
+		// Started just as the wait ended; free the slot for the next call
+		<-t.ready
+		if ctx.Err() != nil {
+			q.releaser()()
+			return nil, ctx.Err()
+		}
+		return q.releaser(), nil
+	}
+	return nil, waitErr
+}
+
+// releaser frees a slot once, however often it is called, and starts the
+// next waiting call.
+func (q *GenerationQueue) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.running--
+			q.dispatch()
+		})
+	}
+}
+
+func (q *GenerationQueue) dispatch() {
+	for q.running < q.concurrency {
+		var t *queueTicket
+		for _, class := range q.classes {
+			if t = class.pop(); t != nil {
+				break
+			}
+		}
+		if t == nil {
+			return
+		}
+		q.running++
+		close(t.ready)
+	}
+}
+
+func (q *GenerationQueue) waiting() int {
+	n := 0
+	for _, class := range q.classes {
+		for _, tickets := range class.tickets {
+			n += len(tickets)
+		}
+	}
+	return n
+}
+
+func (q *GenerationQueue) position(t *queueTicket) int {
+	position := 0
+	for _, class := range q.classes {
+		for _, other := range class.order() {
+			position++
+			if other == t {
+				return position
+			}
+		}
+	}
+	return 0
+}
+
+// Status reports the queue's load and where the user's calls stand.
+func (q *GenerationQueue) Status(userID uuid.UUID) QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := QueueStatus{Concurrency: q.concurrency, Running: q.running, Queued: []QueuedGeneration{}}
+	now := time.Now()
+	for _, class := range q.classes {
+		for _, t := range class.order() {
+			status.Waiting++
+			if t.userID == userID {
+				status.Queued = append(status.Queued, QueuedGeneration{
+					ID:        t.id,
+					Action:    t.action,
+					Priority:  t.priority.String(),
+					Position:  status.Waiting,
+					WaitingMs: now.Sub(t.enqueued).Milliseconds(),
+				})
+			}
+		}
+	}
+	return status
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type started struct {
+	name    string
+	release func()
+}
+
+// enqueue starts a call that waits in q and returns once it is queued. The
+// call reports on starts when it gets a slot.
+func enqueue(t *testing.T, q *GenerationQueue, name string, userID uuid.UUID, priority GenerationPriority, starts chan<- started) {
+	t.Helper()
+	queued := make(chan struct{})
+	go func() {
+		release, err := q.Acquire(context.Background(), userID, "compose", priority, func(int) { close(queued) })
+		if err != nil {
+			t.Errorf("acquire %s: %v", name, err)
+			return
+		}
+		starts <- started{name, release}
+	}()
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatalf("%s was not queued", name)
+	}
+}
+
+func TestQueueServesInteractiveCallsRoundRobin(t *testing.T) {
+	q := NewGenerationQueue(1, time.Minute)
+	release, err := q.Acquire(context.Background(), uuid.New(), "compose", PriorityInteractive, nil)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	starts := make(chan started)
+	enqueue(t, q, "carol batch", carol, PriorityBatch, starts)
+	enqueue(t, q, "alice 1", alice, PriorityInteractive, starts)
+	enqueue(t, q, "alice 2", alice, PriorityInteractive, starts)
+	enqueue(t, q, "alice 3", alice, PriorityInteractive, starts)
+	enqueue(t, q, "bob 1", bob, PriorityInteractive, starts)
+
+	status := q.Status(bob)
+	if status.Waiting != 5 || len(status.Queued) != 1 || status.Queued[0].Position != 2 {
+		t.Fatalf("expected bob second of 5 waiting calls, got %+v", status)
+	}
+
+	release()
+	want := []string{"alice 1", "bob 1", "alice 2", "alice 3", "carol batch"}
+	for _, name := range want {
+		select {
+		case s := <-starts:
+			if s.name != name {
+				t.Fatalf("expected %s to start next, got %s", name, s.name)
+			}
+			s.release()
+		case <-time.After(time.Second):
+			t.Fatalf("%s never started", name)
+		}
+	}
+	if status := q.Status(alice); status.Running != 0 || status.Waiting != 0 {
+		t.Errorf("expected an idle queue, got %+v", status)
+	}
+}
+
+func TestQueueCancelledWhileWaiting(t *testing.T) {
+	q := NewGenerationQueue(1, time.Minute)
+	release, err := q.Acquire(context.Background(), uuid.New(), "compose", PriorityInteractive, nil)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	userID := uuid.New()
+	_, err = q.Acquire(ctx, userID, "compose", PriorityBatch, func(int) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancelled call to give up, got %v", err)
+	}
+	if status := q.Status(userID); status.Waiting != 0 || status.Running != 1 {
+		t.Errorf("expected the cancelled call to leave the queue, got %+v", status)
+	}
+}
+
+func TestQueueInteractiveTimeout(t *testing.T) {
+	q := NewGenerationQueue(1, 20*time.Millisecond)
+	release, err := q.Acquire(context.Background(), uuid.New(), "compose", PriorityInteractive, nil)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release()
+
+	_, err = q.Acquire(context.Background(), uuid.New(), "compose", PriorityInteractive, nil)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected unavailable after the queue timeout, got %v", err)
+	}
+}
+
+func TestGenerateContentCancelsHungModelCall(t *testing.T) {
+	hung := make(chan struct{})
+	model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-hung:
+		}
+	}))
+	t.Cleanup(model.Close)
+	t.Cleanup(func() { close(hung) })
+	t.Setenv("GPT4ALL_PYTHON_SERVICE_URL", model.URL)
+
+	database := newTestDB(t)
+	policy := NewPolicyService(database)
+	queue := NewGenerationQueue(1, time.Minute)
+	ai := NewAIService(NewCacheService(), NewPromptService(database, policy), NewUsageService(database, policy), queue)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := ai.GenerateContent(AIRequest{Prompt: "Rate this.", Action: "rate", Ctx: ctx})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the deadline to end the call, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the model call outlived its context")
+	}
+	if status := queue.Status(uuid.Nil); status.Running != 0 {
+		t.Errorf("expected the slot to be freed, got %d running", status.Running)
+	}
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	chunkWords          = 200
+	maxRetrieveTopK     = 10
+	minRetrievalScore   = 0.2
+	maxCitationExcerpt  = 300
+	retrievalQueryLimit = 2000 // characters of the prompt used as the query
+	// At most this many chunks are scored per query, from the most recently
+	// updated content, loaded a batch at a time.
+	retrievalCandidateLimit = 5000
+	retrievalBatchSize      = 500
+
+	// Failed indexing is retried with backoff; after that the periodic
+	// sweep tries again, and also picks up content left without chunks.
+	indexRetryBackoff  = 30 * time.Second
+	indexMaxRetries    = 5
+	indexSweepInterval = 10 * time.Minute
+)
+
+// Citation is a passage of earlier content given to the model as context.
+// Index is the [n] marker it was given in the prompt.
+type Citation struct {
+	Index     int       `json:"index"`
+	ContentID uuid.UUID `json:"content_id"`
+	Title     string    `json:"title"`
+	Score     float64   `json:"score"`
+	Excerpt   string    `json:"excerpt"`
+}
+
+// retrievedPassage is a chunk that matched a query.
+type retrievedPassage struct {
+	ContentID uuid.UUID
+	Title     string
+	Text      string
+	Score     float64
+}
+
+// RetrievalService indexes content into embedded chunks and finds the
+// passages most related to a query. Indexing happens in the background
+// after content is created or updated, while the service is started.
+type RetrievalService struct {
+	db       *gorm.DB
+	policy   *PolicyService
+	embedder Embedder
+
+	mu       sync.Mutex
+	pending  map[uuid.UUID]bool
+	failures map[uuid.UUID]int // failed attempts of content not yet indexed
+	wake     chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+func NewRetrievalService(db *gorm.DB, policy *PolicyService, embedder Embedder) *RetrievalService {
+	rs := &RetrievalService{
+		db:       db,
+		policy:   policy,
+		embedder: embedder,
+		pending:  make(map[uuid.UUID]bool),
+		failures: make(map[uuid.UUID]int),
+		wake:     make(chan struct{}, 1),
+	}
+	return rs
+}
+
+// Start runs the indexing worker, which first queues unindexed content,
+// until Stop is called.
+func (rs *RetrievalService) Start() {
+	rs.stop = make(chan struct{})
+	rs.stopped = make(chan struct{})
+	go rs.worker()
+}
+
+// Stop ends the worker after the item being indexed and waits for it.
+// Content still queued is picked up by the backfill on the next start.
+func (rs *RetrievalService) Stop() {
+	close(rs.stop)
+	<-rs.stopped
+}
+
+// OnActivity queues content for indexing when its text may have changed.
+func (rs *RetrievalService) OnActivity(event *models.ActivityEvent) {
+	if event.ContentID == nil {
+		return
+	}
+	if event.Verb == VerbContentCreated || event.Verb == VerbContentUpdated {
+		rs.enqueue(*event.ContentID)
+	}
+}
+
+func (rs *RetrievalService) enqueue(contentIDs ...uuid.UUID) {
+	rs.mu.Lock()
+	for _, id := range contentIDs {
+		rs.pending[id] = true
+	}
+	rs.mu.Unlock()
+	select {
+	case rs.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (rs *RetrievalService) worker() {
+	defer close(rs.stopped)
+	rs.backfill()
+	sweep := time.NewTicker(indexSweepInterval)
+	defer sweep.Stop()
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-rs.wake:
+			rs.drain()
+		case <-sweep.C:
+			rs.sweep()
+		}
+	}
+}
+
+func (rs *RetrievalService) drain() {
+	for {
+		select {
+		case <-rs.stop:
+			return
+		default:
+		}
+		contentID, ok := rs.next()
+		if !ok {
+			return
+		}
+		err := rs.indexContent(contentID)
+
+		rs.mu.Lock()
+		if err == nil {
+			delete(rs.failures, contentID)
+			rs.mu.Unlock()
+			continue
+		}
+		rs.failures[contentID]++
+		attempts := rs.failures[contentID]
+		rs.mu.Unlock()
+
+		log.Printf("failed to index content %s (attempt %d): %v", contentID, attempts, err)
+		if attempts <= indexMaxRetries {
+			time.AfterFunc(indexRetryBackoff<<(attempts-1), func() { rs.enqueue(contentID) })
+		}
+	}
+}
+
+// sweep queues content whose retries ran out, and content still without
+// chunks, for example because the embedder was down when it was saved.
+func (rs *RetrievalService) sweep() {
+	rs.mu.Lock()
+	var ids []uuid.UUID
+	for id, attempts := range rs.failures {
+		if attempts > indexMaxRetries {
+			ids = append(ids, id)
+		}
+	}
+	rs.mu.Unlock()
+	if len(ids) > 0 {
+		rs.enqueue(ids...)
+	}
+	rs.backfill()
+}
+
+func (rs *RetrievalService) next() (uuid.UUID, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for id := range rs.pending {
+		delete(rs.pending, id)
+		return id, true
+	}
+	return uuid.Nil, false
+}
+
+// backfill queues content that has no chunks from the current embedder,
+// such as content from before indexing or after switching embedders.
+func (rs *RetrievalService) backfill() {
+	var ids []uuid.UUID
+	err := rs.db.Model(&models.Content{}).
+		Where("content <> '' AND NOT EXISTS (SELECT 1 FROM content_chunks WHERE content_chunks.content_id = contents.id AND content_chunks.model = ?)", rs.embedder.Name()).
+		Pluck("id", &ids).Error
+	if err != nil {
+		log.Printf("failed to find content to index: %v", err)
+		return
+	}
+	if len(ids) > 0 {
+		rs.enqueue(ids...)
+	}
+}
+
+// indexContent replaces a content item's chunks.
+func (rs *RetrievalService) indexContent(contentID uuid.UUID) error {
+	var content models.Content
+	if err := rs.db.First(&content, contentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return rs.db.Where("content_id = ?", contentID).Delete(&models.ContentChunk{}).Error
+		}
+		return err
+	}
+
+	passages := chunkText(content.Content)
+	var chunks []models.ContentChunk
+	if len(passages) > 0 {
+		// The title helps place short passages
+		texts := make([]string, len(passages))
+		for i, p := range passages {
+			texts[i] = content.Title + "\n\n" + p
+		}
+		embeddings, err := rs.embedder.Embed(texts)
+		if err != nil {
+			return err
+		}
+		for i, p := range passages {
+			chunks = append(chunks, models.ContentChunk{
+				ContentID: contentID,
+				Position:  i,
+				Text:      p,
+				Model:     rs.embedder.Name(),
+				Embedding: embeddings[i],
+			})
+		}
+	}
+
+	return rs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("content_id = ?", contentID).Delete(&models.ContentChunk{}).Error; err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		return tx.Create(&chunks).Error
+	})
+}
+
+// chunkText packs paragraphs into passages of about chunkWords words,
+// splitting paragraphs that are longer than that.
+func chunkText(text string) []string {
+	var chunks, current []string
+	words := 0
+	flush := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, strings.Join(current, "\n\n"))
+			current, words = nil, 0
+		}
+	}
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		fields := strings.Fields(paragraph)
+		if len(fields) == 0 {
+			continue
+		}
+		if words+len(fields) > chunkWords {
+			flush()
+		}
+		for len(fields) > chunkWords {
+			chunks = append(chunks, strings.Join(fields[:chunkWords], " "))
+			fields = fields[chunkWords:]
+		}
+		current = append(current, strings.Join(fields, " "))
+		words += len(fields)
+	}
+	flush()
+	return chunks
+}
+
+// retrieve returns up to k passages related to query from the workspace:
+// the team's content when teamID is set, otherwise the user's personal
+// content. Large workspaces are searched from their most recently updated
+// content, up to retrievalCandidateLimit chunks.
+func (rs *RetrievalService) retrieve(userID uuid.UUID, query string, teamID *uuid.UUID, k int) ([]retrievedPassage, error) {
+	scope := rs.db.Model(&models.ContentChunk{}).
+		Joins("JOIN contents ON contents.id = content_chunks.content_id").
+		Where("content_chunks.model = ?", rs.embedder.Name())
+	if teamID != nil {
+		if err := rs.policy.AuthorizeTeam(userID, *teamID, PermContentView); err != nil {
+			return nil, err
+		}
+		scope = scope.Where("contents.team_id = ?", *teamID)
+	} else {
+		scope = scope.Where("contents.user_id = ? AND contents.team_id IS NULL", userID)
+	}
+
+	scope = scope.Select("content_chunks.content_id", "content_chunks.text", "content_chunks.embedding").
+		Order("contents.updated_at DESC, content_chunks.content_id, content_chunks.position").
+		Session(&gorm.Session{})
+
+	if runes := []rune(query); len(runes) > retrievalQueryLimit {
+		query = string(runes[:retrievalQueryLimit])
+	}
+	var vector []float32
+	var passages []retrievedPassage
+	for offset := 0; offset < retrievalCandidateLimit; offset += retrievalBatchSize {
+		var chunks []models.ContentChunk
+		if err := scope.Offset(offset).Limit(retrievalBatchSize).Find(&chunks).Error; err != nil {
+			return nil, err
+		}
+		if len(chunks) == 0 {
+			break
+		}
+		if vector == nil {
+			vectors, err := rs.embedder.Embed([]string{query})
+			if err != nil {
+				return nil, err
+			}
+			vector = vectors[0]
+		}
+
+		for _, chunk := range chunks {
+			score := cosineSimilarity(vector, chunk.Embedding)
+			if score >= minRetrievalScore {
+				passages = append(passages, retrievedPassage{ContentID: chunk.ContentID, Text: chunk.Text, Score: score})
+			}
+		}
+		// Only the best k are kept between batches
+		sort.Slice(passages, func(i, j int) bool { return passages[i].Score > passages[j].Score })
+		if len(passages) > k {
+			passages = passages[:k]
+		}
+		if len(chunks) < retrievalBatchSize {
+			break
+		}
+	}
+	return passages, rs.addTitles(passages)
+}
+
+func (rs *RetrievalService) addTitles(passages []retrievedPassage) error {
+	if len(passages) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(passages))
+	for i, p := range passages {
+		ids[i] = p.ContentID
+	}
+	var contents []models.Content
+	if err := rs.db.Select("id", "title").Where("id IN ?", ids).Find(&contents).Error; err != nil {
+		return err
+	}
+	titles := make(map[uuid.UUID]string, len(contents))
+	for _, c := range contents {
+		titles[c.ID] = c.Title
+	}
+	for i := range passages {
+		passages[i].Title = titles[passages[i].ContentID]
+	}
+	return nil
+}
+
+// retrievalContext numbers the passages for the prompt and returns the
+// matching citations.
+func retrievalContext(passages []retrievedPassage) (string, []Citation) {
+	lines := []string{"Relevant passages from earlier content, numbered [n]. Use them where they help and stay consistent with them:"}
+	citations := make([]Citation, len(passages))
+	for i, p := range passages {
+		lines = append(lines, fmt.Sprintf("[%d] %s: %s", i+1, p.Title, p.Text))
+		citations[i] = Citation{
+			Index:     i + 1,
+			ContentID: p.ContentID,
+			Title:     p.Title,
+			Score:     math.Round(p.Score*1000) / 1000,
+			Excerpt:   excerpt(p.Text, maxCitationExcerpt),
+		}
+	}
+	return strings.Join(lines, "\n\n"), citations
+}
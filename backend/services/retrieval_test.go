@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"inscribeai/models"
+)
+
+func TestRetrievalScoresOnlyRecentCandidates(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	const passage = "quarterly revenue forecast for the northern region"
+
+	old := env.createContent(t, alice, "Old forecast", nil)
+	filler := env.createContent(t, alice, "Meeting notes", nil)
+	recent := env.createContent(t, alice, "New forecast", nil)
+	now := time.Now()
+	for content, updated := range map[*models.Content]time.Time{old: now.Add(-2 * time.Hour), filler: now.Add(-time.Hour), recent: now} {
+		if err := env.db.Model(content).UpdateColumn("updated_at", updated).Error; err != nil {
+			t.Fatalf("set updated_at: %v", err)
+		}
+	}
+
+	vectors, err := env.retrieval.embedder.Embed([]string{passage})
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	model := env.retrieval.embedder.Name()
+	chunks := []models.ContentChunk{
+		{ContentID: old.ID, Text: passage, Model: model, Embedding: vectors[0]},
+		{ContentID: recent.ID, Text: passage, Model: model, Embedding: vectors[0]},
+	}
+	// Enough unrelated chunks between them to push the old one past the cap
+	for i := 0; i < retrievalCandidateLimit; i++ {
+		chunks = append(chunks, models.ContentChunk{ContentID: filler.ID, Position: i, Text: "notes", Model: model, Embedding: []float32{1}})
+	}
+	if err := env.db.CreateInBatches(chunks, 500).Error; err != nil {
+		t.Fatalf("create chunks: %v", err)
+	}
+
+	passages, err := env.retrieval.retrieve(alice.ID, passage, nil, 5)
+	if err != nil {
+		t.Fatalf("retrieve: %v", err)
+	}
+	if len(passages) != 1 || passages[0].ContentID != recent.ID {
+		t.Fatalf("got %d passages, want only the recent forecast", len(passages))
+	}
+	if passages[0].Title != "New forecast" {
+		t.Errorf("passage title %q", passages[0].Title)
+	}
+}
+
+func TestRetrievalIndexesUntilStopped(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	content := env.createContent(t, alice, "Launch plan", nil)
+	if err := env.db.Model(content).Update("content", "We launch in March with a webinar.\n\nPricing follows in April.").Error; err != nil {
+		t.Fatalf("set body: %v", err)
+	}
+
+	// Starting backfills content that has no chunks yet
+	env.retrieval.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	var count int64
+	for count == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		env.db.Model(&models.ContentChunk{}).Where("content_id = ?", content.ID).Count(&count)
+	}
+	env.retrieval.Stop()
+	if count == 0 {
+		t.Fatal("content was not indexed")
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"inscribeai/db"
+	"inscribeai/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testEnv is a set of services over a fresh in-memory database, with the
+// model service replaced by a stub that echoes the prompt.
+type testEnv struct {
+	db        *gorm.DB
+	policy    *PolicyService
+	content   *ContentService
+	brand     *BrandService
+	collab    *CollaborationService
+	share     *ShareLinkService
+	workflow  *WorkflowService
+	retrieval *RetrievalService
+	usage     *UsageService
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Prompt string `json:"prompt"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(AIResponse{Content: "Generated: " + lastLine(req.Prompt)})
+	}))
+	t.Cleanup(model.Close)
+	t.Setenv("GPT4ALL_PYTHON_SERVICE_URL", model.URL)
+
+	database := newTestDB(t)
+	cache := NewCacheService()
+	policy := NewPolicyService(database)
+	activity := NewActivityService(database, policy)
+	prompts := NewPromptService(database, policy)
+	usage := NewUsageService(database, policy)
+	ai := NewAIService(cache, prompts, usage, NewGenerationQueue(2, time.Minute))
+	retrieval := NewRetrievalService(database, policy, hashEmbedder{dims: hashEmbeddingDims})
+
+	return &testEnv{
+		db:        database,
+		policy:    policy,
+		content:   NewContentService(database, ai, cache, policy, activity, retrieval),
+		brand:     NewBrandService(database, ai, policy, activity),
+		collab:    NewCollaborationService(database, policy, activity),
+		share:     NewShareLinkService(database, policy, activity, "test secret"),
+		workflow:  NewWorkflowService(database, policy, activity),
+		retrieval: retrieval,
+		usage:     usage,
+	}
+}
+
+// newTestDB migrates every model into a private in-memory SQLite database.
+// SQLite cannot use gen_random_uuid() as a column default; the models set
+// their IDs in BeforeCreate anyway, so the default is dropped.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	database, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	for _, model := range db.Models {
+		stmt := &gorm.Statement{DB: database}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("parse %T: %v", model, err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DefaultValue == "gen_random_uuid()" {
+				field.DefaultValue, field.DefaultValueInterface, field.HasDefaultValue = "", nil, false
+			}
+		}
+	}
+	if err := db.Migrate(database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return database
+}
+
+func lastLine(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	return lines[len(lines)-1]
+}
+
+func (env *testEnv) createUser(t *testing.T, name string) *models.User {
+	t.Helper()
+	user := &models.User{Email: name + "@example.com", Name: name, Password: "unused"}
+	if err := env.db.Create(user).Error; err != nil {
+		t.Fatalf("create user %s: %v", name, err)
+	}
+	return user
+}
+
+func (env *testEnv) createTeam(t *testing.T, owner *models.User, name string) *models.Team {
+	t.Helper()
+	team, err := env.collab.CreateTeam(owner.ID, name)
+	if err != nil {
+		t.Fatalf("create team %s: %v", name, err)
+	}
+	return team
+}
+
+func (env *testEnv) createBrandTone(t *testing.T, owner *models.User, name string, teamID *uuid.UUID) *models.BrandTone {
+	t.Helper()
+	tone, err := env.brand.CreateBrandTone(owner.ID, name, "", models.BrandToneSettings{Formality: models.FormalityCasual}, teamID)
+	if err != nil {
+		t.Fatalf("create brand tone %s: %v", name, err)
+	}
+	return tone
+}
+
+func (env *testEnv) createContent(t *testing.T, owner *models.User, title string, teamID *uuid.UUID) *models.Content {
+	t.Helper()
+	content, err := env.content.CreateContent(owner.ID, title, "blog", nil, nil, nil, teamID, nil)
+	if err != nil {
+		t.Fatalf("create content %s: %v", title, err)
+	}
+	return content
+}
+
+// assertDenied fails unless err hides the resource (not found) or refuses
+// access (forbidden).
+func assertDenied(t *testing.T, err error) {
+	t.Helper()
+	if err == nil {
+		t.Fatal("expected access to be denied, got no error")
+	}
+	if !errors.Is(err, ErrForbidden) && !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected forbidden or not found, got %v", err)
+	}
+}
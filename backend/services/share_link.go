@@ -0,0 +1,360 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// ShareUnlockTTL is how long an entered link password stays valid.
+	ShareUnlockTTL = time.Hour
+
+	// Failed password attempts allowed per window, from one client across
+	// all links and against one link from all clients.
+	sharePasswordAttemptsPerClient = 10
+	sharePasswordAttemptsPerLink   = 50
+	sharePasswordAttemptWindow     = 15 * time.Minute
+)
+
+// ShareAccess is what a visitor presents to open a link: the password, or
+// the unlock token issued when it was last entered, and their address for
+// throttling password guesses.
+type ShareAccess struct {
+	Password string
+	Unlock   string
+	ClientIP string
+}
+
+type ShareLinkService struct {
+	db       *gorm.DB
+	policy   *PolicyService
+	activity *ActivityService
+	attempts *attemptLimiter
+	secret   []byte
+}
+
+// NewShareLinkService signs link and unlock tokens with secret, which must
+// not be empty.
+func NewShareLinkService(db *gorm.DB, policy *PolicyService, activity *ActivityService, secret string) *ShareLinkService {
+	return &ShareLinkService{
+		db:       db,
+		policy:   policy,
+		activity: activity,
+		attempts: newAttemptLimiter(sharePasswordAttemptWindow),
+		secret:   []byte(secret),
+	}
+}
+
+// CreateShareLink issues a signed link for the content. A zero expiresIn
+// creates a link that never expires; an empty password leaves it open.
+func (ss *ShareLinkService) CreateShareLink(contentID, userID uuid.UUID, scope string, expiresIn time.Duration, password string) (*models.ShareLink, string, error) {
+	if scope != "view" && scope != "comment" {
+		return nil, "", invalidInput("scope must be view or comment")
+	}
+	if expiresIn < 0 {
+		return nil, "", invalidInput("expiry must be in the future")
+	}
+
+	var content models.Content
+	if err := ss.db.First(&content, contentID).Error; err != nil {
+		return nil, "", notFound("content not found")
+	}
+	if err := ss.policy.AuthorizeContent(userID, &content, PermContentShare); err != nil {
+		return nil, "", err
+	}
+
+	link := &models.ShareLink{
+		ContentID: contentID,
+		CreatedBy: userID,
+		Scope:     scope,
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(expiresIn)
+		link.ExpiresAt = &expiresAt
+	}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", err
+		}
+		link.PasswordHash = string(hash)
+	}
+
+	if err := ss.db.Create(link).Error; err != nil {
+		return nil, "", err
+	}
+
+	ss.activity.RecordContent(userID, VerbShareLinkCreated, &content, "created a public "+scope+" link")
+	return link, ss.signShareLink(link.ID), nil
+}
+
+func (ss *ShareLinkService) ListShareLinks(contentID, userID uuid.UUID) ([]models.ShareLink, error) {
+	var content models.Content
+	if err := ss.db.First(&content, contentID).Error; err != nil {
+		return nil, notFound("content not found")
+	}
+	if err := ss.policy.AuthorizeContent(userID, &content, PermContentShare); err != nil {
+		return nil, err
+	}
+
+	var links []models.ShareLink
+	if err := ss.db.Where("content_id = ?", contentID).Order("created_at DESC").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (ss *ShareLinkService) RevokeShareLink(linkID, userID uuid.UUID) error {
+	var link models.ShareLink
+	if err := ss.db.Preload("Content").First(&link, linkID).Error; err != nil {
+		return notFound("share link not found")
+	}
+	if err := ss.policy.AuthorizeContent(userID, &link.Content, PermContentShare); err != nil {
+		return err
+	}
+	if link.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	link.RevokedAt = &now
+	if err := ss.db.Save(&link).Error; err != nil {
+		return err
+	}
+
+	ss.activity.RecordContent(userID, VerbShareLinkRevoked, &link.Content, "revoked a public "+link.Scope+" link")
+	return nil
+}
+
+// OpenShareLink resolves a token to its content and counts the access.
+func (ss *ShareLinkService) OpenShareLink(token string, access ShareAccess) (*models.ShareLink, *models.Content, error) {
+	link, err := ss.resolve(token, access)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if err := ss.db.Model(link).Updates(map[string]interface{}{
+		"access_count":     gorm.Expr("access_count + 1"),
+		"last_accessed_at": now,
+	}).Error; err != nil {
+		return nil, nil, err
+	}
+	link.AccessCount++
+	link.LastAccessedAt = &now
+
+	return link, &link.Content, nil
+}
+
+func (ss *ShareLinkService) ListShareComments(linkID uuid.UUID) ([]models.ShareComment, error) {
+	var comments []models.ShareComment
+	if err := ss.db.Where("share_link_id = ?", linkID).Order("created_at").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// AddShareComment records a guest comment. The activity event is
+// attributed to the link's creator, since guests have no account.
+func (ss *ShareLinkService) AddShareComment(token string, access ShareAccess, authorName, comment string) (*models.ShareComment, error) {
+	link, err := ss.resolve(token, access)
+	if err != nil {
+		return nil, err
+	}
+	if link.Scope != "comment" {
+		return nil, forbidden("this link does not allow comments")
+	}
+	if strings.TrimSpace(comment) == "" {
+		return nil, invalidInput("comment is required")
+	}
+
+	shareComment := &models.ShareComment{
+		ShareLinkID: link.ID,
+		ContentID:   link.ContentID,
+		AuthorName:  strings.TrimSpace(authorName),
+		Comment:     comment,
+	}
+
+	if err := ss.db.Create(shareComment).Error; err != nil {
+		return nil, err
+	}
+
+	author := shareComment.AuthorName
+	if author == "" {
+		author = "a guest"
+	}
+	ss.activity.RecordContent(link.CreatedBy, VerbShareCommentAdded, &link.Content, author+" commented through a public link")
+	return shareComment, nil
+}
+
+// UnlockToken lets a visitor who entered the link's password open it again
+// without the password until ShareUnlockTTL passes. Changing or clearing
+// the password invalidates it.
+func (ss *ShareLinkService) UnlockToken(link *models.ShareLink) string {
+	expires := strconv.FormatInt(time.Now().Add(ShareUnlockTTL).Unix(), 10)
+	return expires + "." + ss.shareUnlockMAC(link, expires)
+}
+
+func (ss *ShareLinkService) verifyShareUnlock(link *models.ShareLink, token string) bool {
+	expires, mac, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(ss.shareUnlockMAC(link, expires)))
+}
+
+// resolve verifies the token signature and the link's state and password.
+func (ss *ShareLinkService) resolve(token string, access ShareAccess) (*models.ShareLink, error) {
+	linkID, ok := ss.verifyShareLink(token)
+	if !ok {
+		return nil, notFound("share link not found")
+	}
+
+	var link models.ShareLink
+	if err := ss.db.Preload("Content").First(&link, linkID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("share link not found")
+		}
+		return nil, err
+	}
+	if link.RevokedAt != nil {
+		return nil, gone("share link has been revoked")
+	}
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		return nil, gone("share link has expired")
+	}
+	if link.PasswordHash != "" {
+		if err := ss.checkPassword(&link, access); err != nil {
+			return nil, err
+		}
+	}
+
+	return &link, nil
+}
+
+func (ss *ShareLinkService) checkPassword(link *models.ShareLink, access ShareAccess) error {
+	if access.Password == "" {
+		if access.Unlock != "" && ss.verifyShareUnlock(link, access.Unlock) {
+			return nil
+		}
+		return unauthorized("password required")
+	}
+
+	linkKey := "link:" + link.ID.String()
+	clientKey := "client:" + access.ClientIP
+	if !ss.attempts.allow(linkKey, sharePasswordAttemptsPerLink) || !ss.attempts.allow(clientKey, sharePasswordAttemptsPerClient) {
+		return rateLimited("too many password attempts; try again later")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(access.Password)); err != nil {
+		ss.attempts.fail(linkKey)
+		ss.attempts.fail(clientKey)
+		return unauthorized("invalid password")
+	}
+	return nil
+}
+
+// attemptLimiter counts recent failures per key.
+type attemptLimiter struct {
+	window time.Duration
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func newAttemptLimiter(window time.Duration) *attemptLimiter {
+	return &attemptLimiter{window: window, failures: make(map[string][]time.Time)}
+}
+
+// allow reports whether key has had fewer than limit failures in the window.
+func (l *attemptLimiter) allow(key string, limit int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.recent(key, time.Now())) < limit
+}
+
+func (l *attemptLimiter) fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.failures[key] = append(l.recent(key, now), now)
+
+	// Drop keys nobody has failed on lately so the map stays small
+	if len(l.failures) > 10000 {
+		for other := range l.failures {
+			l.recent(other, now)
+		}
+	}
+}
+
+// recent prunes key's failures older than the window and returns the rest.
+func (l *attemptLimiter) recent(key string, now time.Time) []time.Time {
+	failures := l.failures[key]
+	i := 0
+	for i < len(failures) && now.Sub(failures[i]) >= l.window {
+		i++
+	}
+	if i == len(failures) {
+		delete(l.failures, key)
+		return nil
+	}
+	l.failures[key] = failures[i:]
+	return failures[i:]
+}
+
+// Share tokens are the link ID followed by an HMAC of it, so guessed or
+// tampered tokens are rejected before touching the database.
+func (ss *ShareLinkService) signShareLink(linkID uuid.UUID) string {
+	id := base64.RawURLEncoding.EncodeToString(linkID[:])
+	return id + "." + ss.shareLinkMAC(linkID)
+}
+
+func (ss *ShareLinkService) verifyShareLink(token string) (uuid.UUID, bool) {
+	id, mac, found := strings.Cut(token, ".")
+	if !found {
+		return uuid.Nil, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	linkID, err := uuid.FromBytes(raw)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	if !hmac.Equal([]byte(mac), []byte(ss.shareLinkMAC(linkID))) {
+		return uuid.Nil, false
+	}
+	return linkID, true
+}
+
+func (ss *ShareLinkService) shareLinkMAC(linkID uuid.UUID) string {
+	mac := hmac.New(sha256.New, ss.secret)
+	mac.Write([]byte("share-link:"))
+	mac.Write(linkID[:])
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (ss *ShareLinkService) shareUnlockMAC(link *models.ShareLink, expires string) string {
+	mac := hmac.New(sha256.New, ss.secret)
+	mac.Write([]byte("share-unlock:"))
+	mac.Write(link.ID[:])
+	mac.Write([]byte(":" + expires + ":" + link.PasswordHash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"inscribeai/models"
+)
+
+func TestSharePasswordAttemptsAreThrottled(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	content := env.createContent(t, alice, "Launch plan", nil)
+	_, token, err := env.share.CreateShareLink(content.ID, alice.ID, "view", 0, "correct horse")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	guess := ShareAccess{Password: "wrong", ClientIP: "203.0.113.1"}
+	for i := 0; i < sharePasswordAttemptsPerClient; i++ {
+		if _, _, err := env.share.OpenShareLink(token, guess); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("guess %d: got %v, want unauthorized", i+1, err)
+		}
+	}
+
+	// Once throttled even the right password is refused from that client
+	guess.Password = "correct horse"
+	if _, _, err := env.share.OpenShareLink(token, guess); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("after %d failures: got %v, want rate limited", sharePasswordAttemptsPerClient, err)
+	}
+
+	other := ShareAccess{Password: "correct horse", ClientIP: "198.51.100.7"}
+	if _, _, err := env.share.OpenShareLink(token, other); err != nil {
+		t.Fatalf("another client: %v", err)
+	}
+}
+
+func TestShareUnlockToken(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	content := env.createContent(t, alice, "Launch plan", nil)
+	link, token, err := env.share.CreateShareLink(content.ID, alice.ID, "view", 0, "correct horse")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	if _, _, err := env.share.OpenShareLink(token, ShareAccess{}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("without password: got %v, want unauthorized", err)
+	}
+
+	unlock := env.share.UnlockToken(link)
+	if _, _, err := env.share.OpenShareLink(token, ShareAccess{Unlock: unlock}); err != nil {
+		t.Fatalf("with unlock token: %v", err)
+	}
+
+	forger := NewShareLinkService(env.db, env.policy, NewActivityService(env.db, env.policy), "guessed secret")
+	if _, _, err := env.share.OpenShareLink(token, ShareAccess{Unlock: forger.UnlockToken(link)}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("unlock token signed with another secret: got %v, want unauthorized", err)
+	}
+	if _, _, err := forger.OpenShareLink(token, ShareAccess{Password: "correct horse"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("link token checked with another secret: got %v, want not found", err)
+	}
+
+	// Changing the password invalidates unlock tokens issued for the old one
+	if err := env.db.Model(&models.ShareLink{}).Where("id = ?", link.ID).Update("password_hash", "changed").Error; err != nil {
+		t.Fatalf("change password: %v", err)
+	}
+	if _, _, err := env.share.OpenShareLink(token, ShareAccess{Unlock: unlock}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("unlock token after password change: got %v, want unauthorized", err)
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSimilarLimit = 10
+	maxSimilarLimit     = 50
+	// minSimilarScore hides items that merely share a topic's vocabulary.
+	minSimilarScore = 0.3
+	// duplicateScore is the overall similarity at which saving warns.
+	duplicateScore = 0.85
+	// matchScore is how similar two passages must be to be reported.
+	matchScore      = 0.8
+	maxMatchExcerpt = 200
+	maxMatches      = 5
+)
+
+// SimilarContent is an existing content item related to another text.
+// Score is the average, over the text's passages, of each passage's best
+// match in the item; Matches are the passage pairs that overlap most.
+type SimilarContent struct {
+	ContentID uuid.UUID      `json:"content_id"`
+	Title     string         `json:"title"`
+	TeamID    *uuid.UUID     `json:"team_id"`
+	Status    string         `json:"status"`
+	Score     float64        `json:"score"`
+	Matches   []PassageMatch `json:"matches"`
+}
+
+// PassageMatch pairs a passage of the text with the passage it matched.
+type PassageMatch struct {
+	Excerpt string  `json:"excerpt"` // from the text being compared
+	Matched string  `json:"matched"` // from the similar item
+	Score   float64 `json:"score"`
+}
+
+// FindSimilar finds content the user can access that resembles a content
+// item, most similar first.
+func (cs *ContentService) FindSimilar(contentID, userID uuid.UUID, limit int) ([]SimilarContent, error) {
+	content, err := cs.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.policy.AuthorizeContent(userID, content, PermContentView); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultSimilarLimit
+	}
+	if limit > maxSimilarLimit {
+		return nil, invalidInput(fmt.Sprintf("limit must be at most %d", maxSimilarLimit))
+	}
+
+	similar, err := cs.retrieval.similar(userID, content, minSimilarScore)
+	if err != nil {
+		return nil, err
+	}
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+	return similar, nil
+}
+
+// FindDuplicates returns accessible content that nearly duplicates the
+// given item, as a warning after it is saved. It never fails the save:
+// when the text cannot be embedded no duplicates are reported.
+func (cs *ContentService) FindDuplicates(userID uuid.UUID, content *models.Content) []SimilarContent {
+	duplicates, err := cs.retrieval.similar(userID, content, duplicateScore)
+	if err != nil {
+		log.Printf("failed to check content %s for duplicates: %v", content.ID, err)
+		return []SimilarContent{}
+	}
+	return duplicates
+}
+
+// similar compares a content item's passages with accessible items'
+// indexed passages. The item is embedded afresh unless its index is up to
+// date, so text saved moments ago can be compared at once. As for
+// retrieval, at most retrievalCandidateLimit chunks of the most recently
+// updated content are compared, loaded a batch at a time.
+func (rs *RetrievalService) similar(userID uuid.UUID, content *models.Content, minScore float64) ([]SimilarContent, error) {
+	result := []SimilarContent{}
+	passages := chunkText(content.Content)
+	if len(passages) == 0 {
+		return result, nil
+	}
+	sources, err := rs.passageVectors(content, passages)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, err := rs.accessibleChunks(userID)
+	if err != nil {
+		return nil, err
+	}
+	scope = scope.Where("content_chunks.content_id <> ?", content.ID).
+		Select("content_chunks.content_id", "content_chunks.text", "content_chunks.embedding").
+		Order("contents.updated_at DESC, content_chunks.content_id, content_chunks.position").
+		Session(&gorm.Session{})
+
+	// Each candidate keeps, per passage of the item, its best score and
+	// the text that scored it when that is good enough to report
+	type candidateScores struct {
+		best    []float64
+		matched []string
+	}
+	candidates := make(map[uuid.UUID]*candidateScores)
+	for offset := 0; offset < retrievalCandidateLimit; offset += retrievalBatchSize {
+		var chunks []models.ContentChunk
+		if err := scope.Offset(offset).Limit(retrievalBatchSize).Find(&chunks).Error; err != nil {
+			return nil, err
+		}
+		for _, chunk := range chunks {
+			candidate := candidates[chunk.ContentID]
+			if candidate == nil {
+				candidate = &candidateScores{best: make([]float64, len(sources)), matched: make([]string, len(sources))}
+				candidates[chunk.ContentID] = candidate
+			}
+			for i, source := range sources {
+				if score := cosineSimilarity(source, chunk.Embedding); score > candidate.best[i] {
+					candidate.best[i] = score
+					if score >= matchScore {
+						candidate.matched[i] = chunk.Text
+					}
+				}
+			}
+		}
+		if len(chunks) < retrievalBatchSize {
+			break
+		}
+	}
+
+	for contentID, candidate := range candidates {
+		var total float64
+		var matches []PassageMatch
+		for i, best := range candidate.best {
+			total += best
+			if best >= matchScore {
+				matches = append(matches, PassageMatch{
+					Excerpt: excerpt(passages[i], maxMatchExcerpt),
+					Matched: excerpt(candidate.matched[i], maxMatchExcerpt),
+					Score:   math.Round(best*1000) / 1000,
+				})
+			}
+		}
+		score := total / float64(len(sources))
+		if score < minScore {
+			continue
+		}
+		sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+		if len(matches) > maxMatches {
+			matches = matches[:maxMatches]
+		}
+		if matches == nil {
+			matches = []PassageMatch{}
+		}
+		result = append(result, SimilarContent{ContentID: contentID, Score: math.Round(score*1000) / 1000, Matches: matches})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Score > result[j].Score })
+	return result, rs.addContentDetails(result)
+}
+
+// passageVectors reuses a content item's stored embeddings when they match
+// its current text and embeds the passages otherwise.
+func (rs *RetrievalService) passageVectors(content *models.Content, passages []string) ([][]float32, error) {
+	var chunks []models.ContentChunk
+	if err := rs.db.Where("content_id = ? AND model = ?", content.ID, rs.embedder.Name()).
+		Order("position").Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	if len(chunks) == len(passages) {
+		vectors := make([][]float32, len(chunks))
+		for i, chunk := range chunks {
+			if chunk.Text != passages[i] {
+				vectors = nil
+				break
+			}
+			vectors[i] = chunk.Embedding
+		}
+		if vectors != nil {
+			return vectors, nil
+		}
+	}
+
+	texts := make([]string, len(passages))
+	for i, p := range passages {
+		texts[i] = content.Title + "\n\n" + p
+	}
+	return rs.embedder.Embed(texts)
+}
+
+// accessibleChunks scopes chunks to content the user can view: their
+// personal content, their teams' content and content shared with them.
+func (rs *RetrievalService) accessibleChunks(userID uuid.UUID) (*gorm.DB, error) {
+	teamIDs, err := rs.policy.TeamsWithPermission(userID, PermContentView)
+	if err != nil {
+		return nil, err
+	}
+	access := rs.db.Where("contents.user_id = ? AND contents.team_id IS NULL", userID).
+		Or("contents.id IN (?)", rs.db.Model(&models.Collaboration{}).
+			Select("content_id").
+			Where("user_id = ? AND action IN ? AND comment = ''", userID, []string{"view", "comment", "edit"}))
+	if len(teamIDs) > 0 {
+		access = access.Or("contents.team_id IN ?", teamIDs)
+	}
+	return rs.db.Model(&models.ContentChunk{}).
+		Joins("JOIN contents ON contents.id = content_chunks.content_id").
+		Where("content_chunks.model = ?", rs.embedder.Name()).
+		Where(access), nil
+}
+
+func (rs *RetrievalService) addContentDetails(similar []SimilarContent) error {
+	if len(similar) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(similar))
+	for i, s := range similar {
+		ids[i] = s.ContentID
+	}
+	var contents []models.Content
+	if err := rs.db.Select("id", "title", "team_id", "status").Where("id IN ?", ids).Find(&contents).Error; err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]models.Content, len(contents))
+	for _, c := range contents {
+		byID[c.ID] = c
+	}
+	for i := range similar {
+		c := byID[similar[i].ContentID]
+		similar[i].Title, similar[i].TeamID, similar[i].Status = c.Title, c.TeamID, c.Status
+	}
+	return nil
+}
+
+func excerpt(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "…"
+}
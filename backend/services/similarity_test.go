@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"inscribeai/models"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	const body = "Our spring launch brings offline editing to every plan.\n\nTeams can now review drafts together before publishing."
+
+	withBody := func(owner *models.User, title string, updated time.Time) *models.Content {
+		content := env.createContent(t, owner, title, nil)
+		if err := env.db.Model(content).UpdateColumns(map[string]interface{}{"content": body, "updated_at": updated}).Error; err != nil {
+			t.Fatalf("set body: %v", err)
+		}
+		if err := env.retrieval.indexContent(content.ID); err != nil {
+			t.Fatalf("index %s: %v", title, err)
+		}
+		content.Content = body
+		return content
+	}
+	now := time.Now()
+	old := withBody(alice, "Old announcement", now.Add(-2*time.Hour))
+	recent := withBody(alice, "Announcement", now)
+	withBody(bob, "Bob's copy", now)
+
+	// Enough newer unrelated chunks to push the old copy past the cap
+	filler := env.createContent(t, alice, "Notes", nil)
+	env.db.Model(filler).UpdateColumn("updated_at", now.Add(-time.Hour))
+	chunks := make([]models.ContentChunk, retrievalCandidateLimit)
+	for i := range chunks {
+		chunks[i] = models.ContentChunk{ContentID: filler.ID, Position: i, Text: "notes", Model: env.retrieval.embedder.Name(), Embedding: []float32{1}}
+	}
+	if err := env.db.CreateInBatches(chunks, 500).Error; err != nil {
+		t.Fatalf("create chunks: %v", err)
+	}
+
+	draft := env.createContent(t, alice, "Draft", nil)
+	draft.Content = body
+	duplicates := env.content.FindDuplicates(alice.ID, draft)
+	if len(duplicates) != 1 || duplicates[0].ContentID != recent.ID {
+		t.Fatalf("got %d duplicates, want only the recent announcement", len(duplicates))
+	}
+	if duplicates[0].Score < duplicateScore || len(duplicates[0].Matches) != 1 || duplicates[0].Title != "Announcement" {
+		t.Errorf("duplicate %q scored %v with %d matches", duplicates[0].Title, duplicates[0].Score, len(duplicates[0].Matches))
+	}
+
+	similar, err := env.content.FindSimilar(old.ID, alice.ID, 10)
+	if err != nil {
+		t.Fatalf("find similar: %v", err)
+	}
+	for _, s := range similar {
+		if s.ContentID != recent.ID {
+			t.Errorf("similar to the old copy: %q", s.Title)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxTransformTextLen = 20000
+	maxTransformWords   = 3000
+)
+
+// TransformParam describes one parameter a transform action accepts.
+type TransformParam struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Required    bool     `json:"required"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// TransformAction is an editing action on a piece of text. instruction
+// validates the parameters and returns the instruction heading the prompt.
+type TransformAction struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Params      []TransformParam `json:"params"`
+	instruction func(text string, params map[string]string) (string, error)
+}
+
+var transformActions = map[string]*TransformAction{}
+
+func registerTransform(action *TransformAction) {
+	transformActions[action.Name] = action
+}
+
+// TransformActions lists the registered actions by name.
+func TransformActions() []TransformAction {
+	actions := make([]TransformAction, 0, len(transformActions))
+	for _, a := range transformActions {
+		actions = append(actions, *a)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Name < actions[j].Name })
+	return actions
+}
+
+var rewriteStyles = map[string]string{
+	"clearer":         ", making it clearer",
+	"simpler":         ", using simpler words and shorter sentences",
+	"more_formal":     ", in a more formal register",
+	"more_casual":     ", in a more casual register",
+	"more_persuasive": ", making it more persuasive",
+}
+
+var summaryLengths = map[string]string{
+	"short":  "one or two sentences",
+	"medium": "a short paragraph",
+	"long":   "several paragraphs",
+}
+
+var bulletLengths = map[string]string{
+	"short":  "three to five",
+	"medium": "five to eight",
+	"long":   "up to fifteen",
+}
+
+var languagePattern = regexp.MustCompile(`^[\p{L}][\p{L} ()\-]{0,39}$`)
+
+func init() {
+	registerTransform(&TransformAction{
+		Name:        "rewrite",
+		Description: "Rewrite the text, keeping its meaning",
+		Params: []TransformParam{
+			{Name: "style", Description: "How to change the text", Options: sortedKeys(rewriteStyles)},
+		},
+		instruction: func(text string, params map[string]string) (string, error) {
+			style := params["style"]
+			if err := checkOneOf("style", style, sortedKeys(rewriteStyles)...); err != nil {
+				return "", err
+			}
+			return "Rewrite the following content" + rewriteStyles[style] + ", keeping its meaning", nil
+		},
+	})
+
+	registerTransform(&TransformAction{
+		Name:        "summarize",
+		Description: "Summarise the text",
+		Params: []TransformParam{
+			{Name: "length", Description: "Summary length (default short)", Options: []string{"short", "medium", "long"}},
+			{Name: "format", Description: "Prose or a bulleted list (default paragraph)", Options: []string{"paragraph", "bullets"}},
+		},
+		instruction: func(text string, params map[string]string) (string, error) {
+			length := params["length"]
+			if length == "" {
+				length = "short"
+			}
+			if err := checkOneOf("length", length, "short", "medium", "long"); err != nil {
+				return "", err
+			}
+			if err := checkOneOf("format", params["format"], "paragraph", "bullets"); err != nil {
+				return "", err
+			}
+			if params["format"] == "bullets" {
+				return "Summarise the following content as " + bulletLengths[length] + " bullet points covering its key points", nil
+			}
+			return "Summarise the following content in " + summaryLengths[length], nil
+		},
+	})
+
+	registerTransform(&TransformAction{
+		Name:        "translate",
+		Description: "Translate the text into another language",
+		Params: []TransformParam{
+			{Name: "target_language", Description: "Language to translate into, e.g. \"German\"", Required: true},
+		},
+		instruction: func(text string, params map[string]string) (string, error) {
+			language := strings.TrimSpace(params["target_language"])
+			if language == "" {
+				return "", invalidInput("target_language is required")
+			}
+			if !languagePattern.MatchString(language) {
+				return "", invalidInput("target_language must be a language name")
+			}
+			return "Translate the following content into " + language + ". Keep its meaning, formatting and proper names, and add no commentary", nil
+		},
+	})
+
+	registerTransform(&TransformAction{
+		Name:        "expand",
+		Description: "Lengthen the text with relevant detail",
+		Params: []TransformParam{
+			{Name: "target_words", Description: "Approximate length in words (default double the input)"},
+		},
+		instruction: func(text string, params map[string]string) (string, error) {
+			words := len(strings.Fields(text))
+			target, err := targetWords(params, words*2)
+			if err != nil {
+				return "", err
+			}
+			if target <= words {
+				return "", invalidInput(fmt.Sprintf("target_words must be more than the current %d words", words))
+			}
+			return fmt.Sprintf("Expand the following content to about %d words, adding relevant detail and examples without changing its meaning", target), nil
+		},
+	})
+
+	registerTransform(&TransformAction{
+		Name:        "shorten",
+		Description: "Cut the text down, keeping the key points",
+		Params: []TransformParam{
+			{Name: "target_words", Description: "Approximate length in words (default half the input)"},
+		},
+		instruction: func(text string, params map[string]string) (string, error) {
+			words := len(strings.Fields(text))
+			target, err := targetWords(params, words/2)
+			if err != nil {
+				return "", err
+			}
+			if target >= words {
+				return "", invalidInput(fmt.Sprintf("target_words must be fewer than the current %d words", words))
+			}
+			return fmt.Sprintf("Shorten the following content to about %d words, keeping its key points", target), nil
+		},
+	})
+}
+
+func targetWords(params map[string]string, fallback int) (int, error) {
+	raw := params["target_words"]
+	if raw == "" {
+		return max(fallback, 1), nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > maxTransformWords {
+		return 0, invalidInput(fmt.Sprintf("target_words must be a number from 1 to %d", maxTransformWords))
+	}
+	return n, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TextRange is a span of character offsets, end exclusive.
+type TextRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// TransformInput is the text a transform works on: either Text, or a saved
+// content item with an optional Selection (the whole body when nil).
+type TransformInput struct {
+	Action    string
+	Text      string
+	ContentID *uuid.UUID
+	Selection *TextRange
+	Params    map[string]string
+}
+
+// TransformResult is the transformed text. For a content item it also
+// reports the selection that was transformed and the document with that
+// selection replaced; the content itself is not changed.
+type TransformResult struct {
+	*GenerationResult
+	Action    string     `json:"action"`
+	ContentID *uuid.UUID `json:"content_id,omitempty"`
+	Selection *TextRange `json:"selection,omitempty"`
+	Document  string     `json:"document,omitempty"`
+}
+
+// TransformContent runs a registered action. On a content item the item's
+// content type, workspace and pinned brand tone apply unless opts overrides
+// the tone.
+func (cs *ContentService) TransformContent(userID uuid.UUID, in TransformInput, opts GenerationOptions) (*TransformResult, error) {
+	action, ok := transformActions[in.Action]
+	if !ok {
+		return nil, invalidInput("unknown action \"" + in.Action + "\"")
+	}
+	if opts.Variants > 1 {
+		return nil, invalidInput("n is only supported by compose and enhance")
+	}
+	if opts.Structured {
+		return nil, invalidInput("structured is only supported by compose and enhance")
+	}
+	for name := range in.Params {
+		if !action.hasParam(name) {
+			return nil, invalidInput("action " + action.Name + " has no parameter \"" + name + "\"")
+		}
+	}
+	if (in.ContentID == nil) == (in.Text == "") {
+		return nil, invalidInput("exactly one of text and content_id is required")
+	}
+	if in.Selection != nil && in.ContentID == nil {
+		return nil, invalidInput("selection requires content_id")
+	}
+
+	text := in.Text
+	contentType := ""
+	var content *models.Content
+	if in.ContentID != nil {
+		var err error
+		if content, err = cs.findContent(*in.ContentID); err != nil {
+			return nil, err
+		}
+		if err := cs.policy.AuthorizeContent(userID, content, PermContentView); err != nil {
+			return nil, err
+		}
+
+		runes := []rune(content.Content)
+		if in.Selection == nil {
+			in.Selection = &TextRange{Start: 0, End: len(runes)}
+		}
+		if in.Selection.Start < 0 || in.Selection.End > len(runes) || in.Selection.Start >= in.Selection.End {
+			return nil, invalidInput(fmt.Sprintf("selection must be a non-empty range within the content's %d characters", len(runes)))
+		}
+		text = string(runes[in.Selection.Start:in.Selection.End])
+		contentType = content.ContentType
+		if opts.BrandToneID == nil {
+			opts.BrandToneID = content.BrandToneID
+			if opts.BrandToneVersion == nil {
+				opts.BrandToneVersion = content.BrandToneVersion
+			}
+		}
+		if opts.TeamID == nil {
+			opts.TeamID = content.TeamID
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, invalidInput("text is empty")
+	}
+	if len([]rune(text)) > maxTransformTextLen {
+		return nil, invalidInput(fmt.Sprintf("text must be at most %d characters", maxTransformTextLen))
+	}
+
+	instruction, err := action.instruction(text, in.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	generated, err := cs.generate(userID, AIRequest{
+		Prompt:      text,
+		ContentType: contentType,
+		Action:      action.Name,
+		Instruction: instruction,
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TransformResult{GenerationResult: generated, Action: action.Name}
+	if content != nil {
+		runes := []rune(content.Content)
+		result.ContentID = &content.ID
+		result.Selection = in.Selection
+		result.Document = string(runes[:in.Selection.Start]) + generated.Content + string(runes[in.Selection.End:])
+	}
+	return result, nil
+}
+
+func (a *TransformAction) hasParam(name string) bool {
+	for _, p := range a.Params {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
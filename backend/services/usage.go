@@ -0,0 +1,554 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Usage plans. Users start on the free plan; team workspaces without a
+// quota of their own use their owner's plan.
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanEnterprise = "enterprise"
+)
+
+// Quota is a set of limits on model calls; zero means unlimited. Periods
+// are calendar days and months in UTC.
+type Quota struct {
+	DailyRequests   int `json:"daily_requests"`
+	MonthlyRequests int `json:"monthly_requests"`
+	DailyTokens     int `json:"daily_tokens"`
+	MonthlyTokens   int `json:"monthly_tokens"`
+}
+
+// defaultPlanQuotas apply until an admin overrides a plan.
+var defaultPlanQuotas = map[string]Quota{
+	PlanFree:       {DailyRequests: 50, MonthlyRequests: 500, DailyTokens: 50000, MonthlyTokens: 500000},
+	PlanPro:        {DailyRequests: 500, MonthlyRequests: 10000, DailyTokens: 500000, MonthlyTokens: 10000000},
+	PlanEnterprise: {},
+}
+
+// Quota scopes: whose usage counts towards a limit.
+const (
+	QuotaScopeUser = "user"
+	QuotaScopeTeam = "team"
+)
+
+// QuotaError reports an exhausted quota and when it resets.
+type QuotaError struct {
+	Scope   string    `json:"scope"`  // user or team
+	Period  string    `json:"period"` // day or month
+	Metric  string    `json:"metric"` // requests or tokens
+	Limit   int       `json:"limit"`
+	Used    int       `json:"used"`
+	ResetAt time.Time `json:"reset_at"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota of %d %s per %s exceeded; resets at %s",
+		e.Scope, e.Limit, e.Metric, e.Period, e.ResetAt.Format(time.RFC3339))
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// PeriodUsage is what has been counted towards a quota in one period.
+type PeriodUsage struct {
+	Requests int       `json:"requests"`
+	Tokens   int       `json:"tokens"`
+	ResetAt  time.Time `json:"reset_at"`
+}
+
+// QuotaStatus is the quota that applies to a workspace and its usage.
+type QuotaStatus struct {
+	Scope  string      `json:"scope"`
+	Plan   string      `json:"plan,omitempty"` // empty when the team has its own quota
+	TeamID *uuid.UUID  `json:"team_id,omitempty"`
+	Limits Quota       `json:"limits"`
+	Day    PeriodUsage `json:"day"`
+	Month  PeriodUsage `json:"month"`
+}
+
+// PlanInfo is a plan with the limits currently in force.
+type PlanInfo struct {
+	Plan       string `json:"plan"`
+	Limits     Quota  `json:"limits"`
+	Overridden bool   `json:"overridden"`
+}
+
+// usageReservationTTL is how long an unsettled reservation counts towards
+// quotas, in case the server stopped before the call finished.
+const usageReservationTTL = time.Hour
+
+// UsageService meters model calls and enforces quotas. Only calls that
+// reach the model and succeed count towards quotas; cache hits and
+// failures are recorded for reporting only.
+type UsageService struct {
+	db     *gorm.DB
+	policy *PolicyService
+	now    func() time.Time
+
+	reserveMu sync.Mutex // serializes Check, so each call sees the others' reservations
+}
+
+func NewUsageService(db *gorm.DB, policy *PolicyService) *UsageService {
+	return &UsageService{db: db, policy: policy, now: time.Now}
+}
+
+// Record saves a usage record. A record with the ID of a reservation
+// settles it with the actual usage. Metering must never fail the
+// generation, so errors are only logged.
+func (us *UsageService) Record(record *models.UsageRecord) {
+	if record.UserID == uuid.Nil {
+		return
+	}
+	var err error
+	if record.ID != uuid.Nil {
+		err = us.db.Model(record).
+			Select("prompt_tokens", "completion_tokens", "latency_ms", "failed", "reserved").
+			Updates(record).Error
+	} else {
+		err = us.db.Create(record).Error
+	}
+	if err != nil {
+		log.Printf("failed to record usage for %s: %v", record.Action, err)
+	}
+}
+
+// Check fails with a QuotaError when the workspace has used up a quota.
+// Otherwise it reserves estimatedTokens for the call, so concurrent calls
+// count it before it finishes. The reservation must be settled with Record
+// or dropped with Cancel.
+func (us *UsageService) Check(userID uuid.UUID, teamID *uuid.UUID, action string, estimatedTokens int) (*models.UsageRecord, error) {
+	if userID == uuid.Nil {
+		return nil, nil
+	}
+
+	us.reserveMu.Lock()
+	defer us.reserveMu.Unlock()
+
+	var reservation *models.UsageRecord
+	err := us.db.Transaction(func(tx *gorm.DB) error {
+		source, err := quotaSourceFor(tx, userID, teamID)
+		if err != nil {
+			return err
+		}
+		if tx.Dialector.Name() == "postgres" {
+			// Other server instances reserve against the same quota too
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", source.lockKey()).Error; err != nil {
+				return err
+			}
+		}
+
+		status, err := us.status(tx, userID, teamID)
+		if err != nil {
+			return err
+		}
+		if err := quotaExceeded(status); err != nil {
+			return err
+		}
+
+		reservation = &models.UsageRecord{
+			UserID:       userID,
+			TeamID:       teamID,
+			Action:       action,
+			PromptTokens: estimatedTokens,
+			Reserved:     true,
+		}
+		return tx.Create(reservation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// Cancel drops a reservation for a call that never reached the model.
+func (us *UsageService) Cancel(reservation *models.UsageRecord) {
+	if reservation == nil {
+		return
+	}
+	if err := us.db.Where("reserved").Delete(reservation).Error; err != nil {
+		log.Printf("failed to cancel usage reservation %s: %v", reservation.ID, err)
+	}
+}
+
+// quotaExceeded returns a QuotaError for the first limit status has reached.
+func quotaExceeded(status *QuotaStatus) error {
+	checks := []struct {
+		period, metric string
+		limit, used    int
+		resetAt        time.Time
+	}{
+		{"day", "requests", status.Limits.DailyRequests, status.Day.Requests, status.Day.ResetAt},
+		{"day", "tokens", status.Limits.DailyTokens, status.Day.Tokens, status.Day.ResetAt},
+		{"month", "requests", status.Limits.MonthlyRequests, status.Month.Requests, status.Month.ResetAt},
+		{"month", "tokens", status.Limits.MonthlyTokens, status.Month.Tokens, status.Month.ResetAt},
+	}
+	for _, c := range checks {
+		if c.limit > 0 && c.used >= c.limit {
+			return &QuotaError{Scope: status.Scope, Period: c.period, Metric: c.metric, Limit: c.limit, Used: c.used, ResetAt: c.resetAt}
+		}
+	}
+	return nil
+}
+
+// QuotaStatus returns the quota for the user's personal workspace or a
+// team's, with usage so far.
+func (us *UsageService) QuotaStatus(userID uuid.UUID, teamID *uuid.UUID) (*QuotaStatus, error) {
+	if teamID != nil {
+		if err := us.policy.AuthorizeTeam(userID, *teamID, PermContentView); err != nil {
+			return nil, err
+		}
+	}
+	return us.status(us.db, userID, teamID)
+}
+
+// quotaSource is the quota a workspace draws on: a team's own quota, or
+// the plan of the user who owns the workspace. Teams without a quota of
+// their own share their owner's plan with the owner's personal workspace.
+type quotaSource struct {
+	teamQuota   *models.UsageQuota
+	planOwnerID uuid.UUID
+}
+
+func quotaSourceFor(db *gorm.DB, userID uuid.UUID, teamID *uuid.UUID) (*quotaSource, error) {
+	if teamID == nil {
+		return &quotaSource{planOwnerID: userID}, nil
+	}
+	var quota models.UsageQuota
+	err := db.Where("team_id = ?", *teamID).First(&quota).Error
+	if err == nil {
+		return &quotaSource{teamQuota: &quota}, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	var team models.Team
+	if err := db.Select("owner_id").First(&team, *teamID).Error; err != nil {
+		return nil, err
+	}
+	return &quotaSource{planOwnerID: team.OwnerID}, nil
+}
+
+// lockKey names the advisory lock that serializes reservations against
+// the quota.
+func (s *quotaSource) lockKey() string {
+	if s.teamQuota != nil {
+		return "usage:team:" + s.teamQuota.TeamID.String()
+	}
+	return "usage:user:" + s.planOwnerID.String()
+}
+
+// usage scopes query to the records that count towards the quota.
+func (s *quotaSource) usage(db, query *gorm.DB) *gorm.DB {
+	if s.teamQuota != nil {
+		return query.Where("team_id = ?", *s.teamQuota.TeamID)
+	}
+	ownerTeams := db.Model(&models.Team{}).Select("id").
+		Where("owner_id = ?", s.planOwnerID).
+		Where("id NOT IN (?)", db.Model(&models.UsageQuota{}).Select("team_id").Where("team_id IS NOT NULL"))
+	return query.Where(db.Where("user_id = ? AND team_id IS NULL", s.planOwnerID).Or("team_id IN (?)", ownerTeams))
+}
+
+// status reads the workspace's quota and usage through db, which is the
+// reservation's transaction when called from Check.
+func (us *UsageService) status(db *gorm.DB, userID uuid.UUID, teamID *uuid.UUID) (*QuotaStatus, error) {
+	status := &QuotaStatus{Scope: QuotaScopeUser, TeamID: teamID}
+	if teamID != nil {
+		status.Scope = QuotaScopeTeam
+	}
+	source, err := quotaSourceFor(db, userID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if source.teamQuota != nil {
+		status.Limits = quotaLimits(source.teamQuota)
+	} else {
+		var user models.User
+		if err := db.Select("plan").First(&user, source.planOwnerID).Error; err != nil {
+			return nil, err
+		}
+		limits, err := planLimits(db, user.Plan)
+		if err != nil {
+			return nil, err
+		}
+		status.Plan, status.Limits = planOrFree(user.Plan), limits
+	}
+
+	now := us.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	status.Day.ResetAt = day.AddDate(0, 0, 1)
+	status.Month.ResetAt = month.AddDate(0, 1, 0)
+
+	var totals struct {
+		DayRequests   int
+		DayTokens     int
+		MonthRequests int
+		MonthTokens   int
+	}
+	query := db.Model(&models.UsageRecord{}).
+		Select(`COUNT(*) FILTER (WHERE created_at >= ?) AS day_requests,
+			COALESCE(SUM(prompt_tokens + completion_tokens) FILTER (WHERE created_at >= ?), 0) AS day_tokens,
+			COUNT(*) AS month_requests,
+			COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS month_tokens`, day, day).
+		Where("created_at >= ? AND NOT cache_hit AND NOT failed", month).
+		Where("NOT reserved OR created_at >= ?", now.Add(-usageReservationTTL))
+	if err := source.usage(db, query).Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	status.Day.Requests, status.Day.Tokens = totals.DayRequests, totals.DayTokens
+	status.Month.Requests, status.Month.Tokens = totals.MonthRequests, totals.MonthTokens
+	return status, nil
+}
+
+func planOrFree(plan string) string {
+	if _, ok := defaultPlanQuotas[plan]; !ok {
+		return PlanFree
+	}
+	return plan
+}
+
+// planLimits returns a plan's limits, including any admin override.
+// Unknown plans get the free plan's limits.
+func planLimits(db *gorm.DB, plan string) (Quota, error) {
+	plan = planOrFree(plan)
+	var quota models.UsageQuota
+	err := db.Where("plan = ? AND team_id IS NULL", plan).First(&quota).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultPlanQuotas[plan], nil
+	}
+	if err != nil {
+		return Quota{}, err
+	}
+	return quotaLimits(&quota), nil
+}
+
+func quotaLimits(q *models.UsageQuota) Quota {
+	return Quota{
+		DailyRequests:   q.DailyRequests,
+		MonthlyRequests: q.MonthlyRequests,
+		DailyTokens:     q.DailyTokens,
+		MonthlyTokens:   q.MonthlyTokens,
+	}
+}
+
+// ListPlans returns every plan with its limits in force.
+func (us *UsageService) ListPlans() ([]PlanInfo, error) {
+	var overrides []models.UsageQuota
+	if err := us.db.Where("plan <> '' AND team_id IS NULL").Find(&overrides).Error; err != nil {
+		return nil, err
+	}
+	byPlan := make(map[string]*models.UsageQuota, len(overrides))
+	for i := range overrides {
+		byPlan[overrides[i].Plan] = &overrides[i]
+	}
+
+	plans := make([]PlanInfo, 0, len(defaultPlanQuotas))
+	for plan, limits := range defaultPlanQuotas {
+		info := PlanInfo{Plan: plan, Limits: limits}
+		if q, ok := byPlan[plan]; ok {
+			info.Limits, info.Overridden = quotaLimits(q), true
+		}
+		plans = append(plans, info)
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Plan < plans[j].Plan })
+	return plans, nil
+}
+
+// SetPlanQuota overrides a plan's limits. Platform admins only.
+func (us *UsageService) SetPlanQuota(userID uuid.UUID, plan string, limits Quota) (*PlanInfo, error) {
+	if err := us.policy.AuthorizeAdmin(userID); err != nil {
+		return nil, err
+	}
+	if _, ok := defaultPlanQuotas[plan]; !ok {
+		return nil, notFound("plan not found")
+	}
+	quota := models.UsageQuota{Plan: plan}
+	if err := us.saveQuota(us.db.Where("plan = ? AND team_id IS NULL", plan), &quota, userID, limits); err != nil {
+		return nil, err
+	}
+	return &PlanInfo{Plan: plan, Limits: limits, Overridden: true}, nil
+}
+
+// ResetPlanQuota restores a plan's built-in limits. Platform admins only.
+func (us *UsageService) ResetPlanQuota(userID uuid.UUID, plan string) error {
+	if err := us.policy.AuthorizeAdmin(userID); err != nil {
+		return err
+	}
+	if _, ok := defaultPlanQuotas[plan]; !ok {
+		return notFound("plan not found")
+	}
+	return us.db.Where("plan = ? AND team_id IS NULL", plan).Delete(&models.UsageQuota{}).Error
+}
+
+// SetTeamQuota gives a team workspace its own limits instead of its owner's
+// plan. Platform admins only.
+func (us *UsageService) SetTeamQuota(userID, teamID uuid.UUID, limits Quota) (*models.UsageQuota, error) {
+	if err := us.policy.AuthorizeAdmin(userID); err != nil {
+		return nil, err
+	}
+	if err := us.db.Select("id").First(&models.Team{}, teamID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("team not found")
+		}
+		return nil, err
+	}
+	quota := models.UsageQuota{TeamID: &teamID}
+	if err := us.saveQuota(us.db.Where("team_id = ?", teamID), &quota, userID, limits); err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// RemoveTeamQuota returns a team to its owner's plan. Platform admins only.
+func (us *UsageService) RemoveTeamQuota(userID, teamID uuid.UUID) error {
+	if err := us.policy.AuthorizeAdmin(userID); err != nil {
+		return err
+	}
+	return us.db.Where("team_id = ?", teamID).Delete(&models.UsageQuota{}).Error
+}
+
+// SetUserPlan moves a user to another plan. Platform admins only.
+func (us *UsageService) SetUserPlan(userID, targetID uuid.UUID, plan string) (*models.User, error) {
+	if err := us.policy.AuthorizeAdmin(userID); err != nil {
+		return nil, err
+	}
+	if _, ok := defaultPlanQuotas[plan]; !ok {
+		return nil, invalidInput("unknown plan \"" + plan + "\"")
+	}
+	var user models.User
+	if err := us.db.First(&user, targetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("user not found")
+		}
+		return nil, err
+	}
+	user.Plan = plan
+	if err := us.db.Model(&user).Update("plan", plan).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// saveQuota updates the quota matched by existing, or creates quota.
+func (us *UsageService) saveQuota(existing *gorm.DB, quota *models.UsageQuota, userID uuid.UUID, limits Quota) error {
+	if limits.DailyRequests < 0 || limits.MonthlyRequests < 0 || limits.DailyTokens < 0 || limits.MonthlyTokens < 0 {
+		return invalidInput("limits must not be negative")
+	}
+	if err := existing.First(quota).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	quota.DailyRequests = limits.DailyRequests
+	quota.MonthlyRequests = limits.MonthlyRequests
+	quota.DailyTokens = limits.DailyTokens
+	quota.MonthlyTokens = limits.MonthlyTokens
+	quota.UpdatedBy = userID
+	return us.db.Save(quota).Error
+}
+
+// defaultReportDays is the period a usage report covers without from.
+const defaultReportDays = 30
+
+// UsageFilter selects the records a usage report covers. GroupBy is day,
+// action or, for teams, user. Without To the report runs to the end of
+// today (UTC).
+type UsageFilter struct {
+	TeamID  *uuid.UUID
+	From    time.Time
+	To      time.Time // exclusive
+	GroupBy string
+}
+
+// UsageSummary totals a set of usage records.
+type UsageSummary struct {
+	Key              string  `json:"key,omitempty"`
+	Requests         int     `json:"requests"`
+	CacheHits        int     `json:"cache_hits"`
+	Failed           int     `json:"failed"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"` // of calls that reached the model
+}
+
+// UsageReport is usage over a period, in total and grouped.
+type UsageReport struct {
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	GroupBy string         `json:"group_by"`
+	Totals  UsageSummary   `json:"totals"`
+	Groups  []UsageSummary `json:"groups"`
+}
+
+// UsageReport summarises the user's personal usage, or a team's for those
+// who manage it.
+func (us *UsageService) UsageReport(userID uuid.UUID, filter UsageFilter) (*UsageReport, error) {
+	if filter.GroupBy == "" {
+		filter.GroupBy = "day"
+	}
+	if filter.To.IsZero() {
+		now := us.now().UTC()
+		filter.To = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.AddDate(0, 0, -defaultReportDays)
+	}
+	groupColumns := map[string]string{
+		"day":    "to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')",
+		"action": "action",
+	}
+	if filter.TeamID != nil {
+		if err := us.policy.AuthorizeTeam(userID, *filter.TeamID, PermTeamManage); err != nil {
+			return nil, err
+		}
+		groupColumns["user"] = "user_id::text"
+	}
+	column, ok := groupColumns[filter.GroupBy]
+	if !ok {
+		return nil, invalidInput("group_by must be day or action, or user for a team")
+	}
+	if !filter.From.Before(filter.To) {
+		return nil, invalidInput("from must be before to")
+	}
+
+	scope := func() *gorm.DB {
+		query := us.db.Model(&models.UsageRecord{}).Where("created_at >= ? AND created_at < ? AND NOT reserved", filter.From, filter.To)
+		if filter.TeamID != nil {
+			return query.Where("team_id = ?", *filter.TeamID)
+		}
+		return query.Where("user_id = ? AND team_id IS NULL", userID)
+	}
+	const aggregates = `COUNT(*) AS requests,
+		COUNT(*) FILTER (WHERE cache_hit) AS cache_hits,
+		COUNT(*) FILTER (WHERE failed) AS failed,
+		COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+		COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+		COALESCE(AVG(latency_ms) FILTER (WHERE NOT cache_hit), 0) AS avg_latency_ms`
+
+	report := &UsageReport{From: filter.From, To: filter.To, GroupBy: filter.GroupBy, Groups: []UsageSummary{}}
+	if err := scope().Select(aggregates).Scan(&report.Totals).Error; err != nil {
+		return nil, err
+	}
+	if err := scope().Select(column + " AS key, " + aggregates).Group("key").Order("key").Scan(&report.Groups).Error; err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// estimateTokens approximates a token count at four characters a token;
+// the model service does not report counts.
+func estimateTokens(text string) int {
+	return (len([]rune(text)) + 3) / 4
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+)
+
+// limitFreePlan overrides the free plan to allow requests calls a day.
+func (env *testEnv) limitFreePlan(t *testing.T, requests int) {
+	t.Helper()
+	quota := &models.UsageQuota{Plan: PlanFree, DailyRequests: requests, UpdatedBy: uuid.New()}
+	if err := env.db.Create(quota).Error; err != nil {
+		t.Fatalf("limit free plan: %v", err)
+	}
+}
+
+func assertQuotaExceeded(t *testing.T, err error, scope string) {
+	t.Helper()
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	if quotaErr.Scope != scope || quotaErr.Period != "day" || quotaErr.Metric != "requests" {
+		t.Errorf("unexpected quota error %+v", quotaErr)
+	}
+}
+
+func TestCheckCountsConcurrentReservations(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	env.limitFreePlan(t, 3)
+
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		reservations []*models.UsageRecord
+		denied       int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reservation, err := env.usage.Check(alice.ID, nil, "compose", 100)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				reservations = append(reservations, reservation)
+			case errors.Is(err, ErrQuotaExceeded):
+				denied++
+			default:
+				t.Errorf("check: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(reservations) != 3 || denied != 5 {
+		t.Fatalf("expected 3 reservations and 5 denials, got %d and %d", len(reservations), denied)
+	}
+
+	// Cancelling a call that never reached the model frees its slot
+	env.usage.Cancel(reservations[0])
+	reservation, err := env.usage.Check(alice.ID, nil, "compose", 100)
+	if err != nil {
+		t.Fatalf("check after cancel: %v", err)
+	}
+	if reservation == nil {
+		t.Fatal("expected a reservation after cancel")
+	}
+	_, err = env.usage.Check(alice.ID, nil, "compose", 100)
+	assertQuotaExceeded(t, err, QuotaScopeUser)
+}
+
+func TestCheckIgnoresFailedCalls(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	env.limitFreePlan(t, 1)
+
+	reservation, err := env.usage.Check(alice.ID, nil, "compose", 100)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	reservation.Failed, reservation.Reserved = true, false
+	env.usage.Record(reservation)
+
+	if _, err := env.usage.Check(alice.ID, nil, "compose", 100); err != nil {
+		t.Fatalf("a failed call counted towards the quota: %v", err)
+	}
+}
+
+func TestOwnerPlanTeamsShareTheOwnersQuota(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	env.limitFreePlan(t, 2)
+
+	if _, err := env.usage.Check(alice.ID, nil, "compose", 100); err != nil {
+		t.Fatalf("personal check: %v", err)
+	}
+	first := env.createTeam(t, alice, "First Co")
+	if _, err := env.usage.Check(alice.ID, &first.ID, "compose", 100); err != nil {
+		t.Fatalf("team check: %v", err)
+	}
+
+	// A new team does not bring a fresh allowance, and neither workspace has
+	// any left
+	second := env.createTeam(t, alice, "Second Co")
+	_, err := env.usage.Check(alice.ID, &second.ID, "compose", 100)
+	assertQuotaExceeded(t, err, QuotaScopeTeam)
+	_, err = env.usage.Check(alice.ID, nil, "compose", 100)
+	assertQuotaExceeded(t, err, QuotaScopeUser)
+
+	status, err := env.usage.QuotaStatus(alice.ID, &second.ID)
+	if err != nil {
+		t.Fatalf("quota status: %v", err)
+	}
+	if status.Plan != PlanFree || status.Day.Requests != 2 {
+		t.Errorf("expected the free plan with 2 requests today, got %q with %d", status.Plan, status.Day.Requests)
+	}
+}
+
+func TestTeamQuotaIsSeparateFromTheOwnersPlan(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	team := env.createTeam(t, alice, "Alice Co")
+	env.limitFreePlan(t, 1)
+	if err := env.collab.AddTeamMember(team.ID, alice.ID, bob.ID, models.RoleMember); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+	quota := &models.UsageQuota{TeamID: &team.ID, DailyRequests: 2, UpdatedBy: alice.ID}
+	if err := env.db.Create(quota).Error; err != nil {
+		t.Fatalf("set team quota: %v", err)
+	}
+
+	if _, err := env.usage.Check(alice.ID, nil, "compose", 100); err != nil {
+		t.Fatalf("personal check: %v", err)
+	}
+	// The team's own quota is unaffected by Alice's personal usage, and
+	// Bob's calls in the team do not touch his personal plan
+	for _, user := range []*models.User{alice, bob} {
+		if _, err := env.usage.Check(user.ID, &team.ID, "compose", 100); err != nil {
+			t.Fatalf("team check for %s: %v", user.Name, err)
+		}
+	}
+	_, err := env.usage.Check(bob.ID, &team.ID, "compose", 100)
+	assertQuotaExceeded(t, err, QuotaScopeTeam)
+	if _, err := env.usage.Check(bob.ID, nil, "compose", 100); err != nil {
+		t.Fatalf("bob's personal check: %v", err)
+	}
+}
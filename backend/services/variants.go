@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxVariants = 5
+	variantTTL  = time.Hour
+)
+
+// variantTemperatures spreads sampling so candidates differ. The first
+// matches the model service's default.
+var variantTemperatures = []float64{0.7, 1.0, 0.4, 1.2, 0.85}
+
+// typicalWords is the expected length of each content type, used to score
+// compositions. Enhancements are scored against the input's length.
+var typicalWords = map[string]int{
+	"email":  150,
+	"social": 50,
+	"doc":    500,
+	"blog":   800,
+}
+
+// GenerationVariant is one candidate. A variant whose generation failed has
+// Error set and no score.
+type GenerationVariant struct {
+	Index              int                 `json:"index"`
+	Content            string              `json:"content"`
+	Structured         StructuredContent   `json:"structured,omitempty"`
+	Temperature        float64             `json:"temperature"`
+	GlossaryViolations []GlossaryViolation `json:"glossary_violations"`
+	Score              *VariantScore       `json:"score,omitempty"`
+	Best               bool                `json:"best"`
+	Error              string              `json:"error,omitempty"`
+}
+
+// VariantScore rates a candidate from 0 to 100. Length compares the word
+// count with TargetWords; BrandTone is the heuristic part of a brand tone
+// analysis. Overall averages the two and deducts for glossary violations.
+type VariantScore struct {
+	Overall     int  `json:"overall"`
+	Words       int  `json:"words"`
+	TargetWords int  `json:"target_words,omitempty"`
+	Length      *int `json:"length,omitempty"`
+	BrandTone   *int `json:"brand_tone,omitempty"`
+}
+
+// generationRecord keeps a set of variants for a while so the user can save
+// one of them.
+type generationRecord struct {
+	UserID           uuid.UUID
+	ContentType      string
+	BrandToneID      *uuid.UUID
+	BrandToneVersion *int
+	TeamID           *uuid.UUID
+	Variants         []string
+	Structured       []StructuredContent // per variant, for structured generations
+}
+
+// generateVariants runs the request once per variant, each with different
+// sampling and bypassing the cache, and scores the results.
+func (cs *ContentService) generateVariants(userID uuid.UUID, req AIRequest, format *outputFormat, opts GenerationOptions, resolution *ToneResolution) (*GenerationResult, error) {
+	variants := make([]GenerationVariant, opts.Variants)
+	errs := make([]error, opts.Variants)
+	var wg sync.WaitGroup
+	for i := range variants {
+		variants[i].Index = i
+		wg.Add(1)
+		go func(v *GenerationVariant) {
+			defer wg.Done()
+			r := req
+			r.Temperature = variantTemperatures[v.Index]
+			r.SkipCache = true
+			v.Temperature = r.Temperature
+
+			output, err := cs.runGeneration(r, format, opts.AutoCorrect)
+			if err != nil {
+				errs[v.Index] = err
+				v.Error = err.Error()
+				v.GlossaryViolations = []GlossaryViolation{}
+				return
+			}
+			v.Content, v.Structured, v.GlossaryViolations = output.content, output.structured, output.violations
+			v.Score = scoreVariant(req, v.Content, v.GlossaryViolations)
+		}(&variants[i])
+	}
+	wg.Wait()
+
+	best := -1
+	for i, v := range variants {
+		if v.Score != nil && (best < 0 || v.Score.Overall > variants[best].Score.Overall) {
+			best = i
+		}
+	}
+	if best < 0 {
+		// Wrapped so a quota error still maps to its status code
+		return nil, fmt.Errorf("all %d variants failed: %w", len(variants), errs[0])
+	}
+	variants[best].Best = true
+
+	result := newGenerationResult(req, resolution)
+	result.Content = variants[best].Content
+	result.Structured = variants[best].Structured
+	result.GlossaryViolations = variants[best].GlossaryViolations
+	result.Variants = variants
+
+	record := &generationRecord{
+		UserID:           userID,
+		ContentType:      req.ContentType,
+		BrandToneID:      result.BrandToneID,
+		BrandToneVersion: result.BrandToneVersion,
+		TeamID:           opts.TeamID,
+	}
+	for _, v := range variants {
+		record.Variants = append(record.Variants, v.Content)
+		if format != nil {
+			record.Structured = append(record.Structured, v.Structured)
+		}
+	}
+	id := uuid.New()
+	cs.cache.Set(generationCacheKey(id), record, variantTTL)
+	result.GenerationID = &id
+
+	cs.activity.Record(&models.ActivityEvent{
+		ActorID:    userID,
+		Verb:       VerbContentGenerated,
+		ObjectType: "generation",
+		Summary:    fmt.Sprintf("%s generated %d variants", req.Action, len(variants)),
+	})
+	return result, nil
+}
+
+// scoreVariant rates generated text for length and brand tone compliance.
+func scoreVariant(req AIRequest, content string, violations []GlossaryViolation) *VariantScore {
+	score := &VariantScore{Words: len(strings.Fields(content))}
+
+	if req.Action == "compose" {
+		score.TargetWords = typicalWords[strings.ToLower(req.ContentType)]
+	} else {
+		score.TargetWords = len(strings.Fields(req.Prompt))
+	}
+
+	var parts []int
+	if score.TargetWords > 0 && score.Words > 0 {
+		// Full marks on target, nothing at three times too long or short
+		deviation := math.Abs(math.Log(float64(score.Words) / float64(score.TargetWords)))
+		length := int(math.Round(100 * math.Max(0, 1-deviation/math.Log(3))))
+		score.Length = &length
+		parts = append(parts, length)
+	}
+	if req.BrandTone != nil && score.Words > 0 {
+		brandTone := analyzeText(req.BrandTone, content).Score
+		score.BrandTone = &brandTone
+		parts = append(parts, brandTone)
+	}
+
+	overall := 100
+	if len(parts) > 0 {
+		sum := 0
+		for _, p := range parts {
+			sum += p
+		}
+		overall = sum / len(parts)
+	}
+	for _, v := range violations {
+		if !v.Corrected {
+			overall -= 5
+		}
+	}
+	if score.Words == 0 {
+		overall = 0
+	}
+	score.Overall = max(overall, 0)
+	return score
+}
+
+// SaveVariant saves one variant of an earlier multi-variant generation as a
+// new draft, in the generation's workspace unless teamID says otherwise.
+// Variants are kept for an hour.
+func (cs *ContentService) SaveVariant(userID, generationID uuid.UUID, index int, title string, teamID, folderID *uuid.UUID) (*models.Content, error) {
+	cached, ok := cs.cache.Get(generationCacheKey(generationID))
+	record, _ := cached.(*generationRecord)
+	if !ok || record == nil || record.UserID != userID {
+		return nil, notFound("generation not found or expired")
+	}
+	if index < 0 || index >= len(record.Variants) || record.Variants[index] == "" {
+		return nil, invalidInput(fmt.Sprintf("variant %d is not available", index))
+	}
+
+	if teamID == nil {
+		teamID = record.TeamID
+	}
+	var structured json.RawMessage
+	if record.Structured != nil {
+		var err error
+		if structured, err = json.Marshal(record.Structured[index]); err != nil {
+			return nil, err
+		}
+	}
+	return cs.createContent(userID, title, record.Variants[index], record.ContentType, structured, record.BrandToneID, record.BrandToneVersion, teamID, folderID)
+}
+
+func generationCacheKey(generationID uuid.UUID) string {
+	return "generation:" + generationID.String()
+}
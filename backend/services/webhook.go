@@ -0,0 +1,553 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	webhookMaxAttempts  = 8
+	webhookBaseBackoff  = 30 * time.Second
+	webhookMaxBackoff   = 6 * time.Hour
+	webhookPollInterval = 5 * time.Second
+	webhookBatchSize    = 20
+	webhookTimeout      = 10 * time.Second
+	// Claimed deliveries are pushed this far into the future so other
+	// workers skip them while the batch is in flight. Deliveries are sent one
+	// after another, so the lease outlasts a batch that times out throughout.
+	webhookLease = webhookBatchSize*webhookTimeout + time.Minute
+	// Only this much of a receiver's response is kept in the delivery log.
+	webhookMaxResponseBody = 1024
+)
+
+// WebhookPayload is the JSON body POSTed to subscribers.
+type WebhookPayload struct {
+	ID        uuid.UUID              `json:"id"`
+	Event     string                 `json:"event"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+type WebhookService struct {
+	db     *gorm.DB
+	policy *PolicyService
+	client *http.Client
+	// allowPrivate permits loopback and private network receivers, for
+	// trying webhooks locally. Set with WEBHOOK_ALLOW_PRIVATE_NETWORKS=true.
+	allowPrivate bool
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func NewWebhookService(db *gorm.DB, policy *PolicyService) *WebhookService {
+	ws := &WebhookService{
+		db:           db,
+		policy:       policy,
+		allowPrivate: os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true",
+	}
+	ws.client = ws.newClient()
+	return ws
+}
+
+// Start runs the delivery worker until Stop is called.
+func (ws *WebhookService) Start() {
+	ws.stop = make(chan struct{})
+	ws.stopped = make(chan struct{})
+	go ws.worker()
+}
+
+// Stop ends the worker and waits for the delivery in flight. Deliveries it
+// had claimed but not sent are retried once their lease runs out.
+func (ws *WebhookService) Stop() {
+	close(ws.stop)
+	<-ws.stopped
+}
+
+// newClient checks every address it connects to, after DNS resolution, so a
+// receiver cannot reach internal services by pointing its hostname at them
+// after the URL was validated. Proxies and redirects are not followed.
+func (ws *WebhookService) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !ws.permittedIP(ip) {
+				return fmt.Errorf("webhook receiver %s is not a public address", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// CreateWebhook subscribes url to events and returns the webhook with the
+// signing secret, which is only shown once.
+func (ws *WebhookService) CreateWebhook(userID uuid.UUID, teamID *uuid.UUID, rawURL string, events []string) (*models.Webhook, string, error) {
+	if err := ws.authorizeOwner(userID, userID, teamID); err != nil {
+		return nil, "", err
+	}
+	if err := ws.validateURL(rawURL); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	webhook := &models.Webhook{
+		UserID: userID,
+		TeamID: teamID,
+		URL:    rawURL,
+		Secret: secret,
+		Events: normalizeEvents(events),
+		Active: true,
+	}
+
+	if err := ws.db.Create(webhook).Error; err != nil {
+		return nil, "", err
+	}
+
+	return webhook, secret, nil
+}
+
+func (ws *WebhookService) ListWebhooks(userID uuid.UUID, teamID *uuid.UUID) ([]models.Webhook, error) {
+	query := ws.db.Model(&models.Webhook{})
+	if teamID != nil {
+		if err := ws.policy.AuthorizeTeam(userID, *teamID, PermTeamManage); err != nil {
+			return nil, err
+		}
+		query = query.Where("team_id = ?", *teamID)
+	} else {
+		query = query.Where("user_id = ? AND team_id IS NULL", userID)
+	}
+
+	var webhooks []models.Webhook
+	if err := query.Order("created_at DESC").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook replaces the URL and event filter. A nil active leaves the
+// webhook's state unchanged.
+func (ws *WebhookService) UpdateWebhook(webhookID, userID uuid.UUID, rawURL string, events []string, active *bool) (*models.Webhook, error) {
+	webhook, err := ws.findWebhook(webhookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.validateURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	webhook.URL = rawURL
+	webhook.Events = normalizeEvents(events)
+	if active != nil {
+		webhook.Active = *active
+	}
+	err = ws.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(webhook).Error; err != nil {
+			return err
+		}
+		if webhook.Active {
+			return nil
+		}
+		// Events queued for an inactive webhook are dropped, not sent late
+		// if it is turned back on
+		return tx.Model(&models.WebhookDelivery{}).
+			Where("webhook_id = ? AND status = ?", webhook.ID, models.DeliveryPending).
+			Updates(map[string]interface{}{"status": models.DeliveryFailed, "error": "webhook deactivated"}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (ws *WebhookService) DeleteWebhook(webhookID, userID uuid.UUID) error {
+	webhook, err := ws.findWebhook(webhookID, userID)
+	if err != nil {
+		return err
+	}
+
+	return ws.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(webhook).Error
+	})
+}
+
+func (ws *WebhookService) ListDeliveries(webhookID, userID uuid.UUID, limit, offset int) ([]models.WebhookDelivery, int64, error) {
+	if _, err := ws.findWebhook(webhookID, userID); err != nil {
+		return nil, 0, err
+	}
+
+	var deliveries []models.WebhookDelivery
+	var total int64
+
+	query := ws.db.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	query.Count(&total)
+
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, total, nil
+}
+
+// Redeliver queues a new delivery with the payload of an earlier one.
+func (ws *WebhookService) Redeliver(webhookID, deliveryID, userID uuid.UUID) (*models.WebhookDelivery, error) {
+	webhook, err := ws.findWebhook(webhookID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var original models.WebhookDelivery
+	if err := ws.db.Where("id = ? AND webhook_id = ?", deliveryID, webhookID).First(&original).Error; err != nil {
+		return nil, notFound("delivery not found")
+	}
+
+	return ws.enqueue(webhook, original.Event, original.Payload)
+}
+
+// Ping queues a test event so subscribers can check their receiver.
+func (ws *WebhookService) Ping(webhookID, userID uuid.UUID) (*models.WebhookDelivery, error) {
+	webhook, err := ws.findWebhook(webhookID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(WebhookPayload{
+		ID:        uuid.New(),
+		Event:     "ping",
+		CreatedAt: time.Now(),
+		Data:      map[string]interface{}{"webhook_id": webhook.ID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ws.enqueue(webhook, "ping", string(payload))
+}
+
+// OnActivity queues deliveries for every active webhook subscribed to the
+// event. Team webhooks receive their team's events; personal webhooks receive
+// events the user caused and events on their personal content.
+func (ws *WebhookService) OnActivity(event *models.ActivityEvent) {
+	query := ws.db.Where("active = ?", true)
+	if event.TeamID != nil {
+		query = query.Where("team_id = ?", *event.TeamID)
+	} else {
+		userIDs := []uuid.UUID{event.ActorID}
+		if event.ContentID != nil {
+			var content models.Content
+			if err := ws.db.Select("user_id").First(&content, *event.ContentID).Error; err == nil && content.UserID != event.ActorID {
+				userIDs = append(userIDs, content.UserID)
+			}
+		}
+		query = query.Where("team_id IS NULL AND user_id IN ?", userIDs)
+	}
+
+	var webhooks []models.Webhook
+	if err := query.Find(&webhooks).Error; err != nil {
+		log.Printf("failed to load webhooks for %s: %v", event.Verb, err)
+		return
+	}
+
+	var payload []byte
+	for i := range webhooks {
+		if !subscribed(webhooks[i].Events, event.Verb) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(WebhookPayload{
+				ID:        event.ID,
+				Event:     event.Verb,
+				CreatedAt: event.CreatedAt,
+				Data: map[string]interface{}{
+					"actor_id":    event.ActorID,
+					"object_type": event.ObjectType,
+					"object_id":   event.ObjectID,
+					"content_id":  event.ContentID,
+					"team_id":     event.TeamID,
+					"summary":     event.Summary,
+				},
+			})
+			if err != nil {
+				log.Printf("failed to encode webhook payload for %s: %v", event.Verb, err)
+				return
+			}
+		}
+		if _, err := ws.enqueue(&webhooks[i], event.Verb, string(payload)); err != nil {
+			log.Printf("failed to queue webhook %s: %v", webhooks[i].ID, err)
+		}
+	}
+}
+
+func (ws *WebhookService) enqueue(webhook *models.Webhook, event, payload string) (*models.WebhookDelivery, error) {
+	if !webhook.Active {
+		return nil, conflict("webhook is inactive")
+	}
+	delivery := &models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		Event:         event,
+		Payload:       payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+
+	if err := ws.db.Create(delivery).Error; err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func (ws *WebhookService) worker() {
+	defer close(ws.stopped)
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ws.stop:
+			return
+		case <-ticker.C:
+		}
+		for _, delivery := range ws.claimDue() {
+			select {
+			case <-ws.stop:
+				return
+			default:
+			}
+			ws.deliver(delivery)
+		}
+	}
+}
+
+// claimDue leases a batch of due deliveries to active webhooks. SKIP
+// LOCKED lets several server instances share the queue without delivering
+// twice.
+func (ws *WebhookService) claimDue() []models.WebhookDelivery {
+	var deliveries []models.WebhookDelivery
+	err := ws.db.Transaction(func(tx *gorm.DB) error {
+		active := tx.Model(&models.Webhook{}).Select("id").Where("active = ?", true)
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Preload("Webhook").
+			Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+			Where("webhook_id IN (?)", active).
+			Order("next_attempt_at").
+			Limit(webhookBatchSize).
+			Find(&deliveries).Error; err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(deliveries))
+		for i, d := range deliveries {
+			ids[i] = d.ID
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).
+			Update("next_attempt_at", time.Now().Add(webhookLease)).Error
+	})
+	if err != nil {
+		log.Printf("failed to claim webhook deliveries: %v", err)
+		return nil
+	}
+	return deliveries
+}
+
+func (ws *WebhookService) deliver(delivery models.WebhookDelivery) {
+	start := time.Now()
+	status, body, err := ws.send(&delivery.Webhook, delivery.ID, delivery.Event, delivery.Payload)
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = &start
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+	delivery.Error = ""
+
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		delivery.Status = models.DeliverySucceeded
+	case delivery.Attempts >= webhookMaxAttempts:
+		delivery.Status = models.DeliveryFailed
+	default:
+		delivery.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	} else if delivery.Status != models.DeliverySucceeded {
+		delivery.Error = fmt.Sprintf("receiver responded with status %d", status)
+	}
+
+	if err := ws.db.Omit("Webhook").Save(&delivery).Error; err != nil {
+		log.Printf("failed to update webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send POSTs the payload with an HMAC-SHA256 signature over
+// "<timestamp>.<body>" so receivers can verify origin and reject replays.
+func (ws *WebhookService) send(webhook *models.Webhook, deliveryID uuid.UUID, event, payload string) (int, string, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(timestamp + "." + payload))
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewBufferString(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "InscribeAI-Webhooks/1.0")
+	req.Header.Set("X-InscribeAI-Event", event)
+	req.Header.Set("X-InscribeAI-Delivery", deliveryID.String())
+	req.Header.Set("X-InscribeAI-Timestamp", timestamp)
+	req.Header.Set("X-InscribeAI-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBody))
+	return resp.StatusCode, string(body), nil
+}
+
+func (ws *WebhookService) findWebhook(webhookID, userID uuid.UUID) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := ws.db.First(&webhook, webhookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("webhook not found")
+		}
+		return nil, err
+	}
+	if err := ws.authorizeOwner(userID, webhook.UserID, webhook.TeamID); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// authorizeOwner allows team webhooks to be managed by anyone with
+// team:manage and personal webhooks by their creator only.
+func (ws *WebhookService) authorizeOwner(userID, ownerID uuid.UUID, teamID *uuid.UUID) error {
+	if teamID != nil {
+		return ws.policy.AuthorizeTeam(userID, *teamID, PermTeamManage)
+	}
+	if userID != ownerID {
+		return notFound("webhook not found")
+	}
+	return nil
+}
+
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff << (attempts - 1)
+	if backoff <= 0 || backoff > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return backoff
+}
+
+// subscribed matches a verb against an event filter. Filters may name a
+// verb exactly or a whole group such as "content.*".
+func subscribed(filters []string, verb string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if f == "*" || f == verb {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(f, "*"); ok && strings.HasPrefix(verb, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeEvents(events []string) []string {
+	normalized := []string{}
+	for _, e := range events {
+		if e = strings.TrimSpace(e); e != "" {
+			normalized = append(normalized, e)
+		}
+	}
+	return normalized
+}
+
+// validateURL requires an http or https URL whose host resolves only to
+// public addresses. The client checks again when connecting, since DNS
+// answers can change after the webhook is saved.
+func (ws *WebhookService) validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return invalidInput("webhook url must be an absolute http or https URL")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return invalidInput("webhook host could not be resolved")
+	}
+	for _, addr := range addrs {
+		if !ws.permittedIP(addr.IP) {
+			return invalidInput("webhook url must point to a public address")
+		}
+	}
+	return nil
+}
+
+// permittedIP rejects loopback, private, link-local, multicast and
+// unspecified addresses, which would let webhooks probe internal services.
+func (ws *WebhookService) permittedIP(ip net.IP) bool {
+	if ws.allowPrivate {
+		return true
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), private in
+// practice though not covered by IsPrivate.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"inscribeai/models"
+)
+
+func TestWebhookURLMustBePublic(t *testing.T) {
+	env := newTestEnv(t)
+	ws := NewWebhookService(env.db, env.policy)
+
+	for _, rawURL := range []string{
+		"ftp://93.184.216.34/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://10.1.2.3/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+	} {
+		if err := ws.validateURL(rawURL); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: got %v, want invalid input", rawURL, err)
+		}
+	}
+	if err := ws.validateURL("https://93.184.216.34/hook"); err != nil {
+		t.Errorf("public address rejected: %v", err)
+	}
+
+	// The client checks the address it connects to as well, in case DNS
+	// changes after the URL was validated
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback receiver")
+	}))
+	defer receiver.Close()
+	webhook := &models.Webhook{URL: receiver.URL, Secret: "secret"}
+	if _, _, err := ws.send(webhook, webhook.ID, "ping", "{}"); err == nil {
+		t.Error("sending to a loopback receiver succeeded")
+	}
+}
+
+func TestWebhookDeliveryIsSignedAndLeased(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	env := newTestEnv(t)
+	ws := NewWebhookService(env.db, env.policy)
+	alice := env.createUser(t, "alice")
+
+	type received struct {
+		header http.Header
+		body   string
+	}
+	requests := make(chan received, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{r.Header.Clone(), string(body)}
+	}))
+	defer receiver.Close()
+
+	webhook, secret, err := ws.CreateWebhook(alice.ID, nil, receiver.URL, nil)
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	delivery, err := ws.Ping(webhook.ID, alice.ID)
+	if err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	claimed := ws.claimDue()
+	if len(claimed) != 1 || claimed[0].ID != delivery.ID {
+		t.Fatalf("claimed %d deliveries, want the ping", len(claimed))
+	}
+	if again := ws.claimDue(); len(again) != 0 {
+		t.Fatalf("leased delivery was claimed again")
+	}
+	var leased models.WebhookDelivery
+	env.db.First(&leased, delivery.ID)
+	if until := time.Until(leased.NextAttemptAt); until < webhookBatchSize*webhookTimeout {
+		t.Errorf("lease of %v does not outlast a batch of timeouts", until)
+	}
+
+	ws.deliver(claimed[0])
+	req := <-requests
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(req.header.Get("X-InscribeAI-Timestamp") + "." + req.body))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.header.Get("X-InscribeAI-Signature") != want {
+		t.Errorf("signature %q, want %q", req.header.Get("X-InscribeAI-Signature"), want)
+	}
+	if req.header.Get("X-InscribeAI-Event") != "ping" || req.header.Get("X-InscribeAI-Delivery") != delivery.ID.String() {
+		t.Errorf("event headers %q %q", req.header.Get("X-InscribeAI-Event"), req.header.Get("X-InscribeAI-Delivery"))
+	}
+
+	var sent models.WebhookDelivery
+	env.db.First(&sent, delivery.ID)
+	if sent.Status != models.DeliverySucceeded || sent.Attempts != 1 {
+		t.Errorf("delivery status %s after %d attempts", sent.Status, sent.Attempts)
+	}
+}
+
+func TestInactiveWebhookDeliveriesAreNotSent(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	env := newTestEnv(t)
+	ws := NewWebhookService(env.db, env.policy)
+	alice := env.createUser(t, "alice")
+
+	webhook, _, err := ws.CreateWebhook(alice.ID, nil, "http://127.0.0.1:9/hook", nil)
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	queued, err := ws.Ping(webhook.ID, alice.ID)
+	if err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	inactive := false
+	if _, err := ws.UpdateWebhook(webhook.ID, alice.ID, webhook.URL, nil, &inactive); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	var dropped models.WebhookDelivery
+	env.db.First(&dropped, queued.ID)
+	if dropped.Status != models.DeliveryFailed {
+		t.Errorf("queued delivery has status %s after deactivation, want failed", dropped.Status)
+	}
+
+	if _, err := ws.Ping(webhook.ID, alice.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("ping to an inactive webhook: got %v, want conflict", err)
+	}
+
+	// Deliveries left pending by other paths are skipped, not sent
+	stray := &models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		Event:         "ping",
+		Payload:       "{}",
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := env.db.Create(stray).Error; err != nil {
+		t.Fatalf("create delivery: %v", err)
+	}
+	if claimed := ws.claimDue(); len(claimed) != 0 {
+		t.Errorf("claimed %d deliveries of an inactive webhook", len(claimed))
+	}
+}
+
+func TestWebhookServiceStops(t *testing.T) {
+	env := newTestEnv(t)
+	ws := NewWebhookService(env.db, env.policy)
+	ws.Start()
+
+	stopped := make(chan struct{})
+	go func() {
+		ws.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not return")
+	}
+}
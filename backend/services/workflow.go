@@ -0,0 +1,354 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"inscribeai/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// workflowTransitions lists the allowed status changes and the permission
+// each requires. Moving to approved happens through reviewer decisions, never
+// as a direct transition.
+var workflowTransitions = map[string]map[string]Permission{
+	models.StatusDraft: {
+		models.StatusInReview: PermContentEdit,
+	},
+	models.StatusInReview: {
+		models.StatusDraft: PermContentEdit,
+	},
+	models.StatusChangesRequested: {
+		models.StatusInReview: PermContentEdit,
+		models.StatusDraft:    PermContentEdit,
+	},
+	models.StatusApproved: {
+		models.StatusPublished: PermContentPublish,
+		models.StatusDraft:     PermContentEdit,
+	},
+	models.StatusPublished: {
+		models.StatusDraft: PermContentPublish,
+	},
+}
+
+type WorkflowService struct {
+	db       *gorm.DB
+	policy   *PolicyService
+	activity *ActivityService
+}
+
+func NewWorkflowService(db *gorm.DB, policy *PolicyService, activity *ActivityService) *WorkflowService {
+	return &WorkflowService{db: db, policy: policy, activity: activity}
+}
+
+// WorkflowState is the review state of a content item.
+type WorkflowState struct {
+	Status            string                      `json:"status"`
+	RequiredApprovals int                         `json:"required_approvals"`
+	Approvals         int                         `json:"approvals"`
+	Reviewers         []models.ReviewAssignment   `json:"reviewers"`
+	History           []models.WorkflowTransition `json:"history"`
+}
+
+func (ws *WorkflowService) GetWorkflow(contentID, userID uuid.UUID) (*WorkflowState, error) {
+	content, err := ws.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.policy.AuthorizeContent(userID, content, PermContentView); err != nil {
+		return nil, err
+	}
+
+	state := &WorkflowState{Status: content.Status}
+	if err := ws.db.Preload("Reviewer").Where("content_id = ?", contentID).Order("created_at").Find(&state.Reviewers).Error; err != nil {
+		return nil, err
+	}
+	if err := ws.db.Preload("Actor").Where("content_id = ?", contentID).Order("created_at").Find(&state.History).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range state.Reviewers {
+		if r.Decision == models.DecisionApproved {
+			state.Approvals++
+		}
+	}
+	state.RequiredApprovals, err = ws.requiredApprovals(ws.db, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (ws *WorkflowService) AssignReviewer(contentID, actorID, reviewerID uuid.UUID) (*models.ReviewAssignment, error) {
+	content, err := ws.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.policy.AuthorizeContent(actorID, content, PermContentEdit); err != nil {
+		return nil, err
+	}
+	if reviewerID == content.UserID {
+		return nil, invalidInput("authors cannot review their own content")
+	}
+	if err := ws.policy.AuthorizeContent(reviewerID, content, PermContentView); err != nil {
+		return nil, invalidInput("reviewer cannot access this content")
+	}
+
+	assignment := &models.ReviewAssignment{
+		ContentID:  contentID,
+		ReviewerID: reviewerID,
+		AssignedBy: actorID,
+		Decision:   models.DecisionPending,
+	}
+
+	// The unique index on content and reviewer decides, as for team members
+	result := ws.db.Clauses(clause.OnConflict{DoNothing: true}).Create(assignment)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, conflict("reviewer is already assigned")
+	}
+
+	ws.activity.RecordContent(actorID, VerbReviewerAssigned, content, "assigned a reviewer")
+	return assignment, nil
+}
+
+func (ws *WorkflowService) RemoveReviewer(contentID, actorID, reviewerID uuid.UUID) error {
+	content, err := ws.findContent(contentID)
+	if err != nil {
+		return err
+	}
+	if err := ws.policy.AuthorizeContent(actorID, content, PermContentEdit); err != nil {
+		return err
+	}
+
+	return ws.db.Transaction(func(tx *gorm.DB) error {
+		required, err := ws.requiredApprovals(tx, content)
+		if err != nil {
+			return err
+		}
+		result := tx.Where("content_id = ? AND reviewer_id = ?", contentID, reviewerID).Delete(&models.ReviewAssignment{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return notFound("reviewer not assigned")
+		}
+
+		// Content in review must keep enough reviewers to be approved
+		if content.Status != models.StatusInReview {
+			return nil
+		}
+		var reviewers int64
+		if err := tx.Model(&models.ReviewAssignment{}).Where("content_id = ?", contentID).Count(&reviewers).Error; err != nil {
+			return err
+		}
+		if int(reviewers) < required {
+			return conflict("content in review needs " + strconv.Itoa(required) + " reviewers; assign another before removing this one")
+		}
+		return nil
+	})
+}
+
+// Transition moves content to another status. Submitting for review resets
+// earlier reviewer decisions, and goes straight to approved when the team
+// requires no approvals. Content needs at least as many reviewers as
+// approvals it requires, and personal content needs one to be submitted.
+func (ws *WorkflowService) Transition(contentID, actorID uuid.UUID, to, comment string) (*models.Content, error) {
+	content, err := ws.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+
+	perm, ok := workflowTransitions[content.Status][to]
+	if !ok {
+		return nil, invalidInput("cannot move content from " + content.Status + " to " + to)
+	}
+	if err := ws.policy.AuthorizeContent(actorID, content, perm); err != nil {
+		return nil, err
+	}
+
+	var transitions []*models.WorkflowTransition
+	err = ws.db.Transaction(func(tx *gorm.DB) error {
+		transition, err := ws.setStatus(tx, content, actorID, to, comment)
+		if err != nil {
+			return err
+		}
+		transitions = append(transitions, transition)
+		if to != models.StatusInReview {
+			return nil
+		}
+
+		if err := tx.Model(&models.ReviewAssignment{}).
+			Where("content_id = ?", contentID).
+			Updates(map[string]interface{}{"decision": models.DecisionPending, "comment": "", "decided_at": nil}).Error; err != nil {
+			return err
+		}
+		required, err := ws.requiredApprovals(tx, content)
+		if err != nil {
+			return err
+		}
+		if required == 0 && content.TeamID == nil {
+			return invalidInput("assign a reviewer before submitting for review")
+		}
+		var reviewers int64
+		if err := tx.Model(&models.ReviewAssignment{}).Where("content_id = ?", contentID).Count(&reviewers).Error; err != nil {
+			return err
+		}
+		if int(reviewers) < required {
+			return invalidInput("assign at least " + strconv.Itoa(required) + " reviewers before submitting for review")
+		}
+		if required == 0 {
+			transition, err := ws.setStatus(tx, content, actorID, models.StatusApproved, "no approvals required")
+			if err != nil {
+				return err
+			}
+			transitions = append(transitions, transition)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ws.recordTransitions(content, transitions)
+	return content, nil
+}
+
+// Review records an assigned reviewer's decision. Requesting changes sends
+// the content back to its author; enough approvals mark it approved.
+func (ws *WorkflowService) Review(contentID, reviewerID uuid.UUID, decision, comment string) (*models.Content, error) {
+	if decision != models.DecisionApproved && decision != models.DecisionChangesRequested {
+		return nil, invalidInput("decision must be approved or changes_requested")
+	}
+
+	content, err := ws.findContent(contentID)
+	if err != nil {
+		return nil, err
+	}
+	if content.Status != models.StatusInReview {
+		return nil, conflict("content is not in review")
+	}
+
+	var assignment models.ReviewAssignment
+	if err := ws.db.Where("content_id = ? AND reviewer_id = ?", contentID, reviewerID).First(&assignment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, forbidden("you are not a reviewer of this content")
+		}
+		return nil, err
+	}
+	if err := ws.policy.AuthorizeContent(reviewerID, content, PermContentView); err != nil {
+		return nil, err
+	}
+
+	var transition *models.WorkflowTransition
+	err = ws.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		assignment.Decision = decision
+		assignment.Comment = comment
+		assignment.DecidedAt = &now
+		if err := tx.Save(&assignment).Error; err != nil {
+			return err
+		}
+
+		if decision == models.DecisionChangesRequested {
+			transition, err = ws.setStatus(tx, content, reviewerID, models.StatusChangesRequested, comment)
+			return err
+		}
+
+		var approvals int64
+		if err := tx.Model(&models.ReviewAssignment{}).
+			Where("content_id = ? AND decision = ?", contentID, models.DecisionApproved).
+			Count(&approvals).Error; err != nil {
+			return err
+		}
+		required, err := ws.requiredApprovals(tx, content)
+		if err != nil {
+			return err
+		}
+		if int(approvals) >= required {
+			transition, err = ws.setStatus(tx, content, reviewerID, models.StatusApproved, comment)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ws.activity.RecordContent(reviewerID, VerbContentReviewed, content, decision+reviewComment(comment))
+	if transition != nil {
+		ws.recordTransitions(content, []*models.WorkflowTransition{transition})
+	}
+	return content, nil
+}
+
+func (ws *WorkflowService) setStatus(tx *gorm.DB, content *models.Content, actorID uuid.UUID, to, comment string) (*models.WorkflowTransition, error) {
+	transition := &models.WorkflowTransition{
+		ContentID:  content.ID,
+		ActorID:    actorID,
+		FromStatus: content.Status,
+		ToStatus:   to,
+		Comment:    comment,
+	}
+	if err := tx.Create(transition).Error; err != nil {
+		return nil, err
+	}
+
+	content.Status = to
+	if err := tx.Model(content).Update("status", to).Error; err != nil {
+		return nil, err
+	}
+	return transition, nil
+}
+
+// recordTransitions logs committed status changes to the activity feed.
+func (ws *WorkflowService) recordTransitions(content *models.Content, transitions []*models.WorkflowTransition) {
+	for _, t := range transitions {
+		ws.activity.RecordContent(t.ActorID, VerbContentStatusChanged, content, t.FromStatus+" → "+t.ToStatus+reviewComment(t.Comment))
+	}
+}
+
+func reviewComment(comment string) string {
+	if comment == "" {
+		return ""
+	}
+	return ": " + truncate(comment, 140)
+}
+
+// requiredApprovals comes from the team setting for workspace content. Personal
+// content needs one approval once a reviewer has been assigned.
+func (ws *WorkflowService) requiredApprovals(tx *gorm.DB, content *models.Content) (int, error) {
+	if content.TeamID != nil {
+		var team models.Team
+		if err := tx.First(&team, *content.TeamID).Error; err != nil {
+			return 0, err
+		}
+		return team.RequiredApprovals, nil
+	}
+
+	var reviewers int64
+	if err := tx.Model(&models.ReviewAssignment{}).Where("content_id = ?", content.ID).Count(&reviewers).Error; err != nil {
+		return 0, err
+	}
+	if reviewers > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (ws *WorkflowService) findContent(contentID uuid.UUID) (*models.Content, error) {
+	var content models.Content
+	if err := ws.db.First(&content, contentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound("content not found")
+		}
+		return nil, err
+	}
+	return &content, nil
+}
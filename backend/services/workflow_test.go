@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"inscribeai/models"
+)
+
+func TestReviewWorkflow(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	team := env.createTeam(t, alice, "Alice Co")
+	for _, u := range []*models.User{bob, carol} {
+		if err := env.collab.AddTeamMember(team.ID, alice.ID, u.ID, models.RoleMember); err != nil {
+			t.Fatalf("add %s: %v", u.Name, err)
+		}
+	}
+	if _, err := env.collab.UpdateWorkflowSettings(team.ID, alice.ID, 2); err != nil {
+		t.Fatalf("require approvals: %v", err)
+	}
+	content := env.createContent(t, alice, "Launch post", &team.ID)
+
+	if _, err := env.workflow.AssignReviewer(content.ID, alice.ID, bob.ID); err != nil {
+		t.Fatalf("assign bob: %v", err)
+	}
+	if _, err := env.workflow.AssignReviewer(content.ID, alice.ID, bob.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("assigning bob twice: got %v, want conflict", err)
+	}
+	if _, err := env.workflow.Transition(content.ID, alice.ID, models.StatusInReview, ""); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("submitting with one of two reviewers: got %v, want invalid input", err)
+	}
+
+	if _, err := env.workflow.AssignReviewer(content.ID, alice.ID, carol.ID); err != nil {
+		t.Fatalf("assign carol: %v", err)
+	}
+	if _, err := env.workflow.Transition(content.ID, alice.ID, models.StatusInReview, ""); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if _, err := env.content.UpdateContent(content.ID, alice.ID, "Launch post", "Edited in review", nil); !errors.Is(err, ErrConflict) {
+		t.Errorf("editing in review: got %v, want conflict", err)
+	}
+
+	reviewed, err := env.workflow.Review(content.ID, bob.ID, models.DecisionApproved, "")
+	if err != nil {
+		t.Fatalf("bob approves: %v", err)
+	}
+	if reviewed.Status != models.StatusInReview {
+		t.Fatalf("one of two approvals gave status %s", reviewed.Status)
+	}
+	if err := env.workflow.RemoveReviewer(content.ID, alice.ID, carol.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("removing a needed reviewer in review: got %v, want conflict", err)
+	}
+
+	reviewed, err = env.workflow.Review(content.ID, carol.ID, models.DecisionApproved, "")
+	if err != nil {
+		t.Fatalf("carol approves: %v", err)
+	}
+	if reviewed.Status != models.StatusApproved {
+		t.Fatalf("two approvals gave status %s", reviewed.Status)
+	}
+
+	if _, err := env.workflow.Transition(content.ID, alice.ID, models.StatusPublished, ""); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := env.content.UpdateContent(content.ID, alice.ID, "Launch post", "Edited after publishing", nil); !errors.Is(err, ErrConflict) {
+		t.Errorf("editing published content: got %v, want conflict", err)
+	}
+}
+
+func TestEditingApprovedContentReturnsItToDraft(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	team := env.createTeam(t, alice, "Alice Co")
+	if err := env.collab.AddTeamMember(team.ID, alice.ID, bob.ID, models.RoleMember); err != nil {
+		t.Fatalf("add bob: %v", err)
+	}
+	content := env.createContent(t, alice, "Launch post", &team.ID)
+
+	if _, err := env.workflow.AssignReviewer(content.ID, alice.ID, bob.ID); err != nil {
+		t.Fatalf("assign bob: %v", err)
+	}
+	if _, err := env.workflow.Transition(content.ID, alice.ID, models.StatusInReview, ""); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if _, err := env.workflow.Review(content.ID, bob.ID, models.DecisionApproved, ""); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+
+	updated, err := env.content.UpdateContent(content.ID, alice.ID, "Launch post", "Edited after approval", nil)
+	if err != nil {
+		t.Fatalf("edit approved content: %v", err)
+	}
+	if updated.Status != models.StatusDraft {
+		t.Errorf("edited approved content has status %s, want draft", updated.Status)
+	}
+}
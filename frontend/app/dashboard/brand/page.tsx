@@ -122,7 +122,7 @@ export default function BrandPage() {
                 }
                 rows={4}
                 className="w-full px-4 py-2 border border-gray-300 dark:border-gray-600 rounded-lg bg-white dark:bg-gray-700 font-mono text-sm"
-                placeholder='{"formality": "professional", "humor": "none"}'
+                placeholder='{"formality": "formal", "reading_level": "general", "emoji_policy": "none", "banned_terms": ["synergy"]}'
               />
             </div>
 
@@ -161,9 +161,9 @@ export default function BrandPage() {
               <p className="text-gray-600 dark:text-gray-400 mb-4">
                 {tone.description}
               </p>
-              {tone.settings && (
+              {tone.settings && Object.keys(tone.settings).length > 0 && (
                 <pre className="text-xs bg-gray-50 dark:bg-gray-700 p-2 rounded overflow-x-auto">
-                  {tone.settings}
+                  {JSON.stringify(tone.settings, null, 2)}
                 </pre>
               )}
             </div>
@@ -20,6 +20,10 @@ def generate():
         data = request.get_json()
         prompt = data.get("prompt", "")
         max_tokens = data.get("max_tokens", 1000)
+        try:
+            temperature = min(max(float(data.get("temperature", 0.7)), 0.0), 2.0)
+        except (TypeError, ValueError):
+            return jsonify({"error": "temperature must be a number"}), 400
 
         if not prompt:
             return jsonify({"error": "prompt is required"}), 400
@@ -33,7 +37,7 @@ def generate():
             from gpt4all import GPT4All
             
             model = GPT4All(MODEL_PATH)
-            response = model.generate(prompt, max_tokens=max_tokens, temp=0.7)
+            response = model.generate(prompt, max_tokens=max_tokens, temp=temperature)
             
             return jsonify({
                 "content": response,
@@ -54,6 +58,45 @@ def generate():
     except Exception as e:
         return jsonify({"error": str(e)}), 500
 
+# Embed4All's bundled sentence embedding model
+EMBEDDING_MODEL = "all-MiniLM-L6-v2"
+_embedder = None
+
+@app.route("/embed", methods=["POST"])
+def embed():
+    global _embedder
+    try:
+        data = request.get_json()
+        texts = data.get("texts", [])
+        model = data.get("model", EMBEDDING_MODEL)
+
+        if not isinstance(texts, list) or not all(isinstance(t, str) for t in texts):
+            return jsonify({"error": "texts must be a list of strings"}), 400
+        if model != EMBEDDING_MODEL:
+            return jsonify({"error": f"unsupported embedding model {model}"}), 400
+
+        try:
+            from gpt4all import Embed4All
+
+            if _embedder is None:
+                _embedder = Embed4All()
+            embeddings = [_embedder.embed(text) for text in texts]
+
+            return jsonify({
+                "embeddings": embeddings,
+                "model": EMBEDDING_MODEL,
+                "error": None
+            })
+        except ImportError:
+            # Unlike generation there is no useful mock: the backend can use
+            # its own hashing embedder instead (EMBEDDER=hash)
+            return jsonify({"error": "gpt4all is not installed; set EMBEDDER=hash on the backend"}), 503
+        except Exception as e:
+            return jsonify({"error": str(e)}), 500
+
+    except Exception as e:
+        return jsonify({"error": str(e)}), 500
+
 if __name__ == "__main__":
     port = int(os.getenv("PORT", 8000))
     app.run(host="0.0.0.0", port=port, debug=True)